@@ -0,0 +1,23 @@
+import { useQuery } from '@tanstack/react-query';
+import { format } from 'date-fns';
+import type { Statistics, StatisticsInterval } from '../../types';
+
+// Часовой пояс браузера: сервер считает границы дней и интервалов в нём
+const timezone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+
+export const useGetStatistics = (startDate: Date, endDate: Date, interval: StatisticsInterval) => {
+    const from = format(startDate, 'yyyy-MM-dd');
+    const to = format(endDate, 'yyyy-MM-dd');
+    return useQuery<Statistics, Error>({
+        queryKey: ['statistics', from, to, interval],
+        queryFn: async () => {
+            const params = new URLSearchParams({ from, to, interval, tz: timezone });
+            const res = await fetch(import.meta.env.VITE_API_URL + '/api/statistics?' + params, { credentials: 'include' });
+            if (!res.ok) {
+                const error = await res.json().catch(() => ({ message: 'Ошибка загрузки статистики' }));
+                throw new Error(error.message || error.error || 'Failed to fetch statistics');
+            }
+            return res.json();
+        },
+    });
+};
@@ -17,7 +17,7 @@ const TransactionItem: React.FC<TransactionItemProps> = ({ transaction, onEdit,
     const isPending = false
     const handleDelete = () => {
         if (window.confirm("Are you sure you want to delete this transaction?")) {
-            deleteTransaction.mutate(transaction.id);
+            deleteTransaction.mutate(transaction);
         }
     };
 
@@ -1,16 +1,26 @@
 ﻿import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
-import type { Transaction, NewTransactionData } from '../../types';
+import type { Transaction, NewTransactionData, TransactionPage } from '../../types';
 
 export const useGetTransactions = () => {
     return useQuery<Transaction[], Error>({
         queryKey: ['transactions'],
         queryFn: async () => {
-            const res = await fetch(import.meta.env.VITE_API_URL + '/api/transactions', { credentials: 'include' });
-            if (!res.ok) {
-                const error = await res.json().catch(() => ({ message: 'Ошибка загрузки' }));
-                throw new Error(error.message || 'Failed to fetch');
-            }
-            return res.json();
+            // API отдаёт транзакции постранично: идём по next_cursor, пока страницы не закончатся
+            const all: Transaction[] = [];
+            let cursor = '';
+            do {
+                const params = new URLSearchParams({ limit: '500' });
+                if (cursor) params.set('cursor', cursor);
+                const res = await fetch(import.meta.env.VITE_API_URL + '/api/transactions?' + params, { credentials: 'include' });
+                if (!res.ok) {
+                    const error = await res.json().catch(() => ({ message: 'Ошибка загрузки' }));
+                    throw new Error(error.message || 'Failed to fetch');
+                }
+                const page: TransactionPage = await res.json();
+                all.push(...page.transactions);
+                cursor = page.next_cursor;
+            } while (cursor);
+            return all;
         },
         initialData: [],
     });
@@ -51,40 +61,52 @@ export const useTransactionsManager = () => {
                 date: `${tx.date.slice(0, 10)}T00:00:00Z`,
                 type: tx.type,
             };
+            // If-Match с версией из списка: если транзакцию успели изменить, сервер ответит 412
             const res = await fetch(import.meta.env.VITE_API_URL+`/api/transactions/${tx.id}`, {
                 method: 'PATCH',
-                headers: { 'Content-Type': 'application/json' },
+                headers: { 'Content-Type': 'application/json', 'If-Match': `"${tx.version ?? 0}"` },
                 credentials: 'include',
                 body: JSON.stringify(payload),
             });
+            if (res.status === 412) {
+                queryClient.invalidateQueries({ queryKey: ['transactions'] });
+                throw new Error('Транзакция изменилась, список обновлён. Повторите изменение');
+            }
             if (!res.ok) {
                 const err = await res.json().catch(() => ({ message: 'Ошибка обновления' }));
                 throw new Error(err.message || 'Failed to update');
             }
-            return res.json(); // { success, message }
+            // Новая версия приходит в ETag
+            const version = Number(res.headers.get('ETag')?.replace(/"/g, ''));
+            return Number.isNaN(version) ? tx.version : version;
         },
-        onSuccess: (_, updatedTx) => {
+        onSuccess: (version, updatedTx) => {
             queryClient.setQueryData<Transaction[]>(['transactions'], (old = []) =>
-                old.map((tx) => (tx.id === updatedTx.id ? { ...updatedTx } : tx))
+                old.map((tx) => (tx.id === updatedTx.id ? { ...updatedTx, version } : tx))
             );
         },
     });
 
     // Удаление
     const deleteTransaction = useMutation({
-        mutationFn: async (id: string) => {
-            const res = await fetch(import.meta.env.VITE_API_URL+`/api/transactions/${id}`, {
+        mutationFn: async (tx: Transaction) => {
+            const res = await fetch(import.meta.env.VITE_API_URL+`/api/transactions/${tx.id}`, {
                 method: 'DELETE',
+                headers: { 'If-Match': `"${tx.version ?? 0}"` },
                 credentials: 'include',
             });
+            if (res.status === 412) {
+                queryClient.invalidateQueries({ queryKey: ['transactions'] });
+                throw new Error('Транзакция изменилась, список обновлён. Повторите удаление');
+            }
             if (!res.ok) {
                 const err = await res.json().catch(() => ({ message: 'Ошибка удаления' }));
                 throw new Error(err.message || 'Failed to delete');
             }
         },
-        onSuccess: (_, id) => {
+        onSuccess: (_, deleted) => {
             queryClient.setQueryData<Transaction[]>(['transactions'], (old = []) =>
-                old.filter((tx) => tx.id !== id)
+                old.filter((tx) => tx.id !== deleted.id)
             );
         },
     });
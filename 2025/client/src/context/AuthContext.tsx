@@ -7,6 +7,7 @@ interface AuthContextType extends AuthState {
     logout: () => Promise<void>;
     fetchAndSendToken: (getClaims: () => Promise<any>) => Promise<void>;
     update: (name: string, emil: string) => void;
+    setBaseCurrency: (currency: string) => Promise<void>;
     changePassword: (password: string, newPassword: string) => void;
 }
 
@@ -120,6 +121,20 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({children}) => {
         }
     };
 
+    const setBaseCurrency = async (currency: string) => {
+        const response = await fetch(import.meta.env.VITE_API_URL+"/api/auth/update", {
+            method: "PATCH",
+            headers: {"Content-Type": "application/json"},
+            credentials: 'include',
+            body: JSON.stringify({base_currency: currency}),
+        });
+        if (!response.ok) {
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.error || `Ошибка обновления валюты: ${response.statusText}`);
+        }
+        await validateUser();
+    };
+
     const update = async (name: string, email: string) => {
         try {
             const response = await fetch(import.meta.env.VITE_API_URL+"/api/auth/update", {
@@ -199,7 +214,7 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({children}) => {
     };
 
     return (
-        <AuthContext.Provider value={{...authState, login, register, logout, fetchAndSendToken, update, changePassword }}>
+        <AuthContext.Provider value={{...authState, login, register, logout, fetchAndSendToken, update, setBaseCurrency, changePassword }}>
             {children}
         </AuthContext.Provider>
     );
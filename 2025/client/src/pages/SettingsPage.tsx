@@ -10,7 +10,7 @@ type ActiveTab = 'profile' | 'password' | 'appearance' | 'notifications' | 'bill
 
 const SettingsPage: React.FC = () => {
     const {theme, toggleTheme, setTheme} = useTheme();
-    const {user, update, changePassword, logout} = useAuth();
+    const {user, update, setBaseCurrency, changePassword, logout} = useAuth();
 
     const [name, setName] = useState(user?.name || '');
     const [email, setEmail] = useState(user?.email || '');
@@ -19,7 +19,7 @@ const SettingsPage: React.FC = () => {
     const [newPassword, setNewPassword] = useState('');
     const [confirmPassword, setConfirmPassword] = useState('');
 
-    const [currency, setCurrency] = useState('USD');
+    const [currency, setCurrency] = useState(user?.base_currency || 'RUB');
     const [emailNotifications, setEmailNotifications] = useState(true);
     const [pushNotifications, setPushNotifications] = useState(false);
 
@@ -62,9 +62,15 @@ const SettingsPage: React.FC = () => {
         }
     };
 
-    const handlePreferencesSave = (e: React.FormEvent) => {
+    const handlePreferencesSave = async (e: React.FormEvent) => {
         e.preventDefault();
-        showFeedback('success', 'Preferences saved!');
+        try {
+            // Базовая валюта хранится на сервере: в ней считается статистика
+            await setBaseCurrency(currency);
+            showFeedback('success', 'Preferences saved!');
+        } catch (error: any) {
+            showFeedback('error', error.message || 'Failed to save preferences.');
+        }
     };
 
     const handleNotificationSave = (e: React.FormEvent) => {
@@ -181,7 +187,7 @@ const SettingsPage: React.FC = () => {
                             <div>
                                 <label className="label-text mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300" htmlFor="currency">Currency</label>
                                 <select id="currency" className="input w-full" value={currency} onChange={(e) => setCurrency(e.target.value)}>
-                                    {['USD', 'EUR', 'GBP', 'JPY', 'CAD', 'AUD'].map(c => <option key={c} value={c}>{c}</option>)}
+                                    {['RUB', 'USD', 'EUR', 'GBP', 'JPY', 'CAD', 'AUD'].map(c => <option key={c} value={c}>{c}</option>)}
                                 </select>
                             </div>
                             <div className="flex justify-end pt-2">
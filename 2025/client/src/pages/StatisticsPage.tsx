@@ -3,7 +3,7 @@ import {motion, Variants} from 'framer-motion';
 import Button from '../components/common/Button';
 import StatCard from '../components/statistics/StatCard';
 import ChartContainer from '../components/statistics/ChartContainer';
-import type {TimeFrame} from '../types';
+import type {StatisticsInterval, TimeFrame} from '../types';
 import {
     Wallet,
     TrendingUp,
@@ -14,15 +14,14 @@ import {
     PieChartIcon
 } from 'lucide-react';
 import {format, endOfMonth, endOfYear, differenceInDays, subDays, startOfMonth, startOfYear} from 'date-fns';
-import {useGetTransactions} from "../components/transactions/functions";
+import {useGetStatistics} from "../components/statistics/functions";
 import {useQueryClient} from "@tanstack/react-query";
 
 const StatisticsPage: React.FC = () => {
-    const { data: transactions} = useGetTransactions();
     const queryClient = useQueryClient()
     useEffect(() => {
-        queryClient.invalidateQueries({queryKey: ["transactions"]}).then(r => {})
-    });
+        queryClient.invalidateQueries({queryKey: ["statistics"]}).then(r => {})
+    }, [queryClient]);
 
     const [timeframe, setTimeframe] = useState<TimeFrame>('month');
     const [customRange, setCustomRange] = useState<{ start: Date | null, end: Date | null }>({start: null, end: null});
@@ -43,46 +42,34 @@ const StatisticsPage: React.FC = () => {
         }
     }, [timeframe, customRange]);
 
-    const filteredTransactions = transactions.filter(t => {
-        const tDate = new Date(t.date);
-        return tDate >= startDate && tDate <= endDate;
-    });
+    const interval: StatisticsInterval = timeframe === 'year' ? 'month' : 'day';
+    const {data: stats} = useGetStatistics(startDate, endDate, interval);
 
-    const totalIncome = filteredTransactions.filter(t => t.type).reduce((sum, t) => sum + t.amount, 0);
-    const totalExpenses = filteredTransactions.filter(t => !t.type).reduce((sum, t) => sum + t.amount, 0);
-    const netFlow = totalIncome - totalExpenses;
+    const totalIncome = stats?.totals.income ?? 0;
+    const totalExpenses = stats?.totals.expense ?? 0;
+    const netFlow = stats?.totals.net ?? 0;
 
     const expensesByCategory = useMemo(() => {
-        const map = filteredTransactions
-            .filter(t => !t.type)
-            .reduce((acc, t) => {
-                acc[t.category] = (acc[t.category] || 0) + t.amount;
-                return acc;
-            }, {} as Record<string, number>);
-        return Object.entries(map)
-            .map(([name, value], index) => ({
-                name,
-                value,
+        return (stats?.categories ?? [])
+            .filter(c => c.type === 'expense')
+            .slice(0, 6) // Top 6, сервер уже отсортировал по убыванию суммы
+            .map((c, index) => ({
+                name: c.category,
+                value: c.total,
                 color: ['#ff7d00', '#00b8a9', '#6b5ca5', '#f24c4c', '#5d62b5', '#ffc107'][index % 6]
-            }))
-            .sort((a, b) => b.value - a.value).slice(0, 6); // Top 6
-    }, [filteredTransactions]);
+            }));
+    }, [stats]);
 
     const incomeBySource = useMemo(() => {
-        const map = filteredTransactions
-            .filter(t => t.type)
-            .reduce((acc, t) => {
-                acc[t.category] = (acc[t.category] || 0) + t.amount;
-                return acc;
-            }, {} as Record<string, number>);
-        return Object.entries(map)
-            .map(([name, value], index) => ({
-                name,
-                value,
+        return (stats?.categories ?? [])
+            .filter(c => c.type === 'income')
+            .slice(0, 6) // Top 6
+            .map((c, index) => ({
+                name: c.category,
+                value: c.total,
                 color: ['#20c997', '#3498db', '#9b59b6', '#e74c3c', '#f1c40f', '#1abc9c'][index % 6]
-            }))
-            .sort((a, b) => b.value - a.value).slice(0, 6); // Top 6
-    }, [filteredTransactions]);
+            }));
+    }, [stats]);
 
     const trendData = useMemo(() => { // Mock trend data
         return {
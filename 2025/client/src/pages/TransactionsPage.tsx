@@ -26,7 +26,7 @@ const TransactionsPage: React.FC = () => {
 
     const handleFormSubmit = (transactionData: NewTransactionData) => {
         if (editingTransaction) {
-            updateTransaction.mutate({...transactionData, id: editingTransaction.id}, {
+            updateTransaction.mutate({...transactionData, id: editingTransaction.id, version: editingTransaction.version}, {
                 onSuccess: () => {
                     setEditingTransaction(null);
                     setShowForm(false);
@@ -5,6 +5,7 @@ export type User = {
   email: string;
   avatar?: string;
   provider?: string;
+  base_currency?: string; // Валюта статистики ISO 4217, по умолчанию RUB
 };
 
 export type AuthState = {
@@ -18,13 +19,21 @@ export type Transaction = {
   type: boolean; // true for income, false for expense
   category: string;
   amount: number;
+  currency?: string; // Код валюты ISO 4217; по умолчанию валюта счёта или базовая валюта
   // Date from backend is typically a full ISO string (e.g., "2023-10-26T10:00:00Z").
   // For forms or NewTransactionData, it's often handled as "YYYY-MM-DD".
   date: string; 
   description: string;
+  version?: number; // Версия транзакции; отправляется в If-Match при изменении и удалении
   // userId?: string; // Optional: if transactions are user-specific and API requires it in payload
 };
 
+// Страница списка транзакций от GET /api/transactions
+export type TransactionPage = {
+  transactions: Transaction[];
+  next_cursor: string; // Пустая строка, если страниц больше нет
+};
+
 // Represents data for creating a new transaction, date as YYYY-MM-DD from form
 export type NewTransactionData = Omit<Transaction, 'id'>;
 
@@ -44,3 +53,16 @@ export type ChartData = {
 };
 
 export type TimeFrame = 'week' | 'month' | 'year' | 'custom';
+
+export type StatisticsInterval = 'day' | 'week' | 'month' | 'year';
+
+// Ответ GET /api/statistics
+export type Statistics = {
+  interval: StatisticsInterval;
+  timezone: string;
+  currency: string; // Валюта, в которую пересчитаны все суммы
+  totals: { income: number; expense: number; net: number; count: number };
+  categories: { category: string; type: 'income' | 'expense'; total: number; count: number }[];
+  series: { period: string; income: number; expense: number; net: number }[];
+  missing_rates: { currency: string; count: number }[]; // Операции без курса не входят в суммы
+};
@@ -0,0 +1,404 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"strings"
+	"time"
+)
+
+// accountTypes — допустимые типы счетов.
+var accountTypes = map[string]bool{
+	models.AccountCash:       true,
+	models.AccountDebitCard:  true,
+	models.AccountCreditCard: true,
+	models.AccountSavings:    true,
+	models.AccountLoan:       true,
+}
+
+// AccountBalance — счёт вместе с вычисленным балансом.
+type AccountBalance struct {
+	models.Account
+	Balance money.Amount       `json:"balance"`
+	AsOf    primitive.DateTime `json:"as_of"` // Момент, на который посчитан баланс
+}
+
+// parseAsOf разбирает параметр date: баланс считается на конец указанного дня
+// в часовом поясе tz. Без параметра — на текущий момент.
+func parseAsOf(c *fiber.Ctx) (time.Time, error) {
+	date := c.Query("date")
+	if date == "" {
+		return time.Now(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return time.Time{}, errors.New("Неизвестный часовой пояс в параметре 'tz'")
+		}
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, errors.New("Неверный формат параметра 'date'. Используйте YYYY-MM-DD или ISO 8601")
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Millisecond), nil
+}
+
+// withBalances дополняет счета балансами на момент asOf.
+func withBalances(ctx context.Context, userID primitive.ObjectID, list []models.Account, asOf time.Time) ([]AccountBalance, error) {
+	ids := make([]primitive.ObjectID, 0, len(list))
+	for _, account := range list {
+		ids = append(ids, account.ID)
+	}
+
+	totals, err := Balances(ctx, userID, ids, &asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AccountBalance, 0, len(list))
+	for _, account := range list {
+		result = append(result, AccountBalance{
+			Account: account,
+			Balance: account.OpeningBalance.Add(totals[account.ID]),
+			AsOf:    primitive.NewDateTimeFromTime(asOf),
+		})
+	}
+	return result, nil
+}
+
+// GetAccounts godoc
+// @Summary Получить счета пользователя с балансами
+// @Tags accounts
+// @Security ApiKeyAuth
+// @Produce json
+// @Param date query string false "Дата, на конец которой считается баланс (YYYY-MM-DD или ISO 8601); по умолчанию — текущий момент"
+// @Param tz query string false "Часовой пояс IANA для параметра date (по умолчанию UTC)"
+// @Success 200 {array} AccountBalance
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/accounts [get]
+func GetAccounts(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cursor, err := database.AccountsCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске счетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить счета"})
+	}
+
+	var list []models.Account
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования счетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования счетов"})
+	}
+
+	result, err := withBalances(context.Background(), userID, list, asOf)
+	if err != nil {
+		log.Printf("Ошибка расчёта балансов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать балансы"})
+	}
+
+	return c.JSON(result)
+}
+
+// GetAccount godoc
+// @Summary Получить счёт с балансом
+// @Tags accounts
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID счёта"
+// @Param date query string false "Дата, на конец которой считается баланс (YYYY-MM-DD или ISO 8601); по умолчанию — текущий момент"
+// @Param tz query string false "Часовой пояс IANA для параметра date (по умолчанию UTC)"
+// @Success 200 {object} AccountBalance
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/accounts/{id} [get]
+func GetAccount(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var account models.Account
+	if err := database.AccountsCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&account); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Счёт не найден"})
+	}
+
+	result, err := withBalances(context.Background(), userID, []models.Account{account}, asOf)
+	if err != nil {
+		log.Printf("Ошибка расчёта баланса: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать баланс"})
+	}
+
+	return c.JSON(result[0])
+}
+
+// PostAccount godoc
+// @Summary Создать счёт
+// @Tags accounts
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param account body models.Account true "Данные счёта"
+// @Success 201 {object} models.Account
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/accounts [post]
+func PostAccount(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	account := new(models.Account)
+	if err := c.BodyParser(account); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'name' обязательно"})
+	}
+	if !accountTypes[account.Type] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'type' должно быть одним из: cash, debit_card, credit_card, savings, loan"})
+	}
+	if account.Currency == "" {
+		account.Currency = money.DefaultCurrency
+	}
+	account.Currency = strings.ToUpper(account.Currency)
+	if !money.ValidCurrency(account.Currency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'currency' должно быть кодом валюты ISO 4217, например RUB"})
+	}
+
+	account.OpeningBalance = account.OpeningBalance.Round(account.Currency)
+	account.ID = primitive.NilObjectID
+	account.UserID = userID
+	account.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	insertRes, err := database.AccountsCollection.InsertOne(context.Background(), account)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Счёт с таким названием уже существует"})
+	}
+	if err != nil {
+		log.Printf("Ошибка вставки счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать счёт"})
+	}
+
+	account.ID = insertRes.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
+// UpdateAccount godoc
+// @Summary Обновить счёт
+// @Tags accounts
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID счёта"
+// @Param update body map[string]interface{} true "Поля: name, type, currency, opening_balance"
+// @Success 200 {object} models.Account
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/accounts/{id} [patch]
+func UpdateAccount(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var data map[string]interface{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+
+	updates := bson.M{}
+	if value, ok := data["name"]; ok {
+		name, _ := value.(string)
+		if name = strings.TrimSpace(name); name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'name' должно быть непустой строкой"})
+		}
+		updates["name"] = name
+	}
+	if value, ok := data["type"]; ok {
+		accountType, _ := value.(string)
+		if !accountTypes[accountType] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'type' должно быть одним из: cash, debit_card, credit_card, savings, loan"})
+		}
+		updates["type"] = accountType
+	}
+	if value, ok := data["currency"]; ok {
+		currency, _ := value.(string)
+		currency = strings.ToUpper(currency)
+		if !money.ValidCurrency(currency) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'currency' должно быть кодом валюты ISO 4217, например RUB"})
+		}
+		// Суммы транзакций хранятся в валюте счёта: сменить валюту можно, только если нет операций в другой валюте
+		used, err := database.TransactionsCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "account_id": objectID, "currency": bson.M{"$ne": currency}}, options.Count().SetLimit(1))
+		if err != nil {
+			log.Printf("Ошибка проверки транзакций счёта: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить счёт"})
+		}
+		if used == 0 {
+			used, err = database.RecurringCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "account_id": objectID, "currency": bson.M{"$ne": currency}}, options.Count().SetLimit(1))
+			if err != nil {
+				log.Printf("Ошибка проверки повторяющихся операций счёта: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить счёт"})
+			}
+		}
+		if used > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Нельзя сменить валюту счёта, к которому привязаны операции в другой валюте"})
+		}
+		updates["currency"] = currency
+	}
+	if value, ok := data["opening_balance"]; ok {
+		balance, err := money.FromValue(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'opening_balance' должно быть числом"})
+		}
+		// Округляем по валюте счёта: новой, если она меняется, иначе текущей
+		currency, _ := updates["currency"].(string)
+		if currency == "" {
+			var existing models.Account
+			if err := database.AccountsCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&existing); err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Счёт не найден"})
+			}
+			currency = existing.Currency
+		}
+		updates["opening_balance"] = balance.Round(currency)
+	}
+	if len(updates) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нет полей для обновления"})
+	}
+
+	var updated models.Account
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = database.AccountsCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": objectID, "user_id": userID}, bson.M{"$set": updates}, after).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Счёт не найден"})
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Счёт с таким названием уже существует"})
+	}
+	if err != nil {
+		log.Printf("Ошибка обновления счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить счёт"})
+	}
+
+	return c.JSON(updated)
+}
+
+// DeleteAccount godoc
+// @Summary Удалить счёт
+// @Description Счёт, к которому привязаны транзакции, повторяющиеся операции или правила, удалить нельзя.
+// @Tags accounts
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID счёта"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/accounts/{id} [delete]
+func DeleteAccount(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	used, err := database.TransactionsCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "account_id": objectID})
+	if err != nil {
+		log.Printf("Ошибка подсчёта транзакций счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить счёт"})
+	}
+	if used > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "К счёту привязаны транзакции. Перенесите их на другой счёт", "transactions": used})
+	}
+
+	recurring, err := database.RecurringCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "account_id": objectID})
+	if err != nil {
+		log.Printf("Ошибка подсчёта повторяющихся операций счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить счёт"})
+	}
+	if recurring > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "К счёту привязаны повторяющиеся операции. Перенесите их на другой счёт", "recurring": recurring})
+	}
+
+	rules, err := database.RulesCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "set.account_id": objectID})
+	if err != nil {
+		log.Printf("Ошибка подсчёта правил счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить счёт"})
+	}
+	if rules > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Счёт устанавливают правила категоризации. Измените их", "rules": rules})
+	}
+
+	result, err := database.AccountsCollection.DeleteOne(context.Background(), bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Printf("Ошибка удаления счёта: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить счёт"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Счёт не найден"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Счёт успешно удалён"})
+}
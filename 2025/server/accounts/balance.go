@@ -0,0 +1,67 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// Balances возвращает оборот по счетам: сумму доходов минус сумму расходов
+// по транзакциям каждого счёта в валюте счёта. Если asOf задан, учитываются только транзакции
+// с датой не позже asOf. Начальный остаток счёта сюда не входит.
+func Balances(ctx context.Context, userID primitive.ObjectID, accountIDs []primitive.ObjectID, asOf *time.Time) (map[primitive.ObjectID]money.Amount, error) {
+	match := bson.M{"user_id": userID, "account_id": bson.M{"$in": accountIDs}}
+	if asOf != nil {
+		match["date"] = bson.M{"$lte": primitive.NewDateTimeFromTime(*asOf)}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id": "$account_id",
+			"total": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", true}},
+				"$amount",
+				bson.M{"$subtract": bson.A{0, "$amount"}},
+			}}},
+		}},
+	}
+
+	cursor, err := database.TransactionsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Total money.Amount       `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	balances := make(map[primitive.ObjectID]money.Amount, len(rows))
+	for _, row := range rows {
+		balances[row.ID] = row.Total
+	}
+	return balances, nil
+}
+
+// Find возвращает счёт пользователя или nil, если такого счёта нет.
+func Find(ctx context.Context, userID primitive.ObjectID, accountID primitive.ObjectID) (*models.Account, error) {
+	var account models.Account
+	err := database.AccountsCollection.FindOne(ctx, bson.M{"_id": accountID, "user_id": userID}).Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
@@ -0,0 +1,303 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"time"
+)
+
+// ownTransaction проверяет, что транзакция существует и принадлежит пользователю.
+func ownTransaction(ctx context.Context, userID primitive.ObjectID, transactionID primitive.ObjectID) error {
+	err := database.TransactionsCollection.FindOne(ctx, bson.M{"_id": transactionID, "user_id": userID},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusNotFound, "Транзакция не найдена")
+	}
+	return err
+}
+
+// save проверяет загруженный файл на ограничения и сохраняет его в хранилище, а описание — в коллекцию attachments.
+func save(ctx context.Context, userID primitive.ObjectID, transactionID primitive.ObjectID, header *multipart.FileHeader) (models.Attachment, error) {
+	if header.Size == 0 {
+		return models.Attachment{}, fiber.NewError(fiber.StatusBadRequest, "Файл пустой")
+	}
+	if header.Size > MaxSize {
+		return models.Attachment{}, fiber.NewError(fiber.StatusRequestEntityTooLarge, "Файл больше 10 МБ")
+	}
+
+	count, err := database.AttachmentsCollection.CountDocuments(ctx, bson.M{"user_id": userID, "transaction_id": transactionID})
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if count >= MaxPerTransaction {
+		return models.Attachment{}, fiber.NewError(fiber.StatusConflict, "У транзакции не может быть больше "+strconv.Itoa(MaxPerTransaction)+" вложений")
+	}
+	used, err := Usage(ctx, userID)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if used+header.Size > UserQuota {
+		return models.Attachment{}, fiber.NewError(fiber.StatusRequestEntityTooLarge, "Превышен объём хранилища вложений (200 МБ). Удалите ненужные файлы")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return models.Attachment{}, err
+	}
+	head = head[:n]
+	contentType := detectType(head)
+	if !allowedTypes[contentType] {
+		return models.Attachment{}, fiber.NewError(fiber.StatusUnsupportedMediaType, "Можно прикладывать только JPEG, PNG, WebP, HEIC и PDF")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return models.Attachment{}, err
+	}
+
+	attachment := models.Attachment{
+		ID:            primitive.NewObjectID(),
+		UserID:        userID,
+		TransactionID: transactionID,
+		FileName:      cleanFileName(header.Filename),
+		ContentType:   contentType,
+		Size:          header.Size,
+		CreatedAt:     primitive.NewDateTimeFromTime(time.Now()),
+	}
+	attachment.Key = userID.Hex() + "/" + attachment.ID.Hex()
+
+	if err := Store.Put(ctx, attachment.Key, file); err != nil {
+		return models.Attachment{}, err
+	}
+	if _, err := database.AttachmentsCollection.InsertOne(ctx, attachment); err != nil {
+		if err := Store.Delete(ctx, attachment.Key); err != nil {
+			log.Printf("Ошибка удаления файла вложения %s из хранилища %s: %v\n", attachment.Key, Store.Name(), err)
+		}
+		return models.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// PostAttachment godoc
+// @Summary Приложить файл к транзакции
+// @Description Принимает multipart/form-data с файлом в поле file: фото чека (JPEG, PNG, WebP, HEIC) или PDF.
+// @Description Тип определяется по содержимому файла. Размер файла — до 10 МБ, у транзакции — до 10 вложений,
+// @Description суммарный объём вложений пользователя — до 200 МБ.
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Param file formData file true "Файл"
+// @Success 201 {object} models.Attachment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "У транзакции уже 10 вложений"
+// @Failure 413 {object} map[string]string "Файл слишком большой или превышена квота"
+// @Failure 415 {object} map[string]string "Неподдерживаемый тип файла"
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/{id}/attachments [post]
+func PostAttachment(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	transactionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Загрузите файл в поле 'file'"})
+	}
+	if err := ownTransaction(context.Background(), userID, transactionID); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось найти транзакцию")
+	}
+
+	attachment, err := save(context.Background(), userID, transactionID, header)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось сохранить вложение")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(attachment)
+}
+
+// GetAttachments godoc
+// @Summary Получить вложения транзакции
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Success 200 {array} models.Attachment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/{id}/attachments [get]
+func GetAttachments(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	transactionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+	if err := ownTransaction(context.Background(), userID, transactionID); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось найти транзакцию")
+	}
+
+	cursor, err := database.AttachmentsCollection.Find(context.Background(),
+		bson.M{"user_id": userID, "transaction_id": transactionID},
+		options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске вложений: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить вложения"})
+	}
+
+	list := []models.Attachment{}
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования вложений: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования вложений"})
+	}
+
+	return c.JSON(list)
+}
+
+// GetQuota godoc
+// @Summary Получить использование хранилища вложений
+// @Description Возвращает занятый объём (used) и квоту (limit) в байтах.
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/attachments/quota [get]
+func GetQuota(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	used, err := Usage(context.Background(), userID)
+	if err != nil {
+		log.Printf("Ошибка подсчёта объёма вложений: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить объём вложений"})
+	}
+
+	return c.JSON(fiber.Map{"used": used, "limit": UserQuota})
+}
+
+// DownloadAttachment godoc
+// @Summary Скачать вложение
+// @Description Отдаёт содержимое файла с исходным типом; браузер показывает фото и PDF на странице.
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Produce octet-stream
+// @Param id path string true "ID вложения"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/attachments/{id} [get]
+func DownloadAttachment(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var attachment models.Attachment
+	err = database.AttachmentsCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&attachment)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Вложение не найдено"})
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске вложения: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить вложение"})
+	}
+
+	content, err := Store.Open(context.Background(), attachment.Key)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("Файл вложения %s отсутствует в хранилище %s\n", attachment.Key, Store.Name())
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Файл вложения не найден"})
+	}
+	if err != nil {
+		log.Printf("Ошибка открытия файла вложения: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить вложение"})
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	// Поток закрывает сам fasthttp после отправки ответа
+	return c.SendStream(content, int(attachment.Size))
+}
+
+// DeleteAttachment godoc
+// @Summary Удалить вложение
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID вложения"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/attachments/{id} [delete]
+func DeleteAttachment(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var attachment models.Attachment
+	err = database.AttachmentsCollection.FindOneAndDelete(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&attachment)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Вложение не найдено"})
+	}
+	if err != nil {
+		log.Printf("Ошибка удаления вложения: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить вложение"})
+	}
+	if err := Store.Delete(context.Background(), attachment.Key); err != nil {
+		log.Printf("Ошибка удаления файла вложения %s из хранилища %s: %v\n", attachment.Key, Store.Name(), err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Вложение успешно удалено"})
+}
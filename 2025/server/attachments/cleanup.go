@@ -0,0 +1,47 @@
+package attachments
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+)
+
+// Remove удаляет вложения удалённых транзакций: сначала описания, затем содержимое в хранилище.
+// Содержимое, которое не удалось удалить, только занимает место, поэтому такие ошибки лишь логируются.
+func Remove(ctx context.Context, userID primitive.ObjectID, transactionIDs []primitive.ObjectID) error {
+	if len(transactionIDs) == 0 {
+		return nil
+	}
+	filter := bson.M{"user_id": userID, "transaction_id": bson.M{"$in": transactionIDs}}
+	cursor, err := database.AttachmentsCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var list []models.Attachment
+	if err := cursor.All(ctx, &list); err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if _, err := database.AttachmentsCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	for _, a := range list {
+		if err := Store.Delete(ctx, a.Key); err != nil {
+			log.Printf("Ошибка удаления файла вложения %s из хранилища %s: %v\n", a.Key, Store.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Move переносит вложения транзакций from к транзакции to, например при слиянии дублей.
+func Move(ctx context.Context, userID primitive.ObjectID, from []primitive.ObjectID, to primitive.ObjectID) error {
+	_, err := database.AttachmentsCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "transaction_id": bson.M{"$in": from}},
+		bson.M{"$set": bson.M{"transaction_id": to}})
+	return err
+}
@@ -0,0 +1,66 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+)
+
+// GridFSStore хранит вложения в GridFS той же базы MongoDB: ключ служит идентификатором файла.
+type GridFSStore struct {
+	Bucket *gridfs.Bucket
+}
+
+// NewGridFSStore создаёт хранилище в бакете attachments базы db (коллекции attachments.files и attachments.chunks).
+func NewGridFSStore(db *mongo.Database) (*GridFSStore, error) {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName("attachments"))
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSStore{Bucket: bucket}, nil
+}
+
+// Name возвращает имя хранилища для логов.
+func (s *GridFSStore) Name() string {
+	return "gridfs"
+}
+
+// Put загружает содержимое в GridFS. UploadFromStream не подходит: он читает через общий буфер бакета,
+// а загрузки идут параллельно.
+func (s *GridFSStore) Put(ctx context.Context, key string, content io.Reader) error {
+	if err := s.Delete(ctx, key); err != nil {
+		return err
+	}
+	stream, err := s.Bucket.OpenUploadStreamWithID(key, key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(stream, content); err != nil {
+		stream.Abort()
+		return err
+	}
+	return stream.Close()
+}
+
+// Open открывает файл GridFS для чтения.
+func (s *GridFSStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	stream, err := s.Bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Delete удаляет файл GridFS вместе с его частями.
+func (s *GridFSStore) Delete(ctx context.Context, key string) error {
+	if err := s.Bucket.DeleteContext(ctx, key); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
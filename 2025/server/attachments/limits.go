@@ -0,0 +1,95 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxSize — максимальный размер одного вложения.
+	MaxSize = 10 << 20
+	// MaxPerTransaction — максимальное число вложений у одной транзакции.
+	MaxPerTransaction = 10
+	// UserQuota — суммарный объём вложений одного пользователя.
+	UserQuota = 200 << 20
+	// maxFileNameLength — ограничение длины имени файла в символах.
+	maxFileNameLength = 255
+)
+
+// allowedTypes — MIME-типы, которые можно приложить: фото чеков и PDF-документы.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"application/pdf": true,
+}
+
+// heicBrands — бренды контейнера ISO BMFF, которыми помечаются фото HEIC/HEIF с телефонов.
+var heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// detectType определяет MIME-тип по первым байтам содержимого: заголовку Content-Type от клиента не доверяем.
+// http.DetectContentType не знает HEIC, поэтому его бренд проверяется отдельно.
+func detectType(head []byte) string {
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		brand := string(head[8:12])
+		for _, b := range heicBrands {
+			if brand == b {
+				return "image/heic"
+			}
+		}
+	}
+	contentType := http.DetectContentType(head)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// cleanFileName оставляет от имени загруженного файла только имя без пути и управляющих символов.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = string(runes[:maxFileNameLength])
+	}
+	return name
+}
+
+// Usage возвращает суммарный размер вложений пользователя в байтах.
+func Usage(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	cursor, err := database.AttachmentsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "size": bson.M{"$sum": "$size"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result []struct {
+		Size int64 `bson:"size"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Size, nil
+}
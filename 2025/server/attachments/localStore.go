@@ -0,0 +1,86 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore хранит вложения файлами в каталоге на диске сервера: ключ «user/id» становится путём Dir/user/id.
+type LocalStore struct {
+	Dir string
+}
+
+// NewLocalStore создаёт хранилище в каталоге dir.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{Dir: dir}
+}
+
+// Name возвращает имя хранилища для логов.
+func (s *LocalStore) Name() string {
+	return "local:" + s.Dir
+}
+
+// path возвращает путь файла для ключа. Ключи создаёт сервер, но выход за пределы каталога всё равно запрещён.
+func (s *LocalStore) path(key string) (string, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(s.Dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("некорректный ключ вложения %q", key)
+	}
+	return path, nil
+}
+
+// Put записывает содержимое во временный файл и переименовывает его: недописанный файл не виден под ключом.
+func (s *LocalStore) Put(ctx context.Context, key string, content io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // После переименования файла уже нет, ошибка не важна
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open открывает файл вложения.
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete удаляет файл вложения.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound возвращается хранилищем, если содержимого с таким ключом нет.
+var ErrNotFound = errors.New("файл не найден в хранилище")
+
+// BlobStore — хранилище содержимого вложений. Реализации могут писать на локальный диск,
+// в GridFS, в S3 и т.п.; описание вложения хранится отдельно, в коллекции attachments.
+type BlobStore interface {
+	// Name возвращает имя хранилища для логов.
+	Name() string
+	// Put сохраняет содержимое под ключом key; существующее содержимое заменяется.
+	Put(ctx context.Context, key string, content io.Reader) error
+	// Open открывает содержимое для чтения; без содержимого — ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет содержимое; отсутствие содержимого ошибкой не считается.
+	Delete(ctx context.Context, key string) error
+}
+
+// Store — хранилище, в которое пишутся новые вложения. Задаётся при запуске сервера.
+var Store BlobStore
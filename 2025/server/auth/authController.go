@@ -2,15 +2,18 @@ package auth
 
 import (
 	"context"
+	"github.com/IIkar/WealFlow/2025/categories"
 	"github.com/IIkar/WealFlow/2025/database"
 	"github.com/IIkar/WealFlow/2025/middleware"
 	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -58,6 +61,10 @@ func Register(c *fiber.Ctx) error {
 
 	user.ID = res.InsertedID.(primitive.ObjectID)
 
+	if err := categories.SeedDefaults(context.Background(), user.ID); err != nil {
+		log.Printf("Ошибка создания категорий по умолчанию: %v\n", err)
+	}
+
 	accessToken, _ := middleware.CreateToken(user.ID, os.Getenv("ACCESS_SECRET"))
 	refreshToken, _ := middleware.CreateToken(user.ID, os.Getenv("REFRESH_SECRET"))
 
@@ -168,8 +175,10 @@ func Logout(c *fiber.Ctx) error {
 }
 
 // PatchUser godoc
-// @Summary Обновление email или имени
+// @Summary Обновление email, имени или базовой валюты
 // @Tags auth
+// @Accept json
+// @Param user body map[string]string true "Поля: name, email, base_currency"
 // @Produce json
 // @Success 200 {object} map[string]bool
 // @Router /api/auth/update [post]
@@ -192,6 +201,15 @@ func PatchUser(c *fiber.Ctx) error {
 	delete(data, "_id")
 	delete(data, "password")
 
+	// Базовая валюта используется для пересчёта статистики
+	if currency, ok := data["base_currency"]; ok {
+		currency = strings.ToUpper(currency)
+		if !money.ValidCurrency(currency) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'base_currency' должно быть кодом валюты ISO 4217, например RUB"})
+		}
+		data["base_currency"] = currency
+	}
+
 	filter := bson.M{"_id": userID}
 	update := bson.M{"$set": data}
 
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BaseCurrency возвращает базовую валюту пользователя, в которой считается статистика.
+// Пользователи, не выбравшие валюту, получают money.DefaultCurrency.
+func BaseCurrency(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	var user models.User
+	projection := options.FindOne().SetProjection(bson.M{"base_currency": 1})
+	if err := database.UsersCollection.FindOne(ctx, bson.M{"_id": userID}, projection).Decode(&user); err != nil {
+		return "", err
+	}
+	if user.BaseCurrency == "" {
+		return money.DefaultCurrency, nil
+	}
+	return user.BaseCurrency, nil
+}
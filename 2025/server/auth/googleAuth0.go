@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"fmt"
+	"github.com/IIkar/WealFlow/2025/categories"
 	"github.com/IIkar/WealFlow/2025/database"
 	"github.com/IIkar/WealFlow/2025/middleware"
 	"github.com/IIkar/WealFlow/2025/models"
@@ -126,6 +127,9 @@ func findOrCreateUser(claims jwt.MapClaims) (models.User, string, error) {
 		fmt.Println("findOrCreateUser: ошибка создания пользователя:", err)
 		return models.User{}, "Ошибка входа", fiber.NewError(fiber.StatusInternalServerError, "Ошибка создания пользователя")
 	}
+	if err := categories.SeedDefaults(context.Background(), res.InsertedID.(primitive.ObjectID)); err != nil {
+		fmt.Println("findOrCreateUser: ошибка создания категорий по умолчанию:", err)
+	}
 	err = database.UsersCollection.FindOne(context.Background(), filter).Decode(&user)
 	if err == nil {
 		fmt.Printf("findOrCreateUser: пользователь найден: %+v\n", user)
@@ -0,0 +1,252 @@
+package budgets
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/auth"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"strings"
+	"time"
+)
+
+// periods — допустимые периоды бюджета.
+var periods = map[string]bool{
+	models.BudgetWeekly:    true,
+	models.BudgetMonthly:   true,
+	models.BudgetQuarterly: true,
+	models.BudgetCustom:    true,
+}
+
+// validate проверяет и нормализует бюджет перед сохранением.
+// Ошибки валидации возвращаются как *fiber.Error со статусом 400.
+func validate(ctx context.Context, budget *models.Budget) error {
+	if !periods[budget.Period] {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'period' должно быть одним из: weekly, monthly, quarterly, custom")
+	}
+
+	if budget.Currency == "" {
+		currency, err := auth.BaseCurrency(ctx, budget.UserID)
+		if err != nil {
+			return err
+		}
+		budget.Currency = currency
+	}
+	budget.Currency = strings.ToUpper(budget.Currency)
+	if !money.ValidCurrency(budget.Currency) {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'currency' должно быть кодом валюты ISO 4217, например RUB")
+	}
+	budget.Amount = budget.Amount.Round(budget.Currency)
+	if !budget.Amount.IsPositive() {
+		return fiber.NewError(fiber.StatusBadRequest, "Лимит бюджета 'amount' должен быть положительным")
+	}
+
+	if budget.StartDate == "" {
+		budget.StartDate = time.Now().Format(dateLayout)
+	}
+	start, err := time.Parse(dateLayout, budget.StartDate)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'start_date' должно быть датой YYYY-MM-DD")
+	}
+	if budget.Period == models.BudgetCustom {
+		end, err := time.Parse(dateLayout, budget.EndDate)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Для периода custom поле 'end_date' обязательно и должно быть датой YYYY-MM-DD")
+		}
+		if end.Before(start) {
+			return fiber.NewError(fiber.StatusBadRequest, "Поле 'end_date' не может быть раньше 'start_date'")
+		}
+		// Разовому периоду переносить остаток некуда
+		budget.Rollover = false
+	} else {
+		budget.EndDate = ""
+	}
+
+	// Пустой category_id означает бюджет на все расходы
+	if budget.CategoryID != nil && budget.CategoryID.IsZero() {
+		budget.CategoryID = nil
+	}
+	if budget.CategoryID != nil {
+		tree, err := categories.LoadTree(ctx, budget.UserID)
+		if err != nil {
+			return err
+		}
+		if _, ok := tree.Name(*budget.CategoryID); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Категория не найдена")
+		}
+	}
+	return nil
+}
+
+// GetBudgets godoc
+// @Summary Получить бюджеты пользователя
+// @Tags budgets
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.Budget
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/budgets [get]
+func GetBudgets(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	cursor, err := database.BudgetsCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске бюджетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить бюджеты"})
+	}
+
+	list := []models.Budget{}
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования бюджетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования бюджетов"})
+	}
+
+	return c.JSON(list)
+}
+
+// PostBudget godoc
+// @Summary Создать бюджет
+// @Description Лимит расходов категории (вместе с подкатегориями) на неделю, месяц, квартал или произвольный диапазон дат.
+// @Tags budgets
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param budget body models.Budget true "Данные бюджета"
+// @Success 201 {object} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/budgets [post]
+func PostBudget(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	budget := new(models.Budget)
+	if err := c.BodyParser(budget); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	budget.ID = primitive.NilObjectID
+	budget.UserID = userID
+	budget.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := validate(context.Background(), budget); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось создать бюджет")
+	}
+
+	insertRes, err := database.BudgetsCollection.InsertOne(context.Background(), budget)
+	if err != nil {
+		log.Printf("Ошибка вставки бюджета: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать бюджет"})
+	}
+
+	budget.ID = insertRes.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(budget)
+}
+
+// UpdateBudget godoc
+// @Summary Обновить бюджет
+// @Description Переданные поля накладываются на текущий бюджет, после чего он проверяется целиком. Пустой category_id делает бюджет общим на все расходы.
+// @Tags budgets
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID бюджета"
+// @Param update body map[string]interface{} true "Поля: category_id, amount, currency, period, start_date, end_date, rollover"
+// @Success 200 {object} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/budgets/{id} [patch]
+func UpdateBudget(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	filter := bson.M{"_id": objectID, "user_id": userID}
+	var budget models.Budget
+	if err := database.BudgetsCollection.FindOne(context.Background(), filter).Decode(&budget); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Бюджет не найден"})
+	}
+
+	// JSON накладывается поверх сохранённого бюджета: непереданные поля не меняются
+	if err := c.BodyParser(&budget); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+	budget.ID = objectID
+	budget.UserID = userID
+	if err := validate(context.Background(), &budget); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось обновить бюджет")
+	}
+
+	result, err := database.BudgetsCollection.ReplaceOne(context.Background(), filter, budget)
+	if err != nil {
+		log.Printf("Ошибка обновления бюджета: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить бюджет"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Бюджет не найден"})
+	}
+
+	return c.JSON(budget)
+}
+
+// DeleteBudget godoc
+// @Summary Удалить бюджет
+// @Tags budgets
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID бюджета"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/budgets/{id} [delete]
+func DeleteBudget(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	result, err := database.BudgetsCollection.DeleteOne(context.Background(), bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Printf("Ошибка удаления бюджета: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить бюджет"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Бюджет не найден"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Бюджет успешно удалён"})
+}
@@ -0,0 +1,84 @@
+package budgets
+
+import (
+	"github.com/IIkar/WealFlow/2025/models"
+	"time"
+)
+
+// dateLayout — формат дат start_date и end_date бюджета.
+const dateLayout = "2006-01-02"
+
+// truncUnits — единицы $dateTrunc для повторяющихся периодов.
+var truncUnits = map[string]string{
+	models.BudgetWeekly:    "week",
+	models.BudgetMonthly:   "month",
+	models.BudgetQuarterly: "quarter",
+}
+
+// parseDay разбирает дату YYYY-MM-DD как начало дня в часовом поясе loc.
+func parseDay(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(dateLayout, value, loc)
+}
+
+// periodStart возвращает начало повторяющегося периода, содержащего момент t.
+// Границы совпадают с $dateTrunc с startOfWeek=monday в том же часовом поясе.
+func periodStart(period string, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch period {
+	case models.BudgetWeekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case models.BudgetQuarterly:
+		return time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// nextPeriod возвращает начало периода, следующего за периодом с началом start.
+func nextPeriod(period string, start time.Time) time.Time {
+	switch period {
+	case models.BudgetWeekly:
+		return start.AddDate(0, 0, 7)
+	case models.BudgetQuarterly:
+		return start.AddDate(0, 3, 0)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// window — период бюджета [Start, End).
+type window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// windows возвращает периоды, которые нужно посчитать для бюджета на момент at:
+// текущий период и, при переносе остатка, все предыдущие начиная с start_date.
+// Последний элемент — текущий период.
+func windows(budget models.Budget, at time.Time, loc *time.Location) ([]window, error) {
+	start, err := parseDay(budget.StartDate, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if budget.Period == models.BudgetCustom {
+		end, err := parseDay(budget.EndDate, loc)
+		if err != nil {
+			return nil, err
+		}
+		return []window{{Start: start, End: end.AddDate(0, 0, 1)}}, nil
+	}
+
+	current := periodStart(budget.Period, at, loc)
+	first := periodStart(budget.Period, start, loc)
+	if !budget.Rollover || current.Before(first) {
+		first = current
+	}
+
+	var result []window
+	for p := first; !p.After(current); p = nextPeriod(budget.Period, p) {
+		result = append(result, window{Start: p, End: nextPeriod(budget.Period, p)})
+	}
+	return result, nil
+}
@@ -0,0 +1,226 @@
+package budgets
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/rates"
+	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"math"
+	"time"
+)
+
+// BudgetStatus — бюджет вместе с исполнением за текущий период.
+// Все суммы — в валюте бюджета.
+type BudgetStatus struct {
+	models.Budget
+	PeriodStart primitive.DateTime `json:"period_start"`          // Начало периода
+	PeriodEnd   primitive.DateTime `json:"period_end"`            // Конец периода (не включительно)
+	CarriedOver money.Amount       `json:"carried_over"`          // Остаток, перенесённый из прошлых периодов
+	Available   money.Amount       `json:"available"`             // Лимит с учётом переноса
+	Spent       money.Amount       `json:"spent"`                 // Потрачено за период
+	Remaining   money.Amount       `json:"remaining"`             // Осталось; отрицательное значение — перерасход
+	Percent     float64            `json:"percent"`               // Доля потраченного от доступного, %
+	Unconverted int64              `json:"unconverted,omitempty"` // Операций без курса к валюте бюджета; в spent не входят
+}
+
+// periodSpent — расходы бюджета за один период из агрегации.
+type periodSpent struct {
+	Period      primitive.DateTime `bson:"_id"`
+	Spent       money.Amount       `bson:"spent"`
+	Unconverted int64              `bson:"unconverted"`
+}
+
+// spentPipeline строит подконвейер $facet, считающий расходы бюджета по его периодам.
+func spentPipeline(budget models.Budget, names []string, span []window, loc *time.Location) bson.A {
+	match := bson.M{"date": bson.M{
+		"$gte": primitive.NewDateTimeFromTime(span[0].Start),
+		"$lt":  primitive.NewDateTimeFromTime(span[len(span)-1].End),
+	}}
+	if budget.CategoryID != nil {
+		match["category"] = bson.M{"$in": names}
+	}
+
+	// Разовый период — одна группа; повторяющиеся группируются теми же границами, что и periodStart
+	var periodExpr interface{} = primitive.NewDateTimeFromTime(span[0].Start)
+	if unit, ok := truncUnits[budget.Period]; ok {
+		periodExpr = bson.M{"$dateTrunc": bson.M{
+			"date":        "$date",
+			"unit":        unit,
+			"timezone":    loc.String(),
+			"startOfWeek": "monday",
+		}}
+	}
+
+	stages := bson.A{bson.M{"$match": match}}
+	for _, stage := range rates.ConvertStages(budget.Currency) {
+		stages = append(stages, stage)
+	}
+	return append(stages, bson.M{"$group": bson.M{
+		"_id":   periodExpr,
+		"spent": bson.M{"$sum": "$" + rates.ConvertedField},
+		"unconverted": bson.M{"$sum": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$" + rates.ConvertedField, nil}}, 1, 0,
+		}}},
+	}})
+}
+
+// Evaluate считает исполнение бюджетов на момент at одной агрегацией по транзакциям:
+// для каждого бюджета — отдельная ветка $facet. При переносе остатка неизрасходованная
+// часть каждого прошлого периода (но не перерасход) добавляется к лимиту следующего.
+func Evaluate(ctx context.Context, userID primitive.ObjectID, list []models.Budget, at time.Time, loc *time.Location) ([]BudgetStatus, error) {
+	result := make([]BudgetStatus, 0, len(list))
+	if len(list) == 0 {
+		return result, nil
+	}
+
+	tree, err := categories.LoadTree(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := bson.M{}
+	spans := make([][]window, len(list))
+	var from, to time.Time
+	for i, budget := range list {
+		span, err := windows(budget, at, loc)
+		if err != nil {
+			return nil, err
+		}
+		spans[i] = span
+		if from.IsZero() || span[0].Start.Before(from) {
+			from = span[0].Start
+		}
+		if end := span[len(span)-1].End; end.After(to) {
+			to = end
+		}
+
+		var names []string
+		if budget.CategoryID != nil {
+			if name, ok := tree.Name(*budget.CategoryID); ok {
+				names = tree.Descendants([]string{name})
+			}
+		}
+		facets[budget.ID.Hex()] = spentPipeline(budget, names, span, loc)
+	}
+
+	// Бюджет ограничивает расходы; переводы между счетами расходом не являются.
+	// Части разбивки расходуют бюджеты своих категорий
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id": userID,
+			"type":    bson.M{"$ne": true},
+			"kind":    bson.M{"$ne": models.KindTransfer},
+			"date": bson.M{
+				"$gte": primitive.NewDateTimeFromTime(from),
+				"$lt":  primitive.NewDateTimeFromTime(to),
+			},
+		}}},
+	}
+	pipeline = append(pipeline, transactions.SplitStages(nil)...)
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: facets}})
+	cursor, err := database.TransactionsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string][]periodSpent
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	for i, budget := range list {
+		spent := map[primitive.DateTime]periodSpent{}
+		if len(rows) > 0 {
+			for _, row := range rows[0][budget.ID.Hex()] {
+				spent[row.Period] = row
+			}
+		}
+
+		span := spans[i]
+		carried := money.Zero
+		for _, w := range span[:len(span)-1] {
+			left := budget.Amount.Add(carried).Sub(spent[primitive.NewDateTimeFromTime(w.Start)].Spent)
+			carried = money.Zero
+			if left.IsPositive() {
+				carried = left
+			}
+		}
+
+		current := span[len(span)-1]
+		row := spent[primitive.NewDateTimeFromTime(current.Start)]
+		status := BudgetStatus{
+			Budget:      budget,
+			PeriodStart: primitive.NewDateTimeFromTime(current.Start),
+			PeriodEnd:   primitive.NewDateTimeFromTime(current.End),
+			CarriedOver: carried,
+			Available:   budget.Amount.Add(carried),
+			Spent:       row.Spent,
+			Unconverted: row.Unconverted,
+		}
+		status.Remaining = status.Available.Sub(status.Spent)
+		if status.Available.IsPositive() {
+			status.Percent = math.Round(status.Spent.Float64()/status.Available.Float64()*1000) / 10
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// GetBudgetStatus godoc
+// @Summary Исполнение бюджетов за период
+// @Description Для каждого бюджета — период, содержащий дату date, потраченная сумма, остаток и процент использования.
+// @Description Расходы в других валютах пересчитываются в валюту бюджета по курсу на дату операции.
+// @Tags budgets
+// @Security ApiKeyAuth
+// @Produce json
+// @Param date query string false "Дата внутри нужного периода (YYYY-MM-DD или ISO 8601), по умолчанию сегодня"
+// @Param tz query string false "Часовой пояс IANA для границ периодов (по умолчанию UTC)"
+// @Success 200 {array} BudgetStatus
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/budgets/status [get]
+func GetBudgetStatus(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	loc, err := transactions.ParseLocation(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	at := time.Now()
+	if value := c.Query("date"); value != "" {
+		if at, err = transactions.ParseDate(value, loc); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат параметра 'date'. Используйте YYYY-MM-DD или ISO 8601"})
+		}
+	}
+
+	cursor, err := database.BudgetsCollection.Find(context.Background(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Ошибка при поиске бюджетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить бюджеты"})
+	}
+	var list []models.Budget
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования бюджетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования бюджетов"})
+	}
+
+	result, err := Evaluate(context.Background(), userID, list, at, loc)
+	if err != nil {
+		log.Printf("Ошибка расчёта бюджетов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать бюджеты"})
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,573 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// colorPattern — допустимый формат цвета категории.
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// errCategoryNotFound возвращается из транзакций MongoDB, когда категория не найдена.
+var errCategoryNotFound = errors.New("категория не найдена")
+
+// renameSplits переносит части разбивки транзакций пользователя из категории from в категорию to.
+func renameSplits(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID, from string, to string) error {
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "splits.category": from},
+		database.BumpVersion(bson.M{"$set": bson.M{"splits.$[part].category": to}}),
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"part.category": from}}}))
+	return err
+}
+
+// renameTransactions переносит транзакции пользователя вместе с частями разбивки из категории from в категорию to
+// и записывает изменения в историю. Возвращает число транзакций, перенесённых целиком. Вызывается внутри транзакции MongoDB.
+func renameTransactions(ctx context.Context, userID primitive.ObjectID, from string, to string) (int64, error) {
+	tracked, err := history.Track(ctx, bson.M{"user_id": userID, "$or": bson.A{
+		bson.M{"category": from},
+		bson.M{"splits.category": from},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	result, err := database.TransactionsCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "category": from},
+		database.BumpVersion(bson.M{"$set": bson.M{"category": to}}))
+	if err != nil {
+		return 0, err
+	}
+	if err := renameSplits(ctx, database.TransactionsCollection, userID, from, to); err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, tracked.Record(ctx, history.By(userID, history.SourceAPI))
+}
+
+// renameTrash переносит транзакции в корзине на новое имя категории, чтобы их можно было восстановить.
+func renameTrash(ctx context.Context, userID primitive.ObjectID, from string, to string) error {
+	_, err := database.TrashCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "category": from},
+		bson.M{"$set": bson.M{"category": to}})
+	if err != nil {
+		return err
+	}
+	return renameSplits(ctx, database.TrashCollection, userID, from, to)
+}
+
+// overrideCategories — выражение со списком категорий из изменений отдельных повторов шаблона.
+var overrideCategories = bson.M{"$map": bson.M{
+	"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$overrides", bson.M{}}}},
+	"in":    "$$this.v.category",
+}}
+
+// overridesCategory — условие на шаблоны повторяющихся операций, у которых изменение отдельного повтора ставит категорию name.
+func overridesCategory(name string) bson.M {
+	return bson.M{"$expr": bson.M{"$in": bson.A{name, overrideCategories}}}
+}
+
+// renameRecurring переносит шаблоны повторяющихся операций и изменения их отдельных повторов из категории from в категорию to.
+func renameRecurring(ctx context.Context, userID primitive.ObjectID, from string, to string) error {
+	_, err := database.RecurringCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "category": from},
+		bson.M{"$set": bson.M{"category": to}})
+	if err != nil {
+		return err
+	}
+	// Изменения повторов хранятся по датам, поэтому категория в них заменяется конвейером обновления
+	renamed := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$$this.v.category", from}},
+		bson.M{"$mergeObjects": bson.A{"$$this.v", bson.M{"category": to}}},
+		"$$this.v",
+	}}
+	overrides := bson.M{"$arrayToObject": bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": "$overrides"},
+		"in":    bson.M{"k": "$$this.k", "v": renamed},
+	}}}
+	_, err = database.RecurringCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "$expr": bson.M{"$in": bson.A{from, overrideCategories}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"overrides": overrides}}}})
+	return err
+}
+
+// GetCategories godoc
+// @Summary Получить категории пользователя
+// @Tags categories
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.Category
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories [get]
+func GetCategories(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	if err := EnsureDefaults(context.Background(), userID); err != nil {
+		log.Printf("Ошибка создания категорий по умолчанию: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить категории"})
+	}
+
+	cursor, err := database.CategoriesCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить категории"})
+	}
+
+	categories := []models.Category{}
+	if err := cursor.All(context.Background(), &categories); err != nil {
+		log.Printf("Ошибка декодирования категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования категорий"})
+	}
+
+	return c.JSON(categories)
+}
+
+// PostCategory godoc
+// @Summary Создать категорию
+// @Tags categories
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param category body models.Category true "Данные категории"
+// @Success 201 {object} models.Category
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories [post]
+func PostCategory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	category := new(models.Category)
+	if err := c.BodyParser(category); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'name' обязательно"})
+	}
+	if category.Color != "" && !colorPattern.MatchString(category.Color) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'color' должно быть в формате #RRGGBB"})
+	}
+
+	// Заводим категории по умолчанию до вставки, чтобы новая категория не помешала миграции старых пользователей
+	if err := EnsureDefaults(context.Background(), userID); err != nil {
+		log.Printf("Ошибка создания категорий по умолчанию: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать категорию"})
+	}
+
+	if category.ParentID != nil {
+		tree, err := LoadTree(context.Background(), userID)
+		if err != nil {
+			log.Printf("Ошибка загрузки дерева категорий: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать категорию"})
+		}
+		if err := tree.ValidateParent(primitive.NilObjectID, *category.ParentID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	category.ID = primitive.NilObjectID
+	category.UserID = userID
+
+	insertRes, err := database.CategoriesCollection.InsertOne(context.Background(), category)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Категория с таким названием уже существует"})
+	}
+	if err != nil {
+		log.Printf("Ошибка вставки категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать категорию"})
+	}
+
+	category.ID = insertRes.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// UpdateCategory godoc
+// @Summary Обновить категорию
+// @Description При переименовании категория меняется во всех транзакциях пользователя в одной транзакции MongoDB.
+// @Description Пустой parent_id делает категорию корневой.
+// @Tags categories
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID категории"
+// @Param update body map[string]string true "Поля: name, color, icon, parent_id"
+// @Success 200 {object} models.Category
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories/{id} [patch]
+func UpdateCategory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+
+	updates := bson.M{}
+	if name, ok := data["name"]; ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'name' не может быть пустым"})
+		}
+		updates["name"] = name
+	}
+	if color, ok := data["color"]; ok {
+		if color != "" && !colorPattern.MatchString(color) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'color' должно быть в формате #RRGGBB"})
+		}
+		updates["color"] = color
+	}
+	if icon, ok := data["icon"]; ok {
+		updates["icon"] = icon
+	}
+
+	var parentID *primitive.ObjectID
+	parentStr, parentChanged := data["parent_id"]
+	if parentChanged && parentStr != "" {
+		id, err := primitive.ObjectIDFromHex(parentStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат 'parent_id'"})
+		}
+		parentID = &id
+	}
+
+	if len(updates) == 0 && !parentChanged {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нет полей для обновления"})
+	}
+
+	updateDoc := bson.M{}
+	if parentChanged && parentID == nil {
+		updateDoc["$unset"] = bson.M{"parent_id": ""}
+	} else if parentChanged {
+		updates["parent_id"] = parentID
+	}
+	if len(updates) > 0 {
+		updateDoc["$set"] = updates
+	}
+
+	filter := bson.M{"_id": objectID, "user_id": userID}
+
+	result, err := database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var old models.Category
+		if err := database.CategoriesCollection.FindOne(sessCtx, filter).Decode(&old); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errCategoryNotFound
+			}
+			return nil, err
+		}
+
+		if parentID != nil {
+			tree, err := LoadTree(sessCtx, userID)
+			if err != nil {
+				return nil, err
+			}
+			if err := tree.ValidateParent(objectID, *parentID); err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+		}
+
+		var updated models.Category
+		after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := database.CategoriesCollection.FindOneAndUpdate(sessCtx, filter, updateDoc, after).Decode(&updated); err != nil {
+			return nil, err
+		}
+
+		// Переименование: переносим все транзакции с частями разбивки, шаблоны повторяющихся операций и правила на новое имя
+		if updated.Name != old.Name {
+			if _, err := renameTransactions(sessCtx, userID, old.Name, updated.Name); err != nil {
+				return nil, err
+			}
+			if err := renameTrash(sessCtx, userID, old.Name, updated.Name); err != nil {
+				return nil, err
+			}
+			if err := renameRecurring(sessCtx, userID, old.Name, updated.Name); err != nil {
+				return nil, err
+			}
+			_, err := database.RulesCollection.UpdateMany(sessCtx,
+				bson.M{"user_id": userID, "set.category": old.Name},
+				bson.M{"$set": bson.M{"set.category": updated.Name}})
+			if err != nil {
+				return nil, err
+			}
+			// Статистика подсказок переходит к новому имени; старая статистика удалённой категории с тем же именем не нужна
+			_, err = database.CategoryWordsCollection.DeleteOne(sessCtx, bson.M{"user_id": userID, "category": updated.Name})
+			if err != nil {
+				return nil, err
+			}
+			_, err = database.CategoryWordsCollection.UpdateOne(sessCtx,
+				bson.M{"user_id": userID, "category": old.Name},
+				bson.M{"$set": bson.M{"category": updated.Name}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return updated, nil
+	})
+	if errors.Is(err, errCategoryNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Категория не найдена"})
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{"error": fiberErr.Message})
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Категория с таким названием уже существует. Используйте объединение категорий"})
+	}
+	if err != nil {
+		log.Printf("Ошибка обновления категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить категорию"})
+	}
+
+	return c.JSON(result)
+}
+
+// MergeCategory godoc
+// @Summary Объединить категорию с другой
+// @Description Все транзакции и подкатегории переносятся в целевую категорию, исходная категория удаляется. Выполняется атомарно.
+// @Tags categories
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID исходной категории"
+// @Param merge body map[string]string true "Поле: target_id"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories/{id}/merge [post]
+func MergeCategory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	sourceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var body struct {
+		TargetID string `json:"target_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+	targetID, err := primitive.ObjectIDFromHex(body.TargetID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат 'target_id'"})
+	}
+	if targetID == sourceID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нельзя объединить категорию саму с собой"})
+	}
+
+	result, err := database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var source, target models.Category
+		if err := database.CategoriesCollection.FindOne(sessCtx, bson.M{"_id": sourceID, "user_id": userID}).Decode(&source); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errCategoryNotFound
+			}
+			return nil, err
+		}
+		if err := database.CategoriesCollection.FindOne(sessCtx, bson.M{"_id": targetID, "user_id": userID}).Decode(&target); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errCategoryNotFound
+			}
+			return nil, err
+		}
+
+		// Подкатегории исходной категории переезжают под целевую: проверяем цикл и глубину
+		tree, err := LoadTree(sessCtx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if tree.isAncestor(sourceID, targetID) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Нельзя объединить категорию с её подкатегорией")
+		}
+		for _, child := range tree.children(sourceID) {
+			if tree.depth(targetID)+tree.height(child.ID) > MaxDepth {
+				return nil, fiber.NewError(fiber.StatusBadRequest, errTooDeep.Error())
+			}
+		}
+		if _, err := database.CategoriesCollection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, "parent_id": sourceID},
+			bson.M{"$set": bson.M{"parent_id": targetID}}); err != nil {
+			return nil, err
+		}
+
+		moved, err := renameTransactions(sessCtx, userID, source.Name, target.Name)
+		if err != nil {
+			return nil, err
+		}
+		if err := renameTrash(sessCtx, userID, source.Name, target.Name); err != nil {
+			return nil, err
+		}
+
+		if err := renameRecurring(sessCtx, userID, source.Name, target.Name); err != nil {
+			return nil, err
+		}
+
+		if _, err := database.RulesCollection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, "set.category": source.Name},
+			bson.M{"$set": bson.M{"set.category": target.Name}}); err != nil {
+			return nil, err
+		}
+
+		// Подсказки категорий обучатся заново по объединённым транзакциям
+		if _, err := database.CategoryWordsCollection.DeleteMany(sessCtx, bson.M{"user_id": userID}); err != nil {
+			return nil, err
+		}
+
+		// Бюджеты исходной категории начинают ограничивать целевую
+		if _, err := database.BudgetsCollection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, "category_id": sourceID},
+			bson.M{"$set": bson.M{"category_id": targetID}}); err != nil {
+			return nil, err
+		}
+
+		if _, err := database.CategoriesCollection.DeleteOne(sessCtx, bson.M{"_id": sourceID, "user_id": userID}); err != nil {
+			return nil, err
+		}
+		return moved, nil
+	})
+	if errors.Is(err, errCategoryNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Категория не найдена"})
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{"error": fiberErr.Message})
+	}
+	if err != nil {
+		log.Printf("Ошибка объединения категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось объединить категории"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Категории объединены", "moved": result})
+}
+
+// DeleteCategory godoc
+// @Summary Удалить категорию
+// @Description Категорию с подкатегориями, используемую в транзакциях, бюджетах, повторяющихся операциях или правилах удалить нельзя — её нужно объединить с другой.
+// @Tags categories
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID категории"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories/{id} [delete]
+func DeleteCategory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var category models.Category
+	filter := bson.M{"_id": objectID, "user_id": userID}
+	if err := database.CategoriesCollection.FindOne(context.Background(), filter).Decode(&category); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Категория не найдена"})
+	}
+
+	children, err := database.CategoriesCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "parent_id": objectID})
+	if err != nil {
+		log.Printf("Ошибка подсчёта подкатегорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if children > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "У категории есть подкатегории. Перенесите их или объедините категорию с другой"})
+	}
+
+	used, err := database.TransactionsCollection.CountDocuments(context.Background(), bson.M{"user_id": userID,
+		"$or": bson.A{bson.M{"category": category.Name}, bson.M{"splits.category": category.Name}}})
+	if err != nil {
+		log.Printf("Ошибка подсчёта транзакций категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if used > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Категория используется в транзакциях. Объедините её с другой категорией", "transactions": used})
+	}
+
+	budgets, err := database.BudgetsCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "category_id": objectID})
+	if err != nil {
+		log.Printf("Ошибка подсчёта бюджетов категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if budgets > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "На категорию заведены бюджеты. Удалите их или объедините категорию с другой", "budgets": budgets})
+	}
+
+	recurring, err := database.RecurringCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "$or": bson.A{
+		bson.M{"category": category.Name},
+		overridesCategory(category.Name),
+	}})
+	if err != nil {
+		log.Printf("Ошибка подсчёта повторяющихся операций категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if recurring > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Категория используется в повторяющихся операциях. Объедините её с другой категорией", "recurring": recurring})
+	}
+
+	rules, err := database.RulesCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "set.category": category.Name})
+	if err != nil {
+		log.Printf("Ошибка подсчёта правил категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if rules > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Категорию устанавливают правила категоризации. Измените их или объедините категорию с другой", "rules": rules})
+	}
+
+	if _, err := database.CategoriesCollection.DeleteOne(context.Background(), filter); err != nil {
+		log.Printf("Ошибка удаления категории: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить категорию"})
+	}
+	if _, err := database.CategoryWordsCollection.DeleteOne(context.Background(), bson.M{"user_id": userID, "category": category.Name}); err != nil {
+		log.Printf("Ошибка удаления статистики подсказок категории: %v\n", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Категория успешно удалена"})
+}
@@ -0,0 +1,82 @@
+package categories
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultCategories — набор категорий, который получает каждый новый пользователь.
+var defaultCategories = []models.Category{
+	{Name: "Продукты", Color: "#ff7d00", Icon: "shopping-cart"},
+	{Name: "Кафе и рестораны", Color: "#f24c4c", Icon: "utensils"},
+	{Name: "Транспорт", Color: "#5d62b5", Icon: "bus"},
+	{Name: "Жильё", Color: "#6b5ca5", Icon: "home"},
+	{Name: "Коммунальные услуги", Color: "#3498db", Icon: "zap"},
+	{Name: "Связь и интернет", Color: "#1abc9c", Icon: "wifi"},
+	{Name: "Здоровье", Color: "#e74c3c", Icon: "heart-pulse"},
+	{Name: "Одежда", Color: "#9b59b6", Icon: "shirt"},
+	{Name: "Развлечения", Color: "#ffc107", Icon: "film"},
+	{Name: "Подарки", Color: "#f1c40f", Icon: "gift"},
+	{Name: "Зарплата", Color: "#20c997", Icon: "briefcase"},
+	{Name: "Прочее", Color: "#95a5a6", Icon: "circle-ellipsis"},
+}
+
+// SeedDefaults создаёт набор категорий по умолчанию для пользователя.
+// Уже существующие категории с теми же именами пропускаются.
+func SeedDefaults(ctx context.Context, userID primitive.ObjectID) error {
+	return insertCategories(ctx, userID, defaultCategories)
+}
+
+// EnsureDefaults заводит категории пользователю, у которого их ещё нет
+// (зарегистрирован до появления категорий): набор по умолчанию плюс
+// все категории, уже встречающиеся в его транзакциях.
+func EnsureDefaults(ctx context.Context, userID primitive.ObjectID) error {
+	count, err := database.CategoriesCollection.CountDocuments(ctx, bson.M{"user_id": userID}, options.Count().SetLimit(1))
+	if err != nil || count > 0 {
+		return err
+	}
+
+	categories := append([]models.Category{}, defaultCategories...)
+
+	used, err := database.TransactionsCollection.Distinct(ctx, "category", bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	for _, name := range used {
+		if name, ok := name.(string); ok && name != "" {
+			categories = append(categories, models.Category{Name: name})
+		}
+	}
+
+	return insertCategories(ctx, userID, categories)
+}
+
+// Exists проверяет, что у пользователя есть категория с таким именем.
+func Exists(ctx context.Context, userID primitive.ObjectID, name string) (bool, error) {
+	if err := EnsureDefaults(ctx, userID); err != nil {
+		return false, err
+	}
+	count, err := database.CategoriesCollection.CountDocuments(ctx, bson.M{"user_id": userID, "name": name}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// insertCategories вставляет категории, игнорируя дубликаты по уникальному индексу (user_id, name).
+func insertCategories(ctx context.Context, userID primitive.ObjectID, categories []models.Category) error {
+	docs := make([]interface{}, 0, len(categories))
+	for _, category := range categories {
+		category.ID = primitive.NilObjectID
+		category.UserID = userID
+		docs = append(docs, category)
+	}
+
+	_, err := database.CategoriesCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxDepth — максимальная глубина дерева категорий («Еда > Продукты > Овощи»).
+const MaxDepth = 3
+
+// Уровни группировки категорий в агрегациях.
+const (
+	GroupLeaf = "leaf" // Категория транзакции как есть
+	GroupTop  = "top"  // Корневая категория дерева
+)
+
+var (
+	errParentNotFound = errors.New("Родительская категория не найдена")
+	errCycle          = errors.New("Категория не может быть вложена в саму себя или в свою подкатегорию")
+	errTooDeep        = errors.New("Превышена максимальная глубина вложенности категорий")
+)
+
+// Tree — все категории пользователя, загруженные в память (их немного).
+type Tree struct {
+	byID   map[primitive.ObjectID]models.Category
+	byName map[string]models.Category
+}
+
+// LoadTree загружает категории пользователя.
+func LoadTree(ctx context.Context, userID primitive.ObjectID) (*Tree, error) {
+	cursor, err := database.CategoriesCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Category
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{
+		byID:   make(map[primitive.ObjectID]models.Category, len(list)),
+		byName: make(map[string]models.Category, len(list)),
+	}
+	for _, category := range list {
+		tree.byID[category.ID] = category
+		tree.byName[category.Name] = category
+	}
+	return tree, nil
+}
+
+// parent возвращает родителя категории, если он есть.
+func (t *Tree) parent(category models.Category) (models.Category, bool) {
+	if category.ParentID == nil {
+		return models.Category{}, false
+	}
+	parent, ok := t.byID[*category.ParentID]
+	return parent, ok
+}
+
+// depth — уровень категории, корень имеет глубину 1.
+func (t *Tree) depth(id primitive.ObjectID) int {
+	depth := 0
+	for category, ok := t.byID[id]; ok && depth <= MaxDepth; category, ok = t.parent(category) {
+		depth++
+	}
+	return depth
+}
+
+// height — высота поддерева категории, лист имеет высоту 1.
+func (t *Tree) height(id primitive.ObjectID) int {
+	height := 1
+	for _, child := range t.children(id) {
+		if h := t.height(child.ID) + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// children возвращает прямых потомков категории.
+func (t *Tree) children(id primitive.ObjectID) []models.Category {
+	var children []models.Category
+	for _, category := range t.byID {
+		if category.ParentID != nil && *category.ParentID == id {
+			children = append(children, category)
+		}
+	}
+	return children
+}
+
+// isAncestor проверяет, является ли ancestor предком (или самой) категорией id.
+func (t *Tree) isAncestor(ancestor, id primitive.ObjectID) bool {
+	for category, ok := t.byID[id]; ok; category, ok = t.parent(category) {
+		if category.ID == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateParent проверяет, что категорию id можно поместить под parentID:
+// родитель существует, не образуется цикл и не превышается MaxDepth.
+// Для новой категории id — NilObjectID.
+func (t *Tree) ValidateParent(id primitive.ObjectID, parentID primitive.ObjectID) error {
+	if _, ok := t.byID[parentID]; !ok {
+		return errParentNotFound
+	}
+	if !id.IsZero() && t.isAncestor(id, parentID) {
+		return errCycle
+	}
+	height := 1
+	if !id.IsZero() {
+		height = t.height(id)
+	}
+	if t.depth(parentID)+height > MaxDepth {
+		return errTooDeep
+	}
+	return nil
+}
+
+// Name возвращает имя категории по её ID.
+func (t *Tree) Name(id primitive.ObjectID) (string, bool) {
+	category, ok := t.byID[id]
+	return category.Name, ok
+}
+
+// Has сообщает, есть ли у пользователя категория с таким именем.
+func (t *Tree) Has(name string) bool {
+	_, ok := t.byName[name]
+	return ok
+}
+
+// Root возвращает имя корневой категории для имени категории транзакции.
+func (t *Tree) Root(name string) string {
+	category, ok := t.byName[name]
+	if !ok {
+		return name
+	}
+	for parent, ok := t.parent(category); ok; parent, ok = t.parent(parent) {
+		category = parent
+	}
+	return category.Name
+}
+
+// Descendants возвращает имена категорий вместе со всеми их подкатегориями.
+func (t *Tree) Descendants(names []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	var walk func(name string)
+	walk = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		result = append(result, name)
+		if category, ok := t.byName[name]; ok {
+			for _, child := range t.children(category.ID) {
+				walk(child.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		walk(name)
+	}
+	return result
+}
+
+// GroupExpr возвращает выражение агрегации для поля категории с учётом уровня группировки:
+// для GroupLeaf — "$category", для GroupTop — имя корневой категории.
+func (t *Tree) GroupExpr(level string) interface{} {
+	if level != GroupTop {
+		return "$category"
+	}
+
+	// Сопоставление «подкатегория → корень» в виде двух параллельных массивов
+	names, roots := bson.A{}, bson.A{}
+	for name, category := range t.byName {
+		if category.ParentID == nil {
+			continue
+		}
+		names = append(names, name)
+		roots = append(roots, t.Root(name))
+	}
+	if len(names) == 0 {
+		return "$category"
+	}
+
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"i": bson.M{"$indexOfArray": bson.A{names, "$category"}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$$i", 0}},
+			bson.M{"$arrayElemAt": bson.A{roots, "$$i"}},
+			"$category",
+		}},
+	}}
+}
+
+// ParseGroup проверяет значение параметра группировки.
+func ParseGroup(value string) (string, error) {
+	switch value {
+	case "", GroupLeaf:
+		return GroupLeaf, nil
+	case GroupTop:
+		return GroupTop, nil
+	}
+	return "", errors.New("Параметр 'group' должен быть 'leaf' или 'top'")
+}
@@ -12,8 +12,24 @@ import (
 	"time"
 )
 
+var Client *mongo.Client
 var TransactionsCollection *mongo.Collection
 var UsersCollection *mongo.Collection
+var CategoriesCollection *mongo.Collection
+var AccountsCollection *mongo.Collection
+var RatesCollection *mongo.Collection
+var BudgetsCollection *mongo.Collection
+var RecurringCollection *mongo.Collection
+var ImportsCollection *mongo.Collection
+var RulesCollection *mongo.Collection
+var CategoryWordsCollection *mongo.Collection
+var AttachmentsCollection *mongo.Collection
+var TrashCollection *mongo.Collection
+var HistoryCollection *mongo.Collection
+var IdempotencyCollection *mongo.Collection
+
+// Database — база приложения; нужна хранилищу вложений GridFS.
+var Database *mongo.Database
 
 func MongoDBConnection() *mongo.Client {
 	MONGODB_URI := os.Getenv("MONGODB_URI")
@@ -37,26 +53,243 @@ func MongoDBConnection() *mongo.Client {
 
 	dbName := "golang_db"
 	db := client.Database(dbName)
+	Client = client
+	Database = db
 	TransactionsCollection = db.Collection("transactions")
 	UsersCollection = db.Collection("users")
+	CategoriesCollection = db.Collection("categories")
+	AccountsCollection = db.Collection("accounts")
+	RatesCollection = db.Collection("rates")
+	BudgetsCollection = db.Collection("budgets")
+	RecurringCollection = db.Collection("recurring")
+	ImportsCollection = db.Collection("imports")
+	RulesCollection = db.Collection("rules")
+	CategoryWordsCollection = db.Collection("category_words")
+	AttachmentsCollection = db.Collection("attachments")
+	TrashCollection = db.Collection("trash")
+	HistoryCollection = db.Collection("history")
+	IdempotencyCollection = db.Collection("idempotency_keys")
+
+	// Составные индексы под фильтры и сортировки списка транзакций.
+	// _id в конце индекса нужен для стабильной курсорной пагинации.
+	createIndexes(TransactionsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_date_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "amount", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_amount_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "category", Value: 1}, {Key: "date", Value: -1}},
+			Options: options.Index().SetName("user_category_date_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "type", Value: 1}, {Key: "date", Value: -1}},
+			Options: options.Index().SetName("user_type_date_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "date", Value: -1}},
+			Options: options.Index().SetName("user_account_date_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "transfer_id", Value: 1}},
+			Options: options.Index().SetName("transfer_id_index").SetSparse(true),
+		},
+		{
+			// Каждый повтор повторяющейся операции создаётся ровно один раз
+			Keys: bson.D{{Key: "recurring_id", Value: 1}, {Key: "occurrence", Value: 1}},
+			Options: options.Index().SetName("recurring_occurrence_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"recurring_id": bson.M{"$exists": true}}),
+		},
+		{
+			// Откат загрузки выписки удаляет все её транзакции
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "import_id", Value: 1}},
+			Options: options.Index().SetName("user_import_index").
+				SetPartialFilterExpression(bson.M{"import_id": bson.M{"$exists": true}}),
+		},
+		{
+			// Операция банка (FITID) импортируется на счёт один раз
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "external_id", Value: 1}},
+			Options: options.Index().SetName("user_account_external_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"external_id": bson.M{"$exists": true}}),
+		},
+		{
+			// Кассовый чек добавляется один раз
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "receipt.fn", Value: 1}, {Key: "receipt.fd", Value: 1}, {Key: "receipt.fp", Value: 1}},
+			Options: options.Index().SetName("user_receipt_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"receipt": bson.M{"$exists": true}}),
+		},
+		{
+			// Группы вероятных дублей собираются по ссылке на исходную транзакцию
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "possible_duplicate_of", Value: 1}},
+			Options: options.Index().SetName("user_duplicate_index").
+				SetPartialFilterExpression(bson.M{"possible_duplicate_of": bson.M{"$exists": true}}),
+		},
+		{
+			// Фильтр по тегам, список тегов и их переименование (multikey-индекс по массиву)
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}},
+			Options: options.Index().SetName("user_tags_index").SetSparse(true),
+		},
+		{
+			// Фильтр по категории находит транзакции по частям разбивки
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "splits.category", Value: 1}},
+			Options: options.Index().SetName("user_split_category_index").SetSparse(true),
+		},
+	})
+
+	// Имя категории уникально в рамках пользователя
+	createIndexes(CategoriesCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("user_name_unique").SetUnique(true),
+		},
+	})
+
+	createIndexes(AccountsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("user_name_unique").SetUnique(true),
+		},
+	})
+
+	// Один курс пары валют на дату; индекс же обслуживает поиск последнего курса не позже даты
+	createIndexes(RatesCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "base", Value: 1}, {Key: "quote", Value: 1}, {Key: "date", Value: -1}},
+			Options: options.Index().SetName("pair_date_unique").SetUnique(true),
+		},
+	})
+
+	createIndexes(BudgetsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "category_id", Value: 1}},
+			Options: options.Index().SetName("user_category_index"),
+		},
+	})
+
+	// Планировщик ищет правила с наступившим next_run
+	createIndexes(RecurringCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "next_run", Value: 1}},
+			Options: options.Index().SetName("next_run_index").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_index"),
+		},
+	})
+
+	createIndexes(ImportsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("user_created_index"),
+		},
+	})
+
+	createIndexes(RulesCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "priority", Value: 1}},
+			Options: options.Index().SetName("user_priority_index"),
+		},
+	})
+
+	// Статистика слов для подсказок категорий: один документ на категорию пользователя
+	createIndexes(CategoryWordsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "category", Value: 1}},
+			Options: options.Index().SetName("user_category_unique").SetUnique(true),
+		},
+	})
+
+	// Вложения выбираются по транзакции, квота считается по пользователю
+	createIndexes(AttachmentsCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "transaction_id", Value: 1}},
+			Options: options.Index().SetName("user_transaction_index"),
+		},
+	})
+
+	// Корзина показывается от недавно удалённых, очистка по сроку идёт по дате удаления
+	createIndexes(TrashCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "deleted_at", Value: -1}},
+			Options: options.Index().SetName("user_deleted_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName("deleted_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "transfer_id", Value: 1}},
+			Options: options.Index().SetName("transfer_id_index").SetSparse(true),
+		},
+	})
+
+	// История транзакции читается от новых ревизий к старым
+	createIndexes(HistoryCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "transaction_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_transaction_created_index"),
+		},
+	})
+
+	// Ключ идемпотентности уникален в рамках пользователя; MongoDB удаляет записи по наступлении expires_at
+	createIndexes(IdempotencyCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetName("user_key_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_ttl_index").SetExpireAfterSeconds(0),
+		},
+	})
+
+	return client
+}
 
-	// --- Начало кода для создания индекса ---
-	fmt.Printf("Попытка создания индекса для коллекции '%s' в базе данных '%s'...\n", "transactions", dbName)
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "userId", Value: 1}}, // Индекс по userId, порядок возрастания
-		Options: options.Index().SetName("user_id_index"),
+// WithTransaction выполняет fn внутри многодокументной транзакции MongoDB.
+// Все операции внутри fn должны использовать переданный контекст сессии.
+func WithTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := Client.StartSession()
+	if err != nil {
+		return nil, err
 	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, fn)
+}
+
+// BumpVersion дополняет обновление транзакций увеличением версии: любое изменение транзакции меняет её ETag.
+func BumpVersion(update bson.M) bson.M {
+	update["$inc"] = bson.M{"version": 1}
+	return update
+}
+
+// VersionFilter дополняет фильтр транзакций условием на версию. Версия 0 — транзакция не менялась, поля version у неё нет.
+func VersionFilter(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// createIndexes создаёт индексы коллекции. Ошибка не фатальна: приложение продолжит работу без индекса.
+func createIndexes(collection *mongo.Collection, models []mongo.IndexModel) {
+	fmt.Printf("Попытка создания индексов для коллекции '%s'...\n", collection.Name())
 
 	// Устанавливаем таймаут для операции создания индекса, на всякий случай
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second) // 15 секунд таймаут
 	defer cancel()
 
-	indexName, err := TransactionsCollection.Indexes().CreateOne(ctx, indexModel)
+	names, err := collection.Indexes().CreateMany(ctx, models)
 	if err != nil {
-		log.Printf("Предупреждение: не удалось создать индекс 'userId_index' для коллекции 'transactions' (возможно, он уже существует или возникла другая ошибка): %v\n", err)
-	} else {
-		fmt.Printf("Индекс '%s' по полю 'userId' для коллекции 'transactions' успешно создан или уже существовал.\n", indexName)
+		log.Printf("Предупреждение: не удалось создать индексы для коллекции '%s' (возможно, они уже существуют или возникла другая ошибка): %v\n", collection.Name(), err)
+		return
 	}
-
-	return client
+	fmt.Printf("Индексы %v для коллекции '%s' успешно созданы или уже существовали.\n", names, collection.Name())
 }
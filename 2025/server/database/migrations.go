@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// migrationBatchSize — сколько документов конвертируется за один проход.
+const migrationBatchSize = 500
+
+// MigrateDecimalAmounts переводит денежные поля, сохранённые как double или целые,
+// в Decimal128 с округлением до копеек. Работает небольшими пачками, поэтому
+// её можно запускать на живой базе в фоне: приложение читает оба формата.
+func MigrateDecimalAmounts(ctx context.Context) {
+	migrateDecimalField(ctx, TransactionsCollection, "amount")
+	migrateDecimalField(ctx, AccountsCollection, "opening_balance")
+}
+
+// migrateDecimalField конвертирует одно поле коллекции, пока не останется документов в старом формате.
+func migrateDecimalField(ctx context.Context, collection *mongo.Collection, field string) {
+	legacy := bson.M{field: bson.M{"$type": bson.A{"double", "int", "long"}}}
+	convert := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{field: bson.M{"$round": bson.A{bson.M{"$toDecimal": "$" + field}, 2}}}}},
+	}
+
+	total := int64(0)
+	for {
+		cursor, err := collection.Find(ctx, legacy, options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(migrationBatchSize))
+		if err != nil {
+			log.Printf("Миграция %s.%s: ошибка поиска: %v\n", collection.Name(), field, err)
+			return
+		}
+		var batch []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &batch); err != nil {
+			log.Printf("Миграция %s.%s: ошибка чтения: %v\n", collection.Name(), field, err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(batch))
+		for _, doc := range batch {
+			ids = append(ids, doc.ID)
+		}
+		// Повторяем условие на тип, чтобы не задеть документы, уже изменённые приложением
+		filter := bson.M{"_id": bson.M{"$in": ids}, field: legacy[field]}
+		result, err := collection.UpdateMany(ctx, filter, convert)
+		if err != nil {
+			log.Printf("Миграция %s.%s: ошибка обновления: %v\n", collection.Name(), field, err)
+			return
+		}
+		total += result.ModifiedCount
+		if result.ModifiedCount == 0 {
+			break
+		}
+
+		// Небольшая пауза между пачками, чтобы не нагружать базу
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if total > 0 {
+		log.Printf("Миграция %s.%s: в Decimal128 переведено документов: %d\n", collection.Name(), field, total)
+	}
+}
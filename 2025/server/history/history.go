@@ -0,0 +1,414 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+)
+
+// Действия ревизий.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"  // Перенос в корзину или безвозвратное удаление без корзины
+	ActionRestore = "restore" // Восстановление из корзины
+	ActionRevert  = "revert"  // Возврат к ревизии
+)
+
+// Источники изменений.
+const (
+	SourceAPI       = "api"
+	SourceImport    = "import"
+	SourceRecurring = "recurring"
+	SourceRules     = "rules"
+)
+
+// Origin — кто и через что изменил транзакцию.
+type Origin struct {
+	Source  string
+	ActorID *primitive.ObjectID // nil — изменение без участия пользователя, например планировщиком
+}
+
+// By возвращает изменение пользователя userID через source.
+func By(userID primitive.ObjectID, source string) Origin {
+	return Origin{Source: source, ActorID: &userID}
+}
+
+// Change — транзакция до и после изменения; Before пуст при создании, After — при удалении.
+type Change struct {
+	Before *models.Transaction
+	After  *models.Transaction
+}
+
+// fields возвращает поля транзакции в виде BSON без _id и user_id, которые не меняются,
+// и без version: при возврате к ревизии версия не откатывается.
+func fields(t *models.Transaction) (map[string]bson.RawValue, error) {
+	result := map[string]bson.RawValue{}
+	if t == nil {
+		return result, nil
+	}
+	data, err := bson.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := bson.Raw(data).Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		if key := element.Key(); key != "_id" && key != "user_id" && key != "version" {
+			result[key] = element.Value()
+		}
+	}
+	return result, nil
+}
+
+// document собирает BSON-документ из полей в порядке имён; пустой набор полей — nil.
+func document(values map[string]bson.RawValue) (bson.Raw, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	d := make(bson.D, len(keys))
+	for i, key := range keys {
+		d[i] = bson.E{Key: key, Value: values[key]}
+	}
+	return bson.Marshal(d)
+}
+
+// Diff возвращает изменённые поля транзакции до и после изменения.
+func (c Change) Diff() (bson.Raw, bson.Raw, error) {
+	before, err := fields(c.Before)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := fields(c.After)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range before {
+		if other, ok := after[key]; ok && other.Type == value.Type && bytes.Equal(other.Value, value.Value) {
+			delete(before, key)
+			delete(after, key)
+		}
+	}
+	beforeDoc, err := document(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterDoc, err := document(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeDoc, afterDoc, nil
+}
+
+// Empty сообщает, что поля транзакции не изменились.
+func (c Change) Empty() bool {
+	before, after, err := c.Diff()
+	return err == nil && before == nil && after == nil
+}
+
+// Record записывает ревизии изменений. Изменения без разницы в полях пропускаются.
+// Вызывается в той же транзакции MongoDB, что и само изменение, с её контекстом.
+func Record(ctx context.Context, origin Origin, action string, changes ...Change) error {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	var documents []interface{}
+	for _, change := range changes {
+		revision, err := revision(origin, action, change, now)
+		if err != nil {
+			return err
+		}
+		if revision != nil {
+			documents = append(documents, revision)
+		}
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	_, err := database.HistoryCollection.InsertMany(ctx, documents)
+	return err
+}
+
+// revision строит ревизию изменения; nil — поля не изменились.
+func revision(origin Origin, action string, change Change, now primitive.DateTime) (*models.Revision, error) {
+	before, after, err := change.Diff()
+	if err != nil {
+		return nil, err
+	}
+	if before == nil && after == nil {
+		return nil, nil
+	}
+	t := change.After
+	if t == nil {
+		t = change.Before
+	}
+	return &models.Revision{
+		ID:            primitive.NewObjectID(),
+		UserID:        t.UserID,
+		TransactionID: t.ID,
+		Action:        action,
+		Source:        origin.Source,
+		ActorID:       origin.ActorID,
+		Before:        before,
+		After:         after,
+		CreatedAt:     now,
+	}, nil
+}
+
+// Update применяет update к транзакции по filter, увеличивает её версию и записывает ревизию.
+// Вызывается внутри транзакции MongoDB. Транзакция не найдена — mongo.ErrNoDocuments.
+func Update(ctx context.Context, origin Origin, filter bson.M, update bson.M) (Change, error) {
+	var before, after models.Transaction
+	err := database.TransactionsCollection.FindOneAndUpdate(ctx, filter, database.BumpVersion(update)).Decode(&before)
+	if err != nil {
+		return Change{}, err
+	}
+	if err := database.TransactionsCollection.FindOne(ctx, bson.M{"_id": before.ID}).Decode(&after); err != nil {
+		return Change{}, err
+	}
+	change := Change{Before: &before, After: &after}
+	return change, Record(ctx, origin, ActionUpdate, change)
+}
+
+// Tracked — транзакции до массового изменения, например переименования категории во всех транзакциях.
+type Tracked []models.Transaction
+
+// Track находит транзакции по filter перед массовым изменением. Вызывается внутри той же транзакции MongoDB,
+// что и изменение, а после него — Tracked.Record.
+func Track(ctx context.Context, filter bson.M) (Tracked, error) {
+	cursor, err := database.TransactionsCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var tracked Tracked
+	if err := cursor.All(ctx, &tracked); err != nil {
+		return nil, err
+	}
+	return tracked, nil
+}
+
+// Record перечитывает транзакции после массового изменения и записывает по ревизии на каждую изменённую.
+// Транзакции, удалённые изменением, пропускаются.
+func (t Tracked) Record(ctx context.Context, origin Origin) error {
+	if len(t) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(t))
+	for i, before := range t {
+		ids[i] = before.ID
+	}
+	cursor, err := database.TransactionsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var updated []models.Transaction
+	if err := cursor.All(ctx, &updated); err != nil {
+		return err
+	}
+	after := make(map[primitive.ObjectID]*models.Transaction, len(updated))
+	for i := range updated {
+		after[updated[i].ID] = &updated[i]
+	}
+
+	changes := make([]Change, 0, len(t))
+	for i := range t {
+		if current, ok := after[t[i].ID]; ok {
+			changes = append(changes, Change{Before: &t[i], After: current})
+		}
+	}
+	return Record(ctx, origin, ActionUpdate, changes...)
+}
+
+// Revert заменяет транзакцию current состоянием state со следующей версией и записывает ревизию возврата к ревизии target.
+// Вызывается внутри транзакции MongoDB. Транзакция не найдена — mongo.ErrNoDocuments.
+func Revert(ctx context.Context, origin Origin, current models.Transaction, state *models.Transaction, target primitive.ObjectID) error {
+	state.Version = current.Version + 1
+	filter := database.VersionFilter(bson.M{"_id": current.ID, "user_id": current.UserID}, current.Version)
+	result, err := database.TransactionsCollection.ReplaceOne(ctx, filter, state)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	r, err := revision(origin, ActionRevert, Change{Before: &current, After: state}, primitive.NewDateTimeFromTime(time.Now()))
+	if err != nil || r == nil {
+		return err
+	}
+	r.RevertedTo = &target
+	_, err = database.HistoryCollection.InsertOne(ctx, r)
+	return err
+}
+
+// Revisions возвращает ревизии транзакции пользователя от новых к старым.
+func Revisions(ctx context.Context, userID primitive.ObjectID, transactionID primitive.ObjectID) ([]models.Revision, error) {
+	cursor, err := database.HistoryCollection.Find(ctx,
+		bson.M{"user_id": userID, "transaction_id": transactionID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	list := []models.Revision{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// StateAt восстанавливает транзакцию current такой, какой она была сразу после ревизии target:
+// изменения более новых ревизий откатываются от новых к старым. nil — после target транзакция удалена.
+func StateAt(ctx context.Context, current models.Transaction, target models.Revision) (*models.Transaction, error) {
+	if target.Action == ActionDelete {
+		return nil, nil
+	}
+	state, err := fields(&current)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := database.HistoryCollection.Find(ctx,
+		bson.M{"user_id": current.UserID, "transaction_id": current.ID, "$or": bson.A{
+			bson.M{"created_at": bson.M{"$gt": target.CreatedAt}},
+			bson.M{"created_at": target.CreatedAt, "_id": bson.M{"$gt": target.ID}},
+		}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var newer []models.Revision
+	if err := cursor.All(ctx, &newer); err != nil {
+		return nil, err
+	}
+
+	for _, r := range newer {
+		before, err := rawFields(r.Before)
+		if err != nil {
+			return nil, err
+		}
+		after, err := rawFields(r.After)
+		if err != nil {
+			return nil, err
+		}
+		for key := range after {
+			if _, ok := before[key]; !ok {
+				delete(state, key)
+			}
+		}
+		for key, value := range before {
+			state[key] = value
+		}
+	}
+
+	data, err := document(state)
+	if err != nil {
+		return nil, err
+	}
+	var result models.Transaction
+	if data != nil {
+		if err := bson.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+	}
+	result.ID = current.ID
+	result.UserID = current.UserID
+	return &result, nil
+}
+
+// rawFields разбирает документ изменённых полей ревизии.
+func rawFields(data bson.Raw) (map[string]bson.RawValue, error) {
+	result := map[string]bson.RawValue{}
+	if len(data) == 0 {
+		return result, nil
+	}
+	elements, err := data.Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		result[element.Key()] = element.Value()
+	}
+	return result, nil
+}
+
+// Entry — ревизия для ответа API: изменённые поля в том же виде, что и у транзакции.
+type Entry struct {
+	models.Revision
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// Entries готовит ревизии для ответа API.
+func Entries(list []models.Revision) ([]Entry, error) {
+	entries := make([]Entry, len(list))
+	for i, r := range list {
+		before, err := plainFields(r.Before)
+		if err != nil {
+			return nil, err
+		}
+		after, err := plainFields(r.After)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = Entry{Revision: r, Before: before, After: after}
+	}
+	return entries, nil
+}
+
+// plainFields разбирает документ изменённых полей в значения, которые сериализуются в JSON как поля транзакции.
+func plainFields(data bson.Raw) (map[string]interface{}, error) {
+	values, err := rawFields(data)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		var decoded interface{}
+		if err := value.Unmarshal(&decoded); err != nil {
+			return nil, err
+		}
+		result[key] = plain(decoded)
+	}
+	return result, nil
+}
+
+// plain заменяет вложенные документы картами, а Decimal128 — суммами, чтобы они выводились числами.
+func plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.D:
+		result := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			result[e.Key] = plain(e.Value)
+		}
+		return result
+	case primitive.M:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = plain(item)
+		}
+		return result
+	case primitive.A:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = plain(item)
+		}
+		return result
+	case primitive.Decimal128:
+		if amount, err := money.Parse(v.String()); err == nil {
+			return amount
+		}
+	}
+	return value
+}
@@ -0,0 +1,226 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Заголовки запроса и ответа.
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed" // true — ответ повторён из сохранённого
+)
+
+// maxKeyLength — ограничение длины ключа.
+const maxKeyLength = 255
+
+// pendingTimeout — через сколько незавершённый запрос считается прерванным, например падением сервера,
+// и ключ можно занять заново.
+const pendingTimeout = 5 * time.Minute
+
+// TTL — сколько хранится ключ и ответ на запрос. Задаётся при запуске из IDEMPOTENCY_TTL_HOURS.
+var TTL = 24 * time.Hour
+
+// replayedHeaders — заголовки ответа, которые сохраняются вместе с телом.
+var replayedHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// requestHash возвращает SHA-256 метода, адреса с параметрами и тела запроса.
+// Тело multipart/form-data хешируется по разобранной форме: при повторе клиент может выбрать другую границу частей.
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.OriginalURL()))
+	hash.Write([]byte{0})
+	if !strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) || !hashForm(hash, c) {
+		hash.Write(c.Body())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// hashForm пишет в hash поля формы по именам с их значениями, затем файлы: имя поля, имя файла и SHA-256 содержимого.
+// false — форму не удалось разобрать, тогда хешируется тело как есть.
+func hashForm(hash io.Writer, c *fiber.Ctx) bool {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return false
+	}
+	write := func(values ...string) {
+		for _, value := range values {
+			hash.Write([]byte(value))
+			hash.Write([]byte{0})
+		}
+	}
+
+	names := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write("value", name)
+		write(form.Value[name]...)
+	}
+
+	names = names[:0]
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, header := range form.File[name] {
+			content := sha256.New()
+			file, err := header.Open()
+			if err != nil {
+				return false
+			}
+			_, err = io.Copy(content, file)
+			file.Close()
+			if err != nil {
+				return false
+			}
+			write("file", name, header.Filename, hex.EncodeToString(content.Sum(nil)))
+		}
+	}
+	return true
+}
+
+// acquire занимает ключ под новый запрос. Если ключ уже занят, возвращает существующую запись и false.
+// Просроченные записи, которые ещё не удалил TTL-индекс, и прерванные запросы освобождают ключ.
+func acquire(ctx context.Context, record models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := database.IdempotencyCollection.InsertOne(ctx, record)
+		if err == nil {
+			return record, true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return models.IdempotencyKey{}, false, err
+		}
+
+		var existing models.IdempotencyKey
+		err = database.IdempotencyCollection.FindOne(ctx, bson.M{"user_id": record.UserID, "key": record.Key}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return models.IdempotencyKey{}, false, err
+		}
+		expired := existing.ExpiresAt.Time().Before(now)
+		abandoned := existing.Status == 0 && existing.CreatedAt.Time().Before(now.Add(-pendingTimeout))
+		if !expired && !abandoned {
+			return existing, false, nil
+		}
+		if _, err := database.IdempotencyCollection.DeleteOne(ctx, bson.M{"_id": existing.ID}); err != nil {
+			return models.IdempotencyKey{}, false, err
+		}
+	}
+	return models.IdempotencyKey{}, false, errors.New("не удалось занять ключ идемпотентности")
+}
+
+// release освобождает ключ, чтобы запрос можно было повторить.
+func release(ctx context.Context, id primitive.ObjectID) {
+	if _, err := database.IdempotencyCollection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		log.Printf("Ошибка освобождения ключа идемпотентности: %v\n", err)
+	}
+}
+
+// save сохраняет ответ на запрос. Если сохранить не удалось, ключ освобождается.
+func save(ctx context.Context, id primitive.ObjectID, c *fiber.Ctx) {
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := c.Response().Header.Peek(name); len(value) > 0 {
+			headers[name] = string(value)
+		}
+	}
+	update := bson.M{"$set": bson.M{
+		"status":  c.Response().StatusCode(),
+		"headers": headers,
+		"body":    append([]byte{}, c.Response().Body()...),
+	}}
+	if _, err := database.IdempotencyCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		log.Printf("Ошибка сохранения ответа по ключу идемпотентности: %v\n", err)
+		release(ctx, id)
+	}
+}
+
+// replay отправляет сохранённый ответ.
+func replay(c *fiber.Ctx, record models.IdempotencyKey) error {
+	for name, value := range record.Headers {
+		c.Set(name, value)
+	}
+	c.Set(HeaderReplayed, "true")
+	return c.Status(record.Status).Send(record.Body)
+}
+
+// Middleware делает POST-запросы с заголовком Idempotency-Key идемпотентными. Ответ на первый запрос
+// сохраняется на TTL, повтор с тем же ключом и тем же телом получает сохранённый ответ без повторного выполнения.
+// Тот же ключ с другим методом, адресом или телом — 422, повтор во время выполнения первого запроса — 409.
+// Ответы 5xx не сохраняются: запрос можно повторить с тем же ключом.
+// Подключается после JWTMiddleware: ключи хранятся отдельно для каждого пользователя.
+func Middleware(c *fiber.Ctx) error {
+	if c.Method() != fiber.MethodPost {
+		return c.Next()
+	}
+	key := c.Get(HeaderKey)
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > maxKeyLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Заголовок Idempotency-Key длиннее 255 символов"})
+	}
+	userID, _ := c.Locals("userID").(string)
+	owner, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		// Без пользователя запрос отклонит сам обработчик
+		return c.Next()
+	}
+
+	now := time.Now()
+	hash := requestHash(c)
+	record, acquired, err := acquire(context.Background(), models.IdempotencyKey{
+		ID:          primitive.NewObjectID(),
+		UserID:      owner,
+		Key:         key,
+		RequestHash: hash,
+		CreatedAt:   primitive.NewDateTimeFromTime(now),
+		ExpiresAt:   primitive.NewDateTimeFromTime(now.Add(TTL)),
+	})
+	if err != nil {
+		log.Printf("Ошибка проверки ключа идемпотентности: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить ключ идемпотентности"})
+	}
+	if !acquired {
+		if record.RequestHash != hash {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Ключ Idempotency-Key уже использован для другого запроса"})
+		}
+		if record.Status == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Запрос с этим ключом Idempotency-Key ещё выполняется"})
+		}
+		return replay(c, record)
+	}
+
+	if err := c.Next(); err != nil {
+		release(context.Background(), record.ID)
+		return err
+	}
+	if c.Response().StatusCode() >= fiber.StatusInternalServerError {
+		release(context.Background(), record.ID)
+		return nil
+	}
+	save(context.Background(), record.ID, c)
+	return nil
+}
@@ -0,0 +1,393 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/attachments"
+	"github.com/IIkar/WealFlow/2025/auth"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/rules"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// Row — строка выписки в предпросмотре: транзакция, которая будет создана, или ошибки проверки.
+type Row struct {
+	Line        int                `json:"line"` // Номер строки в файле с 1, для OFX — порядковый номер операции
+	Transaction models.Transaction `json:"transaction"`
+	Duplicate   bool               `json:"duplicate,omitempty"` // Операция с таким external_id уже есть на счёте и не будет создана
+	Errors      []string           `json:"errors,omitempty"`
+}
+
+// Preview — результат разбора выписки. Batch заполнен, если импорт подтверждён и транзакции созданы.
+type Preview struct {
+	Total      int                 `json:"total"`
+	Valid      int                 `json:"valid"`
+	Invalid    int                 `json:"invalid"`
+	Duplicates int                 `json:"duplicates"`
+	Rows       []Row               `json:"rows"`
+	Batch      *models.ImportBatch `json:"batch,omitempty"`
+
+	PossibleDuplicates int `json:"possible_duplicates"` // Строки, похожие на уже сохранённые транзакции: создаются с пометкой possible_duplicate_of
+}
+
+// target — куда загружается выписка: данные пользователя, загруженные один раз на весь файл.
+type target struct {
+	userID          primitive.ObjectID
+	account         *models.Account // nil — операции без счёта
+	baseCurrency    string
+	defaultCategory string
+	tree            *categories.Tree
+	rules           *rules.Engine
+}
+
+// loadTarget проверяет счёт и категорию по умолчанию и загружает категории пользователя.
+func loadTarget(ctx context.Context, userID primitive.ObjectID, accountID string, defaultCategory string) (*target, error) {
+	t := &target{userID: userID, defaultCategory: defaultCategory}
+
+	if accountID != "" {
+		objectID, err := primitive.ObjectIDFromHex(accountID)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Неверный формат 'account_id'")
+		}
+		t.account, err = accounts.Find(ctx, userID, objectID)
+		if err != nil {
+			return nil, fmt.Errorf("проверка счёта: %w", err)
+		}
+		if t.account == nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Счёт не найден")
+		}
+	}
+
+	var err error
+	if t.baseCurrency, err = auth.BaseCurrency(ctx, userID); err != nil {
+		return nil, fmt.Errorf("получение базовой валюты: %w", err)
+	}
+	if err = categories.EnsureDefaults(ctx, userID); err != nil {
+		return nil, fmt.Errorf("создание категорий по умолчанию: %w", err)
+	}
+	if t.tree, err = categories.LoadTree(ctx, userID); err != nil {
+		return nil, fmt.Errorf("загрузка категорий: %w", err)
+	}
+	if t.rules, err = rules.Load(ctx, userID); err != nil {
+		return nil, fmt.Errorf("загрузка правил: %w", err)
+	}
+	if defaultCategory != "" && !t.tree.Has(defaultCategory) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Категория по умолчанию '"+defaultCategory+"' не найдена")
+	}
+	return t, nil
+}
+
+// category выбирает категорию операции: категорию по правилам пользователя, затем категорию из файла,
+// если она есть у пользователя, затем соответствующую ей категорию WealFlow из пресета, затем категорию по умолчанию.
+func (t *target) category(e entry, ruled string) (string, bool) {
+	for _, name := range []string{ruled, e.Category, e.CategoryAlias, t.defaultCategory} {
+		if name != "" && t.tree.Has(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// row проверяет операцию из файла по тем же правилам, что transactions.Validate для новой транзакции.
+func (t *target) row(e entry) Row {
+	r := Row{Line: e.Line, Errors: e.Errors}
+	tx := &r.Transaction
+	tx.UserID = t.userID
+	tx.Description = e.Description
+	tx.Category = e.Category
+	tx.Currency = e.Currency
+	tx.Type = e.Amount.IsPositive()
+	tx.Amount = e.Amount.Abs()
+	tx.ExternalID = e.ExternalID
+	if !e.Date.IsZero() {
+		tx.Date = primitive.NewDateTimeFromTime(e.Date)
+	}
+
+	if tx.Description == "" {
+		r.Errors = append(r.Errors, "Пустое описание")
+	}
+	// Правила задают категорию и теги; счёт у загрузки один, поэтому счёт правил не применяется
+	ruled := t.rules.Evaluate(*tx)
+	tx.Tags = ruled.Tags
+	if category, ok := t.category(e, ruled.Category); ok {
+		tx.Category = category
+	} else if tx.Category == "" {
+		r.Errors = append(r.Errors, "Нет категории: укажите колонку категории или категорию по умолчанию")
+	} else {
+		r.Errors = append(r.Errors, "Категория '"+tx.Category+"' не найдена")
+	}
+
+	if t.account != nil {
+		tx.AccountID = t.accountID()
+		if tx.Currency == "" {
+			tx.Currency = t.account.Currency
+		}
+		if tx.Currency != t.account.Currency {
+			r.Errors = append(r.Errors, "Валюта "+tx.Currency+" не совпадает с валютой счёта ("+t.account.Currency+")")
+		}
+	}
+	if tx.Currency == "" {
+		tx.Currency = t.baseCurrency
+	}
+	if !money.ValidCurrency(tx.Currency) {
+		r.Errors = append(r.Errors, "Некорректный код валюты '"+tx.Currency+"'")
+	}
+
+	tx.Amount = tx.Amount.Round(tx.Currency)
+	if e.Errors == nil && !tx.Amount.IsPositive() {
+		r.Errors = append(r.Errors, "Нулевая сумма")
+	}
+	return r
+}
+
+// accountID возвращает счёт загрузки или nil, если операции загружаются без счёта.
+func (t *target) accountID() *primitive.ObjectID {
+	if t.account == nil {
+		return nil
+	}
+	return &t.account.ID
+}
+
+// imported возвращает external_id из ids, которые уже есть на счёте загрузки.
+func (t *target) imported(ctx context.Context, ids []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(ids) == 0 {
+		return existing, nil
+	}
+	// account_id: null совпадает и с операциями без счёта
+	filter := bson.M{"user_id": t.userID, "account_id": t.accountID(), "external_id": bson.M{"$in": ids}}
+	values, err := database.TransactionsCollection.Distinct(ctx, "external_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+// preview проверяет все операции файла. Операции, уже импортированные по external_id,
+// а также повторы внутри файла помечаются как дубликаты.
+func (t *target) preview(ctx context.Context, entries []entry) (Preview, error) {
+	var ids []string
+	for _, e := range entries {
+		if e.ExternalID != "" {
+			ids = append(ids, e.ExternalID)
+		}
+	}
+	seen, err := t.imported(ctx, ids)
+	if err != nil {
+		return Preview{}, fmt.Errorf("поиск импортированных операций: %w", err)
+	}
+
+	p := Preview{Total: len(entries), Rows: make([]Row, 0, len(entries))}
+	for _, e := range entries {
+		r := t.row(e)
+		if e.ExternalID != "" {
+			r.Duplicate = seen[e.ExternalID]
+			seen[e.ExternalID] = true
+		}
+		switch {
+		case len(r.Errors) > 0:
+			p.Invalid++
+		case r.Duplicate:
+			p.Duplicates++
+		default:
+			p.Valid++
+		}
+		p.Rows = append(p.Rows, r)
+	}
+
+	if err := t.markDuplicates(ctx, &p); err != nil {
+		return Preview{}, fmt.Errorf("поиск дублей: %w", err)
+	}
+	return p, nil
+}
+
+// markDuplicates помечает новые строки, похожие на уже сохранённые транзакции счёта.
+// Строки одного файла друг с другом не сравниваются: две одинаковые покупки за день — обычное дело.
+func (t *target) markDuplicates(ctx context.Context, p *Preview) error {
+	var from, to time.Time
+	for _, r := range p.Rows {
+		if len(r.Errors) > 0 || r.Duplicate {
+			continue
+		}
+		date := r.Transaction.Date.Time()
+		if from.IsZero() || date.Before(from) {
+			from = date
+		}
+		if to.IsZero() || date.After(to) {
+			to = date
+		}
+	}
+	if from.IsZero() {
+		return nil
+	}
+
+	finder, err := transactions.NewDuplicateFinder(ctx, t.userID, t.accountID(), from, to)
+	if err != nil {
+		return err
+	}
+	for i := range p.Rows {
+		r := &p.Rows[i]
+		if len(r.Errors) > 0 || r.Duplicate {
+			continue
+		}
+		if r.Transaction.PossibleDuplicateOf = finder.Find(r.Transaction); r.Transaction.PossibleDuplicateOf != nil {
+			p.PossibleDuplicates++
+		}
+	}
+	return nil
+}
+
+// commitChunk — сколько транзакций загрузки создаётся в одной транзакции MongoDB: выписка за несколько лет
+// не укладывается в ограничения транзакции по времени и размеру.
+const commitChunk = 1000
+
+// commit создаёт загрузку, затем её транзакции частями по commitChunk. Строки с ошибками и дубликаты пропускаются.
+// Если часть не записалась, уже созданные транзакции откатываются вместе с загрузкой.
+// Созданным транзакциям присваиваются ID, загрузка записывается в p.Batch.
+func (t *target) commit(ctx context.Context, p *Preview, source string, fileName string) error {
+	batch := models.ImportBatch{
+		ID:        primitive.NewObjectID(),
+		UserID:    t.userID,
+		Source:    source,
+		FileName:  fileName,
+		AccountID: t.accountID(),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	var documents []interface{}
+	var changes []history.Change
+	for i := range p.Rows {
+		if len(p.Rows[i].Errors) > 0 || p.Rows[i].Duplicate {
+			continue
+		}
+		tx := &p.Rows[i].Transaction
+		tx.ID = primitive.NewObjectID()
+		tx.ImportID = &batch.ID
+		documents = append(documents, *tx)
+		changes = append(changes, history.Change{After: tx})
+	}
+	if len(documents) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "В файле нет новых строк без ошибок")
+	}
+	batch.Count = len(documents)
+
+	// Загрузка создаётся первой: по её import_id откатывается и частично записанный импорт
+	if _, err := database.ImportsCollection.InsertOne(ctx, batch); err != nil {
+		return err
+	}
+	var err error
+	for start := 0; start < len(documents) && err == nil; start += commitChunk {
+		end := min(start+commitChunk, len(documents))
+		_, err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			if _, err := database.TransactionsCollection.InsertMany(sessCtx, documents[start:end]); err != nil {
+				return nil, err
+			}
+			return nil, history.Record(sessCtx, history.By(t.userID, history.SourceImport), history.ActionCreate, changes[start:end]...)
+		})
+	}
+	if err != nil {
+		if _, rollbackErr := rollback(ctx, t.userID, batch.ID); rollbackErr != nil {
+			log.Printf("Ошибка отката незавершённой загрузки %s: %v\n", batch.ID.Hex(), rollbackErr)
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		// Те же операции успели импортировать параллельным запросом
+		return fiber.NewError(fiber.StatusConflict, "Часть операций уже импортирована: повторите предпросмотр")
+	}
+	if err != nil {
+		return err
+	}
+	p.Batch = &batch
+
+	// Модель подсказок категорий учится на импортированных операциях
+	learned := make([]models.Transaction, len(documents))
+	for i, document := range documents {
+		learned[i] = document.(models.Transaction)
+	}
+	if err := suggest.Learn(ctx, t.userID, learned...); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
+	return nil
+}
+
+// rollback удаляет загрузку вместе со всеми её транзакциями, в том числе изменёнными после импорта.
+// Возвращает число удалённых транзакций.
+func rollback(ctx context.Context, userID primitive.ObjectID, batchID primitive.ObjectID) (int64, error) {
+	var removedIDs []primitive.ObjectID
+	deleted, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		result, err := database.ImportsCollection.DeleteOne(sessCtx, bson.M{"_id": batchID, "user_id": userID})
+		if err != nil {
+			return nil, err
+		}
+		if result.DeletedCount == 0 {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Загрузка не найдена")
+		}
+		cursor, err := database.TransactionsCollection.Find(sessCtx, bson.M{"user_id": userID, "import_id": batchID})
+		if err != nil {
+			return nil, err
+		}
+		var removed []models.Transaction
+		if err := cursor.All(sessCtx, &removed); err != nil {
+			return nil, err
+		}
+		removedIDs = make([]primitive.ObjectID, len(removed))
+		changes := make([]history.Change, len(removed))
+		for i := range removed {
+			removedIDs[i] = removed[i].ID
+			changes[i] = history.Change{Before: &removed[i]}
+		}
+		// Транзакции, помеченные как дубли удаляемых, перестают быть дублями
+		if err := transactions.ClearDuplicateRefs(sessCtx, history.By(userID, history.SourceImport), userID, removedIDs); err != nil {
+			return nil, err
+		}
+		result, err = database.TransactionsCollection.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$in": removedIDs}})
+		if err != nil {
+			return nil, err
+		}
+		if err := history.Record(sessCtx, history.By(userID, history.SourceImport), history.ActionDelete, changes...); err != nil {
+			return nil, err
+		}
+		// Удалённые ранее транзакции загрузки уходят из корзины: восстанавливать их некуда
+		trashed, err := database.TrashCollection.Distinct(sessCtx, "_id", bson.M{"user_id": userID, "import_id": batchID})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range trashed {
+			if objectID, ok := id.(primitive.ObjectID); ok {
+				removedIDs = append(removedIDs, objectID)
+			}
+		}
+		if _, err := database.TrashCollection.DeleteMany(sessCtx, bson.M{"user_id": userID, "import_id": batchID}); err != nil {
+			return nil, err
+		}
+		return result.DeletedCount, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := attachments.Remove(ctx, userID, removedIDs); err != nil {
+		log.Printf("Ошибка удаления вложений загрузки: %v\n", err)
+	}
+	// Удалённые операции проще не вычитать по одной, а обучить подсказки заново
+	if err := suggest.Reset(ctx, userID); err != nil {
+		log.Printf("Ошибка сброса подсказок категорий: %v\n", err)
+	}
+	return deleted.(int64), nil
+}
@@ -0,0 +1,378 @@
+package imports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/money"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Mapping — соответствие полей транзакции колонкам файла. Колонка задаётся именем из строки
+// заголовка или номером, начиная с 1. Сумма берётся либо из одной колонки со знаком (amount),
+// либо из отдельных колонок поступлений и списаний (income и expense).
+type Mapping struct {
+	Date        string `json:"date"`
+	Amount      string `json:"amount"`  // Сумма со знаком: отрицательная — расход
+	Income      string `json:"income"`  // Сумма поступления
+	Expense     string `json:"expense"` // Сумма списания, знак не важен
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Currency    string `json:"currency"`
+}
+
+// CSVOptions — параметры разбора CSV-выписки.
+type CSVOptions struct {
+	Mapping          Mapping
+	DateFormat       string         // Шаблон даты из DD, MM, YYYY, YY, HH, mm, ss, например DD.MM.YYYY
+	DecimalSeparator string         // Десятичный разделитель: "," или "."
+	Encoding         string         // utf-8 или windows-1251
+	Delimiter        rune           // Разделитель колонок; 0 — определить по строке заголовка
+	SkipRows         int            // Число строк перед заголовком (шапка выписки)
+	NoHeader         bool           // В файле нет строки заголовка, колонки задаются номерами
+	Location         *time.Location // Часовой пояс дат без смещения
+	Sign             string         // Знак суммы: minus (по умолчанию) или plus
+
+	Categories  map[string]string // Категории выписки и соответствующие им категории WealFlow (для пресетов)
+	spreadsheet bool              // Строки прочитаны из XLSX: числа с точкой, даты могут быть числами Excel
+	adjust      rowAdjuster       // Особенности формата пресета
+}
+
+// Соглашения о знаке суммы в выписке.
+const (
+	SignMinus = "minus" // Отрицательная сумма — расход
+	SignPlus  = "plus"  // Сумма со знаком + — поступление, без знака — расход (Сбербанк)
+)
+
+// rowAdjuster дорабатывает операцию по значениям колонок строки (get — по имени колонки).
+// Возвращает false, если строку нужно пропустить: отклонённые операции, переводы между своими счетами.
+type rowAdjuster func(e *entry, get func(column string) string) bool
+
+// entry — операция, прочитанная из файла, до проверки по данным пользователя.
+type entry struct {
+	Line          int       // Номер строки в файле с 1, для OFX — порядковый номер операции
+	Date          time.Time // Нулевая, если дату прочитать не удалось
+	Description   string
+	Category      string       // Пусто — категория по умолчанию
+	CategoryAlias string       // Категория WealFlow, если у пользователя нет категории Category
+	Currency      string       // Пусто — валюта счёта или базовая
+	Amount        money.Amount // Со знаком: положительная — доход, отрицательная — расход
+	ExternalID    string       // Идентификатор операции в банке, если формат его даёт
+	Errors        []string     // Ошибки разбора строки
+}
+
+// dateTokens переводит шаблон даты в layout пакета time. Длинные токены идут раньше коротких.
+var dateTokens = strings.NewReplacer(
+	"YYYY", "2006",
+	"YY", "06",
+	"DD", "02",
+	"MM", "01",
+	"HH", "15",
+	"mm", "04",
+	"ss", "05",
+)
+
+// decode переводит содержимое файла в UTF-8 и убирает метку порядка байтов.
+func decode(data []byte, encoding string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(encoding, "_", "-")) {
+	case "", "utf-8", "utf8":
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		if !utf8.Valid(data) {
+			return "", errors.New("Файл не в кодировке UTF-8; укажите encoding=windows-1251")
+		}
+		return string(data), nil
+	case "windows-1251", "cp1251":
+		decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+		if err != nil {
+			return "", errors.New("Не удалось прочитать файл в кодировке windows-1251")
+		}
+		return string(decoded), nil
+	}
+	return "", errors.New("Параметр 'encoding' должен быть utf-8 или windows-1251")
+}
+
+// parseDate разбирает дату по layout. Если в строке есть ещё и время, а в шаблоне нет,
+// время учитывается: банки часто пишут «01.02.2025 14:30» в колонке даты.
+func parseDate(value string, layout string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, candidate := range []string{layout, layout + " 15:04:05", layout + " 15:04"} {
+		if t, err := time.ParseInLocation(candidate, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("дата %q не соответствует формату", value)
+}
+
+// parseAmount разбирает сумму с заданным десятичным разделителем.
+// Пробелы и второй разделитель считаются разделителями разрядов: «1 234,56» и «1.234,56» — одно и то же.
+func parseAmount(value string, decimalSeparator string) (money.Amount, error) {
+	cleaned := strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", "\u2212", "-", "+", "").Replace(strings.TrimSpace(value))
+	if decimalSeparator == "," {
+		cleaned = strings.ReplaceAll(strings.ReplaceAll(cleaned, ".", ""), ",", ".")
+	} else {
+		cleaned = strings.ReplaceAll(cleaned, ",", "")
+	}
+	return money.Parse(cleaned)
+}
+
+// detectDelimiter выбирает разделитель колонок, которого больше всего в строке заголовка.
+func detectDelimiter(line string) rune {
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{';', ',', '\t'} {
+		if count := strings.Count(line, string(candidate)); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+// columnIndex находит колонку по имени из заголовка или по номеру с 1. Пустая ссылка — колонка не задана (-1).
+func columnIndex(ref string, header []string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), ref) {
+			return i, nil
+		}
+	}
+	if number, err := strconv.Atoi(ref); err == nil && number > 0 {
+		return number - 1, nil
+	}
+	return -1, fmt.Errorf("Колонка %q не найдена в файле", ref)
+}
+
+// columns — номера колонок полей транзакции, -1 для незаданных.
+type columns struct {
+	date, amount, income, expense, description, category, currency int
+}
+
+// resolveColumns сопоставляет Mapping с заголовком файла.
+func resolveColumns(mapping Mapping, header []string) (columns, error) {
+	var cols columns
+	targets := []struct {
+		ref   string
+		index *int
+	}{
+		{mapping.Date, &cols.date},
+		{mapping.Amount, &cols.amount},
+		{mapping.Income, &cols.income},
+		{mapping.Expense, &cols.expense},
+		{mapping.Description, &cols.description},
+		{mapping.Category, &cols.category},
+		{mapping.Currency, &cols.currency},
+	}
+	for _, target := range targets {
+		index, err := columnIndex(target.ref, header)
+		if err != nil {
+			return cols, err
+		}
+		*target.index = index
+	}
+
+	if cols.date < 0 {
+		return cols, errors.New("В сопоставлении колонок обязательно поле 'date'")
+	}
+	if cols.amount < 0 && cols.income < 0 && cols.expense < 0 {
+		return cols, errors.New("В сопоставлении колонок укажите 'amount' или 'income' и 'expense'")
+	}
+	if cols.amount >= 0 && (cols.income >= 0 || cols.expense >= 0) {
+		return cols, errors.New("Укажите либо 'amount', либо 'income' и 'expense', но не всё сразу")
+	}
+	return cols, nil
+}
+
+// cell возвращает значение колонки или пустую строку, если колонки нет в записи.
+func cell(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// blank сообщает, что в записи нет ни одного непустого значения.
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// record — строка таблицы выписки с номером строки в файле.
+type record struct {
+	line   int
+	fields []string
+}
+
+// parseCSV читает выписку. Ошибка возвращается, если файл нельзя разобрать целиком
+// (кодировка, сопоставление колонок); ошибки отдельных строк попадают в entry.Errors.
+func parseCSV(data []byte, opts CSVOptions) ([]entry, error) {
+	header, records, err := readCSV(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(header, records, opts)
+}
+
+// readCSV декодирует файл и разбивает его на заголовок и строки.
+func readCSV(data []byte, opts CSVOptions) ([]string, []record, error) {
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Шапку выписки пропускаем до разбора CSV: в ней бывают произвольные кавычки
+	lines := strings.SplitN(text, "\n", opts.SkipRows+1)
+	if len(lines) <= opts.SkipRows {
+		return nil, nil, errors.New("В файле нет строк после пропущенных")
+	}
+	text = lines[opts.SkipRows]
+
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		firstLine, _, _ := strings.Cut(text, "\n")
+		delimiter = detectDelimiter(firstLine)
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var header []string
+	if !opts.NoHeader {
+		header, err = reader.Read()
+		if err == io.EOF {
+			return nil, nil, errors.New("Файл пуст")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Не удалось прочитать заголовок: %v", err)
+		}
+	}
+
+	var records []record
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Ошибка чтения CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record{line: line + opts.SkipRows, fields: fields})
+	}
+	return header, records, nil
+}
+
+// amount разбирает сумму с учётом знака, принятого в выписке.
+func (opts CSVOptions) amount(value string) (money.Amount, error) {
+	separator := opts.DecimalSeparator
+	if opts.spreadsheet {
+		// В таблицах числа приходят с точкой, а текстовые ячейки — как их ввёл банк
+		value, separator = pointDecimal(value), "."
+	}
+	amount, err := parseAmount(value, separator)
+	if err != nil {
+		return money.Zero, err
+	}
+	if opts.Sign == SignPlus {
+		if strings.HasPrefix(strings.TrimSpace(value), "+") {
+			return amount.Abs(), nil
+		}
+		return amount.Abs().Neg(), nil
+	}
+	return amount, nil
+}
+
+// date разбирает дату по шаблону; в таблицах дата может быть и числом Excel.
+func (opts CSVOptions) date(value string, layout string) (time.Time, error) {
+	t, err := parseDate(value, layout, opts.Location)
+	if err != nil && opts.spreadsheet {
+		if serial, ok := excelDate(value, opts.Location); ok {
+			return serial, nil
+		}
+	}
+	return t, err
+}
+
+// parseRecords переводит строки таблицы в операции по сопоставлению колонок.
+func parseRecords(header []string, records []record, opts CSVOptions) ([]entry, error) {
+	cols, err := resolveColumns(opts.Mapping, header)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := opts.DateFormat
+	if !strings.Contains(layout, "2006") {
+		layout = dateTokens.Replace(layout)
+	}
+
+	var entries []entry
+	for _, r := range records {
+		if blank(r.fields) {
+			continue
+		}
+		e := entry{
+			Line:        r.line,
+			Description: cell(r.fields, cols.description),
+			Category:    cell(r.fields, cols.category),
+			Currency:    strings.ToUpper(cell(r.fields, cols.currency)),
+		}
+
+		if value := cell(r.fields, cols.date); value == "" {
+			e.Errors = append(e.Errors, "Пустая дата")
+		} else if e.Date, err = opts.date(value, layout); err != nil {
+			e.Errors = append(e.Errors, "Некорректная "+err.Error())
+		}
+
+		if cols.amount >= 0 {
+			if e.Amount, err = opts.amount(cell(r.fields, cols.amount)); err != nil {
+				e.Errors = append(e.Errors, "Некорректная сумма в колонке суммы")
+			}
+		} else {
+			// Из двух колонок заполнена обычно одна; пустая считается нулём
+			income, expense := money.Zero, money.Zero
+			if value := cell(r.fields, cols.income); value != "" {
+				if income, err = opts.amount(value); err != nil {
+					e.Errors = append(e.Errors, "Некорректная сумма в колонке поступлений")
+				}
+			}
+			if value := cell(r.fields, cols.expense); value != "" {
+				if expense, err = opts.amount(value); err != nil {
+					e.Errors = append(e.Errors, "Некорректная сумма в колонке списаний")
+				}
+			}
+			e.Amount = income.Abs().Sub(expense.Abs())
+		}
+
+		if opts.adjust != nil {
+			fields := r.fields
+			get := func(column string) string {
+				index, err := columnIndex(column, header)
+				if err != nil {
+					return ""
+				}
+				return cell(fields, index)
+			}
+			if !opts.adjust(&e, get) {
+				continue
+			}
+		}
+		if e.CategoryAlias == "" {
+			e.CategoryAlias = opts.Categories[e.Category]
+		}
+
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
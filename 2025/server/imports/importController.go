@@ -0,0 +1,451 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// readUpload читает загруженный файл из поля file формы multipart/form-data.
+func readUpload(c *fiber.Ctx) ([]byte, string, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, "Загрузите файл выписки в поле 'file'")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, header.Filename, nil
+}
+
+// formBool читает флаг формы: true, 1 или on.
+func formBool(c *fiber.Ctx, key string, defaultValue bool) (bool, error) {
+	value := c.FormValue(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	if value == "on" {
+		return true, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("Параметр '" + key + "' должен быть true или false")
+	}
+	return parsed, nil
+}
+
+// formLocation читает часовой пояс дат из поля tz; по умолчанию UTC.
+func formLocation(c *fiber.Ctx) (*time.Location, error) {
+	tz := c.FormValue("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("Неизвестный часовой пояс в параметре 'tz'")
+	}
+	return loc, nil
+}
+
+// finish проверяет разобранные операции и либо возвращает предпросмотр, либо, если передан confirm=true,
+// создаёт загрузку. По умолчанию строки с ошибками не дают подтвердить импорт; skip_invalid=true пропускает их.
+func finish(c *fiber.Ctx, userID primitive.ObjectID, entries []entry, source string, fileName string) error {
+	confirm, err := formBool(c, "confirm", false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	skipInvalid, err := formBool(c, "skip_invalid", false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	t, err := loadTarget(context.Background(), userID, c.FormValue("account_id"), c.FormValue("default_category"))
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить выписку")
+	}
+
+	preview, err := t.preview(context.Background(), entries)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить выписку")
+	}
+	if !confirm {
+		return c.JSON(preview)
+	}
+	if preview.Invalid > 0 && !skipInvalid {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":   "В выписке есть строки с ошибками: исправьте файл или передайте skip_invalid=true",
+			"preview": preview,
+		})
+	}
+
+	if err := t.commit(context.Background(), &preview, source, fileName); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось импортировать выписку")
+	}
+	return c.Status(fiber.StatusCreated).JSON(preview)
+}
+
+// ImportCSV godoc
+// @Summary Импорт банковской выписки в CSV или XLSX
+// @Description Разбирает CSV (или первый лист XLSX) по сопоставлению колонок и возвращает предпросмотр с ошибками по строкам. С confirm=true создаёт транзакции одной загрузкой,
+// @Description которую можно откатить целиком через DELETE /api/import/batches/{id}. Пример mapping: {"date":"Дата операции","amount":"Сумма","description":"Описание"}.
+// @Tags import
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Файл выписки CSV или XLSX"
+// @Param mapping formData string true "Сопоставление колонок (JSON): date, amount или income и expense, description, category, currency — имя колонки или номер с 1"
+// @Param date_format formData string false "Формат даты из DD, MM, YYYY, YY, HH, mm, ss (по умолчанию DD.MM.YYYY)"
+// @Param decimal_separator formData string false "Десятичный разделитель: , или . (по умолчанию ,)"
+// @Param encoding formData string false "Кодировка: utf-8 или windows-1251 (по умолчанию utf-8)"
+// @Param delimiter formData string false "Разделитель колонок: ; , или tab (по умолчанию определяется по заголовку)"
+// @Param sign formData string false "Знак суммы: minus — отрицательная сумма расход (по умолчанию), plus — поступления со знаком +, списания без знака"
+// @Param skip_rows formData int false "Число строк шапки перед заголовком"
+// @Param has_header formData bool false "Есть ли строка заголовка (по умолчанию true)"
+// @Param tz formData string false "Часовой пояс IANA для дат (по умолчанию UTC)"
+// @Param account_id formData string false "Счёт, на который загружаются операции"
+// @Param default_category formData string false "Категория для строк без категории или с неизвестной категорией"
+// @Param confirm formData bool false "Создать транзакции (по умолчанию только предпросмотр)"
+// @Param skip_invalid formData bool false "При подтверждении пропустить строки с ошибками"
+// @Success 200 {object} Preview
+// @Success 201 {object} Preview
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/import/csv [post]
+func ImportCSV(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	opts := CSVOptions{
+		DateFormat:       c.FormValue("date_format", "DD.MM.YYYY"),
+		DecimalSeparator: c.FormValue("decimal_separator", ","),
+		Encoding:         c.FormValue("encoding"),
+	}
+	if err := json.Unmarshal([]byte(c.FormValue("mapping")), &opts.Mapping); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'mapping' должен быть JSON-объектом с колонками"})
+	}
+	if opts.DecimalSeparator != "," && opts.DecimalSeparator != "." {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'decimal_separator' должен быть , или ."})
+	}
+	switch delimiter := c.FormValue("delimiter"); delimiter {
+	case "":
+	case "tab", "\t":
+		opts.Delimiter = '\t'
+	case ";", ",", "|":
+		opts.Delimiter = rune(delimiter[0])
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'delimiter' должен быть ; , | или tab"})
+	}
+	if value := c.FormValue("skip_rows"); value != "" {
+		if opts.SkipRows, err = strconv.Atoi(value); err != nil || opts.SkipRows < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'skip_rows' должен быть неотрицательным числом"})
+		}
+	}
+	hasHeader, err := formBool(c, "has_header", true)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts.NoHeader = !hasHeader
+	switch opts.Sign = c.FormValue("sign", SignMinus); opts.Sign {
+	case SignMinus, SignPlus:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'sign' должен быть minus или plus"})
+	}
+	if opts.Location, err = formLocation(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	data, fileName, err := readUpload(c)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось прочитать файл")
+	}
+	source, parse := "csv", parseCSV
+	if isXLSX(data) {
+		source, parse = "xlsx", parseXLSX
+	}
+	entries, err := parse(data, opts)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return finish(c, userID, entries, source, fileName)
+}
+
+// GetPresets godoc
+// @Summary Получить пресеты импорта
+// @Description Готовые настройки для выгрузок Т-Банка, Сбербанка, Альфа-Банка, ZenMoney и CoinKeeper.
+// @Tags import
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} Preset
+// @Failure 401 {object} map[string]string
+// @Router /api/import/presets [get]
+func GetPresets(c *fiber.Ctx) error {
+	return c.JSON(presets)
+}
+
+// GetPresetSample godoc
+// @Summary Скачать пример выгрузки для пресета
+// @Tags import
+// @Security ApiKeyAuth
+// @Produce text/csv
+// @Param name path string true "Имя пресета"
+// @Success 200 {file} file
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/import/presets/{name}/sample [get]
+func GetPresetSample(c *fiber.Ctx) error {
+	preset, ok := findPreset(c.Params("name"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пресет не найден"})
+	}
+	data, err := samples.ReadFile("samples/" + preset.Sample)
+	if err != nil {
+		log.Printf("Ошибка чтения примера пресета %s: %v\n", preset.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить пример"})
+	}
+	c.Attachment(preset.Sample)
+	return c.Send(data)
+}
+
+// ImportPreset godoc
+// @Summary Импорт выгрузки банка или приложения по пресету
+// @Description Колонки, формат дат, знак суммы и кодировка берутся из пресета; категории выгрузки сопоставляются с категориями по умолчанию.
+// @Description Категория выгрузки используется как есть, если она есть у пользователя. С confirm=true создаёт транзакции одной загрузкой.
+// @Tags import
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param name path string true "Имя пресета: tbank, sberbank, alfabank, zenmoney, coinkeeper"
+// @Param file formData file true "Файл выгрузки CSV или XLSX"
+// @Param encoding formData string false "Кодировка CSV, если отличается от обычной для пресета"
+// @Param tz formData string false "Часовой пояс IANA для дат (по умолчанию UTC)"
+// @Param account_id formData string false "Счёт, на который загружаются операции"
+// @Param default_category formData string false "Категория для операций с неизвестной категорией"
+// @Param confirm formData bool false "Создать транзакции (по умолчанию только предпросмотр)"
+// @Param skip_invalid formData bool false "При подтверждении пропустить строки с ошибками"
+// @Success 200 {object} Preview
+// @Success 201 {object} Preview
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/import/presets/{name} [post]
+func ImportPreset(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	preset, ok := findPreset(c.Params("name"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пресет не найден"})
+	}
+	loc, err := formLocation(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	data, fileName, err := readUpload(c)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось прочитать файл")
+	}
+	entries, format, err := preset.parse(data, c.FormValue("encoding"), loc)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return finish(c, userID, entries, preset.Name+"/"+format, fileName)
+}
+
+// ImportOFX godoc
+// @Summary Импорт банковской выписки OFX или QFX
+// @Description Разбирает операции выписки OFX 1.x (SGML) или 2.x (XML) и возвращает предпросмотр. FITID операции сохраняется в external_id:
+// @Description уже импортированные на этот счёт операции помечаются duplicate и не создаются повторно. С confirm=true создаёт транзакции одной загрузкой.
+// @Tags import
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Файл .ofx или .qfx"
+// @Param encoding formData string false "Кодировка: utf-8 или windows-1251 (по умолчанию из заголовка файла)"
+// @Param tz formData string false "Часовой пояс IANA для дат без смещения (по умолчанию UTC)"
+// @Param account_id formData string false "Счёт, на который загружаются операции"
+// @Param default_category formData string true "Категория операций: в OFX категорий нет"
+// @Param confirm formData bool false "Создать транзакции (по умолчанию только предпросмотр)"
+// @Param skip_invalid formData bool false "При подтверждении пропустить строки с ошибками"
+// @Success 200 {object} Preview
+// @Success 201 {object} Preview
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/import/ofx [post]
+func ImportOFX(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	loc, err := formLocation(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	data, fileName, err := readUpload(c)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось прочитать файл")
+	}
+	entries, err := parseOFX(data, c.FormValue("encoding"), loc)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return finish(c, userID, entries, "ofx", fileName)
+}
+
+// ImportQIF godoc
+// @Summary Импорт выписки QIF
+// @Description Разбирает операции разделов Bank, Cash, CCard, Oth A и Oth L и возвращает предпросмотр. Категория берётся из поля L
+// @Description (для «Категория:Подкатегория» — подкатегория), переводы между счетами получают категорию по умолчанию. С confirm=true создаёт транзакции одной загрузкой.
+// @Tags import
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Файл .qif"
+// @Param date_format formData string false "Формат даты из DD, MM, YYYY, YY (по умолчанию M/D/YYYY, YYYY-MM-DD или D.M.YYYY)"
+// @Param decimal_separator formData string false "Десятичный разделитель: . или , (по умолчанию .)"
+// @Param encoding formData string false "Кодировка: utf-8 или windows-1251 (по умолчанию utf-8)"
+// @Param tz formData string false "Часовой пояс IANA для дат (по умолчанию UTC)"
+// @Param account_id formData string false "Счёт, на который загружаются операции"
+// @Param default_category formData string false "Категория для операций без категории"
+// @Param confirm formData bool false "Создать транзакции (по умолчанию только предпросмотр)"
+// @Param skip_invalid formData bool false "При подтверждении пропустить строки с ошибками"
+// @Success 200 {object} Preview
+// @Success 201 {object} Preview
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/import/qif [post]
+func ImportQIF(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	opts := QIFOptions{
+		DateFormat:       c.FormValue("date_format"),
+		DecimalSeparator: c.FormValue("decimal_separator", "."),
+		Encoding:         c.FormValue("encoding"),
+	}
+	if opts.DecimalSeparator != "," && opts.DecimalSeparator != "." {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'decimal_separator' должен быть , или ."})
+	}
+	if opts.Location, err = formLocation(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	data, fileName, err := readUpload(c)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось прочитать файл")
+	}
+	entries, err := parseQIF(data, opts)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return finish(c, userID, entries, "qif", fileName)
+}
+
+// GetBatches godoc
+// @Summary Получить загрузки выписок пользователя
+// @Tags import
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.ImportBatch
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/import/batches [get]
+func GetBatches(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	cursor, err := database.ImportsCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске загрузок: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить загрузки"})
+	}
+
+	batches := []models.ImportBatch{}
+	if err := cursor.All(context.Background(), &batches); err != nil {
+		log.Printf("Ошибка декодирования загрузок: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования загрузок"})
+	}
+
+	return c.JSON(batches)
+}
+
+// DeleteBatch godoc
+// @Summary Откатить загрузку выписки
+// @Description Удаляет загрузку и все созданные ей транзакции, включая изменённые после импорта.
+// @Tags import
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID загрузки"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/import/batches/{id} [delete]
+func DeleteBatch(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	deleted, err := rollback(context.Background(), userID, objectID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось откатить загрузку")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Загрузка отменена", "deleted": deleted})
+}
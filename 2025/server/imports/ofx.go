@@ -0,0 +1,145 @@
+package imports
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ofxTag — открывающий или закрывающий тег OFX и текст после него. Подходит и для SGML (OFX 1.x),
+// где у простых элементов нет закрывающих тегов, и для XML (OFX 2.x).
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ofxDate — дата OFX: YYYYMMDD[HHMMSS[.XXX]][[смещение[:зона]]], например 20250115120000.000[-5:EST].
+var ofxDate = regexp.MustCompile(`^(\d{8})(\d{6})?(?:\.\d+)?(?:\[([+-]?\d+(?:\.\d+)?)(?::[^\]]*)?\])?$`)
+
+// ofxCharset определяет кодировку по заголовку файла: CHARSET:1251 в OFX 1.x
+// или encoding="windows-1251" в XML-объявлении OFX 2.x. Иначе — UTF-8.
+func ofxCharset(data []byte) string {
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.ToUpper(head)
+	if bytes.Contains(head, []byte("CHARSET:1251")) || bytes.Contains(head, []byte("WINDOWS-1251")) {
+		return "windows-1251"
+	}
+	return "utf-8"
+}
+
+// parseOFXDate разбирает дату OFX. Без смещения время считается в часовом поясе loc.
+func parseOFXDate(value string, loc *time.Location) (time.Time, error) {
+	match := ofxDate.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("дата %q не в формате OFX", value)
+	}
+	if match[3] != "" {
+		hours, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("смещение %q в дате OFX", match[3])
+		}
+		loc = time.FixedZone("", int(hours*3600))
+	}
+	clock := match[2]
+	if clock == "" {
+		clock = "000000"
+	}
+	return time.ParseInLocation("20060102150405", match[1]+clock, loc)
+}
+
+// pointDecimal переводит сумму в формат с точкой, если в ней нет точки: часть банков пишет десятичную запятую.
+func pointDecimal(value string) string {
+	if !strings.Contains(value, ".") {
+		return strings.Replace(value, ",", ".", 1)
+	}
+	return value
+}
+
+// describe собирает описание операции из получателя и комментария банка.
+func describe(payee string, memo string) string {
+	if memo == "" || memo == payee {
+		return payee
+	}
+	if payee == "" {
+		return memo
+	}
+	return payee + " — " + memo
+}
+
+// parseOFX читает операции (STMTTRN) банковских и карточных выписок OFX/QFX.
+// FITID операции попадает в external_id, валюта — из CURDEF выписки.
+func parseOFX(data []byte, encoding string, loc *time.Location) ([]entry, error) {
+	if encoding == "" {
+		encoding = ofxCharset(data)
+	}
+	text, err := decode(data, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return nil, errors.New("Файл не похож на OFX: нет тега <OFX>")
+	}
+
+	var entries []entry
+	var currency string
+	var fields map[string]string // поля открытой операции STMTTRN
+
+	flush := func() {
+		if fields == nil {
+			return
+		}
+		e := entry{
+			Line:        len(entries) + 1,
+			Description: describe(fields["NAME"], fields["MEMO"]),
+			Currency:    currency,
+			ExternalID:  fields["FITID"],
+		}
+
+		date := fields["DTPOSTED"]
+		if date == "" {
+			date = fields["DTUSER"]
+		}
+		if date == "" {
+			e.Errors = append(e.Errors, "Нет даты операции (DTPOSTED)")
+		} else if e.Date, err = parseOFXDate(date, loc); err != nil {
+			e.Errors = append(e.Errors, "Некорректная "+err.Error())
+		}
+
+		if e.Amount, err = parseAmount(pointDecimal(fields["TRNAMT"]), "."); err != nil {
+			e.Errors = append(e.Errors, "Некорректная сумма TRNAMT")
+		}
+
+		entries = append(entries, e)
+		fields = nil
+	}
+
+	for _, match := range ofxTag.FindAllStringSubmatch(text, -1) {
+		closing, name, value := match[1] == "/", strings.ToUpper(match[2]), strings.TrimSpace(match[3])
+		switch {
+		case name == "STMTTRN":
+			flush()
+			if !closing {
+				fields = map[string]string{}
+			}
+		case closing:
+		case name == "CURDEF":
+			currency = strings.ToUpper(value)
+		case fields != nil && value != "":
+			// NAME встречается и внутри PAYEE; берём первое значение
+			if _, ok := fields[name]; !ok {
+				fields[name] = html.UnescapeString(value)
+			}
+		}
+	}
+	flush()
+
+	if len(entries) == 0 {
+		return nil, errors.New("В файле OFX нет операций")
+	}
+	return entries, nil
+}
@@ -0,0 +1,318 @@
+package imports
+
+import (
+	"embed"
+	"errors"
+	"strings"
+	"time"
+)
+
+// samples — примеры выгрузок для каждого пресета: по ним видно, какой файл ожидается.
+//
+//go:embed samples
+var samples embed.FS
+
+// Preset — готовые настройки импорта выгрузки банка или приложения: колонки, формат дат,
+// соглашение о знаке суммы и соответствие категорий выгрузки категориям WealFlow.
+type Preset struct {
+	Name    string   `json:"name"`
+	Title   string   `json:"title"`
+	Formats []string `json:"formats"` // Поддерживаемые форматы файла: csv, xlsx
+	Sample  string   `json:"sample"`  // Файл-пример в каталоге samples
+	options CSVOptions
+}
+
+// currencyCodes — обозначения валют в выгрузках, отличающиеся от кодов ISO 4217.
+var currencyCodes = map[string]string{
+	"RUR": "RUB",
+	"РУБ": "RUB",
+	"₽":   "RUB",
+	"$":   "USD",
+	"€":   "EUR",
+}
+
+// currencyCode приводит обозначение валюты из выгрузки к коду ISO 4217.
+func currencyCode(value string) string {
+	value = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	if code, ok := currencyCodes[value]; ok {
+		return code
+	}
+	return value
+}
+
+// nonZero сообщает, что в колонке суммы указана ненулевая сумма.
+func nonZero(value string) bool {
+	amount, err := parseAmount(pointDecimal(value), ".")
+	return err == nil && !amount.IsZero()
+}
+
+// splitCategory разбирает путь категории «Родитель / Подкатегория» на корневую категорию и подкатегорию.
+func splitCategory(value string) (string, string) {
+	parts := strings.Split(value, "/")
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[len(parts)-1])
+}
+
+// Категории выгрузок банков и приложений, для которых есть подходящая категория WealFlow по умолчанию.
+var (
+	tbankCategories = map[string]string{
+		"Супермаркеты":        "Продукты",
+		"Рестораны":           "Кафе и рестораны",
+		"Фастфуд":             "Кафе и рестораны",
+		"Транспорт":           "Транспорт",
+		"Местный транспорт":   "Транспорт",
+		"Такси":               "Транспорт",
+		"Топливо":             "Транспорт",
+		"Аптеки":              "Здоровье",
+		"Медицина":            "Здоровье",
+		"Мобильная связь":     "Связь и интернет",
+		"Связь, телеком":      "Связь и интернет",
+		"ЖКХ":                 "Коммунальные услуги",
+		"Коммунальные услуги": "Коммунальные услуги",
+		"Одежда и обувь":      "Одежда",
+		"Развлечения":         "Развлечения",
+		"Кино":                "Развлечения",
+		"Цветы":               "Подарки",
+		"Сувениры":            "Подарки",
+		"Зарплата":            "Зарплата",
+		"Другое":              "Прочее",
+		"Остальное":           "Прочее",
+	}
+
+	sberbankCategories = map[string]string{
+		"Супермаркеты":        "Продукты",
+		"Рестораны и кафе":    "Кафе и рестораны",
+		"Транспорт":           "Транспорт",
+		"Автомобиль":          "Транспорт",
+		"Здоровье и красота":  "Здоровье",
+		"Одежда и аксессуары": "Одежда",
+		"Коммунальные платежи, связь, интернет": "Коммунальные услуги",
+		"Отдых и развлечения":                   "Развлечения",
+		"Зарплата":                              "Зарплата",
+		"Прочие расходы":                        "Прочее",
+		"Прочие операции":                       "Прочее",
+	}
+
+	zenmoneyCategories = map[string]string{
+		"Продукты":            "Продукты",
+		"Кафе и рестораны":    "Кафе и рестораны",
+		"Транспорт":           "Транспорт",
+		"Автомобиль":          "Транспорт",
+		"Квартплата":          "Жильё",
+		"Дом":                 "Жильё",
+		"Здоровье и фитнес":   "Здоровье",
+		"Одежда и обувь":      "Одежда",
+		"Связь, интернет":     "Связь и интернет",
+		"Отдых и развлечения": "Развлечения",
+		"Подарки":             "Подарки",
+		"Зарплата":            "Зарплата",
+	}
+
+	coinkeeperCategories = map[string]string{
+		"Продукты":    "Продукты",
+		"Кафе":        "Кафе и рестораны",
+		"Транспорт":   "Транспорт",
+		"Квартира":    "Жильё",
+		"Здоровье":    "Здоровье",
+		"Одежда":      "Одежда",
+		"Связь":       "Связь и интернет",
+		"Развлечения": "Развлечения",
+		"Подарки":     "Подарки",
+		"Зарплата":    "Зарплата",
+	}
+)
+
+// presets — поддерживаемые выгрузки в порядке показа пользователю.
+var presets = []Preset{
+	{
+		Name:    "tbank",
+		Title:   "Т-Банк (Тинькофф): выписка CSV или XLSX",
+		Formats: []string{"csv", "xlsx"},
+		Sample:  "tbank.csv",
+		options: CSVOptions{
+			Mapping: Mapping{
+				Date:        "Дата операции",
+				Amount:      "Сумма платежа",
+				Currency:    "Валюта платежа",
+				Description: "Описание",
+				Category:    "Категория",
+			},
+			DateFormat:       "DD.MM.YYYY HH:mm:ss",
+			DecimalSeparator: ",",
+			Encoding:         "windows-1251",
+			Delimiter:        ';',
+			Categories:       tbankCategories,
+			adjust: func(e *entry, get func(string) string) bool {
+				// Отклонённые операции попадают в выписку, но денег не двигали
+				return get("Статус") != "FAILED"
+			},
+		},
+	},
+	{
+		Name:    "sberbank",
+		Title:   "Сбербанк: история операций CSV или XLSX",
+		Formats: []string{"csv", "xlsx"},
+		Sample:  "sberbank.csv",
+		options: CSVOptions{
+			Mapping: Mapping{
+				Date:        "Дата операции",
+				Amount:      "Сумма в валюте счёта",
+				Description: "Описание",
+				Category:    "Категория",
+			},
+			DateFormat:       "DD.MM.YYYY",
+			DecimalSeparator: ",",
+			Delimiter:        ';',
+			Sign:             SignPlus, // Поступления со знаком +, списания без знака
+			Categories:       sberbankCategories,
+		},
+	},
+	{
+		Name:    "alfabank",
+		Title:   "Альфа-Банк: выписка CSV",
+		Formats: []string{"csv"},
+		Sample:  "alfabank.csv",
+		options: CSVOptions{
+			Mapping: Mapping{
+				Date:        "Дата операции",
+				Income:      "Приход",
+				Expense:     "Расход",
+				Description: "Описание операции",
+			},
+			DateFormat:       "DD.MM.YY",
+			DecimalSeparator: ",",
+			Encoding:         "windows-1251",
+			Delimiter:        ';',
+			adjust: func(e *entry, get func(string) string) bool {
+				// HOLD — ещё не проведённая операция: после проведения она придёт с референсом
+				reference := get("Референс проводки")
+				if reference == "HOLD" {
+					return false
+				}
+				e.ExternalID = reference
+				e.Currency = currencyCode(get("Валюта"))
+				return true
+			},
+		},
+	},
+	{
+		Name:    "zenmoney",
+		Title:   "ZenMoney: экспорт CSV",
+		Formats: []string{"csv"},
+		Sample:  "zenmoney.csv",
+		options: CSVOptions{
+			Mapping: Mapping{
+				Date:        "date",
+				Income:      "income",
+				Expense:     "outcome",
+				Description: "payee",
+				Category:    "categoryName",
+			},
+			DateFormat:       "YYYY-MM-DD",
+			DecimalSeparator: ".",
+			Delimiter:        ';',
+			Categories:       zenmoneyCategories,
+			adjust: func(e *entry, get func(string) string) bool {
+				// Переводы между своими счетами заполнены с обеих сторон
+				if nonZero(get("income")) && nonZero(get("outcome")) {
+					return false
+				}
+				if e.Amount.Sign() < 0 {
+					e.Currency = currencyCode(get("outcomeCurrencyShortTitle"))
+				} else {
+					e.Currency = currencyCode(get("incomeCurrencyShortTitle"))
+				}
+				// Подкатегорию без своей категории WealFlow относим по корневой
+				root, leaf := splitCategory(e.Category)
+				e.Category, e.CategoryAlias = leaf, zenmoneyCategories[leaf]
+				if e.CategoryAlias == "" {
+					e.CategoryAlias = zenmoneyCategories[root]
+				}
+				e.Description = describe(e.Description, get("comment"))
+				if e.Description == "" {
+					e.Description = e.Category
+				}
+				return true
+			},
+		},
+	},
+	{
+		Name:    "coinkeeper",
+		Title:   "CoinKeeper: экспорт CSV",
+		Formats: []string{"csv"},
+		Sample:  "coinkeeper.csv",
+		options: CSVOptions{
+			Mapping: Mapping{
+				Date:        "Дата",
+				Amount:      "Сумма",
+				Currency:    "Валюта",
+				Description: "Примечание",
+			},
+			DateFormat:       "DD.MM.YYYY",
+			DecimalSeparator: ".",
+			Delimiter:        ',',
+			Categories:       coinkeeperCategories,
+			adjust: func(e *entry, get func(string) string) bool {
+				// Расход идёт со счёта «Из» в категорию «В», доход — из источника «Из» на счёт «В»
+				switch get("Тип") {
+				case "Расход":
+					e.Category = get("В")
+					e.Amount = e.Amount.Abs().Neg()
+				case "Доход":
+					e.Category = get("Из")
+					e.Amount = e.Amount.Abs()
+				default: // Перевод между своими счетами
+					return false
+				}
+				e.Currency = currencyCode(e.Currency)
+				if e.Description == "" {
+					e.Description = e.Category
+				}
+				return true
+			},
+		},
+	},
+}
+
+// findPreset ищет пресет по имени.
+func findPreset(name string) (Preset, bool) {
+	for _, preset := range presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// supports сообщает, принимает ли пресет файлы формата format.
+func (p Preset) supports(format string) bool {
+	for _, f := range p.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// parse разбирает файл выгрузки по настройкам пресета и возвращает формат файла: csv или xlsx.
+// Пустая encoding — кодировка, в которой выгружает банк.
+func (p Preset) parse(data []byte, encoding string, loc *time.Location) ([]entry, string, error) {
+	format := "csv"
+	if isXLSX(data) {
+		format = "xlsx"
+	}
+	if !p.supports(format) {
+		return nil, format, errors.New("Пресет '" + p.Name + "' не поддерживает формат " + format)
+	}
+
+	opts := p.options
+	opts.Location = loc
+	if encoding != "" {
+		opts.Encoding = encoding
+	}
+	if format == "xlsx" {
+		entries, err := parseXLSX(data, opts)
+		return entries, format, err
+	}
+	entries, err := parseCSV(data, opts)
+	return entries, format, err
+}
@@ -0,0 +1,144 @@
+package imports
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// expected — ожидаемая операция из выгрузки. Дата — в формате 2006-01-02 15:04:05, сумма — со знаком и копейками.
+type expected struct {
+	date          string
+	amount        string
+	currency      string
+	category      string
+	categoryAlias string
+	description   string
+	externalID    string
+}
+
+// parsePreset разбирает файл пресетом name и сверяет формат и операции с ожидаемыми.
+func parsePreset(t *testing.T, name string, data []byte, format string, want []expected) {
+	t.Helper()
+	preset, ok := findPreset(name)
+	if !ok {
+		t.Fatalf("пресет %s не найден", name)
+	}
+	entries, got, err := preset.parse(data, "", time.UTC)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got != format {
+		t.Errorf("формат %s, ожидался %s", got, format)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("операций %d, ожидалось %d: %+v", len(entries), len(want), entries)
+	}
+	for i, e := range entries {
+		w := want[i]
+		if len(e.Errors) > 0 {
+			t.Errorf("строка %d: ошибки %v", e.Line, e.Errors)
+		}
+		if date := e.Date.Format("2006-01-02 15:04:05"); date != w.date {
+			t.Errorf("строка %d: дата %s, ожидалась %s", e.Line, date, w.date)
+		}
+		if amount := e.Amount.StringFixed("RUB"); amount != w.amount {
+			t.Errorf("строка %d: сумма %s, ожидалась %s", e.Line, amount, w.amount)
+		}
+		if e.Currency != w.currency {
+			t.Errorf("строка %d: валюта %q, ожидалась %q", e.Line, e.Currency, w.currency)
+		}
+		if e.Category != w.category || e.CategoryAlias != w.categoryAlias {
+			t.Errorf("строка %d: категория %q → %q, ожидалась %q → %q", e.Line, e.Category, e.CategoryAlias, w.category, w.categoryAlias)
+		}
+		if e.Description != w.description {
+			t.Errorf("строка %d: описание %q, ожидалось %q", e.Line, e.Description, w.description)
+		}
+		if e.ExternalID != w.externalID {
+			t.Errorf("строка %d: внешний ID %q, ожидался %q", e.Line, e.ExternalID, w.externalID)
+		}
+	}
+}
+
+// sample читает файл-пример пресета.
+func sample(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := samples.ReadFile("samples/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fixture читает файл из testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestTBankCSV(t *testing.T) {
+	// Отклонённая операция пропускается, покупка в долларах берётся в рублях списания
+	parsePreset(t, "tbank", sample(t, "tbank.csv"), "csv", []expected{
+		{"2025-01-15 19:42:10", "-1234.50", "RUB", "Супермаркеты", "Продукты", "Пятёрочка", ""},
+		{"2025-01-16 08:15:03", "-64.00", "RUB", "Местный транспорт", "Транспорт", "Метро", ""},
+		{"2025-01-17 21:30:00", "-1598.12", "RUB", "Развлечения", "Развлечения", "Steam", ""},
+		{"2025-01-20 10:00:00", "85000.00", "RUB", "Зарплата", "Зарплата", "Зарплата ООО Ромашка", ""},
+	})
+}
+
+func TestTBankXLSX(t *testing.T) {
+	// Дата в первой строке — число Excel, суммы — числа
+	parsePreset(t, "tbank", fixture(t, "tbank.xlsx"), "xlsx", []expected{
+		{"2025-01-15 19:42:10", "-1234.50", "RUB", "Супермаркеты", "Продукты", "Пятёрочка", ""},
+		{"2025-01-17 21:30:00", "-1598.12", "RUB", "Развлечения", "Развлечения", "Steam", ""},
+	})
+}
+
+func TestSberbankCSV(t *testing.T) {
+	// Поступления со знаком +, списания без знака
+	parsePreset(t, "sberbank", sample(t, "sberbank.csv"), "csv", []expected{
+		{"2025-01-14 12:10:00", "-2310.40", "", "Супермаркеты", "Продукты", "ВКУСВИЛЛ", ""},
+		{"2025-01-15 09:05:00", "92500.00", "", "Зарплата", "Зарплата", "Зачисление заработной платы", ""},
+		{"2025-01-16 18:47:00", "-740.00", "", "Рестораны и кафе", "Кафе и рестораны", "ШОКОЛАДНИЦА", ""},
+		{"2025-01-18 11:20:00", "-650.00", "", "Коммунальные платежи, связь, интернет", "Коммунальные услуги", "МГТС", ""},
+	})
+}
+
+func TestSberbankXLSX(t *testing.T) {
+	parsePreset(t, "sberbank", fixture(t, "sberbank.xlsx"), "xlsx", []expected{
+		{"2025-01-14 12:10:00", "-2310.40", "", "Супермаркеты", "Продукты", "ВКУСВИЛЛ", ""},
+		{"2025-01-15 09:05:00", "92500.00", "", "Зарплата", "Зарплата", "Зачисление заработной платы", ""},
+	})
+}
+
+func TestAlfabankCSV(t *testing.T) {
+	// Операция в HOLD пропускается, внешний ID — референс проводки
+	parsePreset(t, "alfabank", sample(t, "alfabank.csv"), "csv", []expected{
+		{"2025-01-10 00:00:00", "5000.00", "RUB", "", "", "Перевод от Иванов И.И.", "CRD_8KQ21X"},
+		{"2025-01-11 00:00:00", "-3456.78", "RUB", "", "", "Магазин ЛЕНТА", "CRD_9AB77Z"},
+		{"2025-01-12 00:00:00", "-611.20", "RUB", "", "", "Аптека Ригла", "CRD_1QW34E"},
+	})
+}
+
+func TestZenMoneyCSV(t *testing.T) {
+	// Перевод между счетами пропускается, подкатегория без своей категории относится по корневой
+	parsePreset(t, "zenmoney", sample(t, "zenmoney.csv"), "csv", []expected{
+		{"2025-01-05 00:00:00", "-1890.00", "RUB", "Продукты", "Продукты", "Перекрёсток", ""},
+		{"2025-01-06 00:00:00", "-450.00", "RUB", "Кофейни", "Кафе и рестораны", "Cofix — с коллегами", ""},
+		{"2025-01-10 00:00:00", "85000.00", "RUB", "Зарплата", "Зарплата", "ООО Ромашка", ""},
+		{"2025-01-12 00:00:00", "-6200.50", "RUB", "Квартплата", "Жильё", "Январь", ""},
+	})
+}
+
+func TestCoinKeeperCSV(t *testing.T) {
+	// Перевод пропускается, категория расхода — «В», дохода — «Из»
+	parsePreset(t, "coinkeeper", sample(t, "coinkeeper.csv"), "csv", []expected{
+		{"2025-02-03 00:00:00", "-1450.00", "RUB", "Продукты", "Продукты", "Магнит", ""},
+		{"2025-02-04 00:00:00", "90000.00", "RUB", "Зарплата", "Зарплата", "Зарплата", ""},
+		{"2025-02-06 00:00:00", "-520.00", "RUB", "Кафе", "Кафе и рестораны", "Кафе", ""},
+	})
+}
@@ -0,0 +1,136 @@
+package imports
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// QIFOptions — параметры разбора выписки QIF.
+type QIFOptions struct {
+	DateFormat       string         // Шаблон даты; пусто — M/D/YYYY, YYYY-MM-DD или D.M.YYYY
+	DecimalSeparator string         // Десятичный разделитель: "." или ","
+	Encoding         string         // utf-8 или windows-1251
+	Location         *time.Location // Часовой пояс дат
+}
+
+// qifLayouts — форматы дат QIF, которые пробуются, если шаблон не задан. Quicken пишет
+// даты по-американски, а год после 2000 — через апостроф: 1/15'25.
+var qifLayouts = []string{"1/2/2006", "1/2/06", "2006-01-02", "2.1.2006", "2.1.06"}
+
+// qifTransactionTypes — разделы QIF с банковскими операциями. Инвестиционные операции,
+// списки категорий, классов и счетов пропускаются.
+var qifTransactionTypes = map[string]bool{
+	"bank":  true,
+	"cash":  true,
+	"ccard": true,
+	"oth a": true,
+	"oth l": true,
+}
+
+// parseQIFDate разбирает дату QIF по шаблону или по одному из распространённых форматов.
+func parseQIFDate(value string, dateFormat string, loc *time.Location) (time.Time, error) {
+	value = strings.ReplaceAll(strings.ReplaceAll(value, "'", "/"), " ", "")
+	if dateFormat != "" {
+		return parseDate(value, dateFormat, loc)
+	}
+	for _, layout := range qifLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("дата \"" + value + "\" не распознана; укажите date_format")
+}
+
+// qifCategory приводит категорию QIF к имени категории: «Еда:Продукты/Отпуск» — подкатегория «Продукты»
+// без класса. Переводы между счетами ([Счёт]) остаются без категории.
+func qifCategory(value string) string {
+	if strings.HasPrefix(value, "[") {
+		return ""
+	}
+	value, _, _ = strings.Cut(value, "/")
+	parts := strings.Split(value, ":")
+	return strings.TrimSpace(parts[len(parts)-1])
+}
+
+// parseQIF читает операции из разделов !Type:Bank, Cash, CCard, Oth A и Oth L.
+// Каждая операция — набор строк «код + значение», завершённый строкой ^. Разбивки (S, E, $)
+// не разворачиваются: операция создаётся на общую сумму T.
+func parseQIF(data []byte, opts QIFOptions) ([]entry, error) {
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	layout := opts.DateFormat
+	if layout != "" && !strings.Contains(layout, "2006") {
+		layout = dateTokens.Replace(layout)
+	}
+
+	var entries []entry
+	inTransactions := false
+	fields := map[string]string{}
+	start := 0
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(header, "!type:"):
+				inTransactions = qifTransactionTypes[strings.TrimSpace(strings.TrimPrefix(header, "!type:"))]
+			case header == "!account":
+				inTransactions = false
+			}
+			fields = map[string]string{}
+			continue
+		}
+
+		if line[0] == '^' {
+			if inTransactions && len(fields) > 0 {
+				entries = append(entries, qifEntry(start, fields, layout, opts))
+			}
+			fields = map[string]string{}
+			continue
+		}
+
+		if len(fields) == 0 {
+			start = i + 1
+		}
+		code, value := line[:1], strings.TrimSpace(line[1:])
+		// Коды разбивки повторяются; берём первое значение остальных полей
+		if _, ok := fields[code]; !ok {
+			fields[code] = value
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("В файле QIF нет банковских операций")
+	}
+	return entries, nil
+}
+
+// qifEntry собирает операцию из полей записи QIF: D — дата, T (или U) — сумма, P — получатель,
+// M — комментарий, L — категория.
+func qifEntry(line int, fields map[string]string, layout string, opts QIFOptions) entry {
+	e := entry{Line: line, Description: describe(fields["P"], fields["M"]), Category: qifCategory(fields["L"])}
+
+	var err error
+	if value := fields["D"]; value == "" {
+		e.Errors = append(e.Errors, "Нет даты операции (D)")
+	} else if e.Date, err = parseQIFDate(value, layout, opts.Location); err != nil {
+		e.Errors = append(e.Errors, "Некорректная "+err.Error())
+	}
+
+	amount := fields["T"]
+	if amount == "" {
+		amount = fields["U"]
+	}
+	if e.Amount, err = parseAmount(amount, opts.DecimalSeparator); err != nil {
+		e.Errors = append(e.Errors, "Некорректная сумма (T)")
+	}
+	return e
+}
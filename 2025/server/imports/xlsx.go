@@ -0,0 +1,74 @@
+package imports
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xuri/excelize/v2"
+	"strconv"
+	"time"
+)
+
+// xlsxSignature — начало ZIP-архива, которым является файл XLSX.
+var xlsxSignature = []byte("PK\x03\x04")
+
+// isXLSX сообщает, что файл — книга Excel, а не текстовая выписка.
+func isXLSX(data []byte) bool {
+	return bytes.HasPrefix(data, xlsxSignature)
+}
+
+// excelDate переводит дату Excel (число дней с 1900 года) во время в часовом поясе loc.
+func excelDate(value string, loc *time.Location) (time.Time, bool) {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial <= 0 {
+		return time.Time{}, false
+	}
+	t, err := excelize.ExcelDateToTime(serial, false)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// Excel хранит время без часового пояса, как на часах
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), true
+}
+
+// readXLSX читает первый лист книги: заголовок и строки без форматирования ячеек.
+func readXLSX(data []byte, opts CSVOptions) ([]string, []record, error) {
+	book, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, errors.New("Не удалось открыть файл XLSX")
+	}
+	defer book.Close()
+
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, nil, errors.New("В книге нет листов")
+	}
+	rows, err := book.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, nil, errors.New("Не удалось прочитать лист XLSX")
+	}
+	if len(rows) <= opts.SkipRows {
+		return nil, nil, errors.New("В файле нет строк после пропущенных")
+	}
+
+	var header []string
+	next := opts.SkipRows
+	if !opts.NoHeader {
+		header = rows[next]
+		next++
+	}
+	records := make([]record, 0, len(rows)-next)
+	for i := next; i < len(rows); i++ {
+		records = append(records, record{line: i + 1, fields: rows[i]})
+	}
+	return header, records, nil
+}
+
+// parseXLSX читает выписку в формате XLSX с теми же параметрами, что и CSV.
+func parseXLSX(data []byte, opts CSVOptions) ([]entry, error) {
+	header, records, err := readXLSX(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.spreadsheet = true
+	return parseRecords(header, records, opts)
+}
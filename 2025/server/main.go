@@ -3,16 +3,32 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/attachments"
 	"github.com/IIkar/WealFlow/2025/auth"
+	"github.com/IIkar/WealFlow/2025/budgets"
+	"github.com/IIkar/WealFlow/2025/categories"
 	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/idempotency"
+	"github.com/IIkar/WealFlow/2025/imports"
 	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/rates"
+	"github.com/IIkar/WealFlow/2025/receipts"
+	"github.com/IIkar/WealFlow/2025/recurring"
+	"github.com/IIkar/WealFlow/2025/rules"
+	"github.com/IIkar/WealFlow/2025/statistics"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/tags"
 	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/IIkar/WealFlow/2025/trash"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 // @title WealFlow API
@@ -46,7 +62,70 @@ func main() {
 		}
 	}(client, context.Background())
 
-	app := fiber.New()
+	// Фоновая миграция денежных полей в Decimal128: приложение работает со старым и новым форматом
+	go database.MigrateDecimalAmounts(context.Background())
+
+	// Курсы валют из локального CSV-файла (date,base,quote,rate) для работы без внешних API
+	if path := os.Getenv("RATES_CSV_PATH"); path != "" {
+		go rates.SyncInBackground(context.Background(), rates.NewCSVProvider(path))
+	}
+
+	// Планировщик повторяющихся операций: создаёт наступившие повторы раз в минуту
+	go recurring.RunScheduler(context.Background(), time.Minute)
+
+	// Очистка корзины: удалённые транзакции хранятся TRASH_RETENTION_DAYS дней, по умолчанию 30
+	retentionDays := 30
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			log.Fatal("TRASH_RETENTION_DAYS должно быть положительным числом дней: ", value)
+		}
+		retentionDays = days
+	}
+	go trash.RunPurger(context.Background(), time.Hour, time.Duration(retentionDays)*24*time.Hour)
+
+	// Ключи идемпотентности POST-запросов хранятся IDEMPOTENCY_TTL_HOURS часов, по умолчанию 24
+	if value := os.Getenv("IDEMPOTENCY_TTL_HOURS"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 1 {
+			log.Fatal("IDEMPOTENCY_TTL_HOURS должно быть положительным числом часов: ", value)
+		}
+		idempotency.TTL = time.Duration(hours) * time.Hour
+	}
+
+	// Хранилище вложений: local (каталог ATTACHMENTS_DIR) или gridfs (та же база MongoDB)
+	switch storage := os.Getenv("ATTACHMENTS_STORAGE"); storage {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENTS_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		attachments.Store = attachments.NewLocalStore(dir)
+	case "gridfs":
+		store, err := attachments.NewGridFSStore(database.Database)
+		if err != nil {
+			log.Fatal("Ошибка создания хранилища вложений GridFS: ", err)
+		}
+		attachments.Store = store
+	default:
+		log.Fatal("Неизвестное хранилище вложений ATTACHMENTS_STORAGE: ", storage)
+	}
+	log.Println("Хранилище вложений: " + attachments.Store.Name())
+
+	// Кассовые чеки: распознавание QR-кода по фото программой zbarimg и провайдер позиций чека, оба необязательны
+	if path := os.Getenv("RECEIPTS_QR_DECODER"); path != "" {
+		receipts.Decoder = receipts.NewCommandDecoder(path)
+	}
+	switch provider := os.Getenv("RECEIPTS_PROVIDER"); provider {
+	case "":
+	case "fake":
+		receipts.Provider = receipts.NewFakeProvider()
+	default:
+		log.Fatal("Неизвестный провайдер позиций чеков RECEIPTS_PROVIDER: ", provider)
+	}
+
+	// Лимит тела запроса с запасом на служебные части multipart поверх максимального вложения
+	app := fiber.New(fiber.Config{BodyLimit: attachments.MaxSize + 1<<20})
 
 	// Берём фронтенд домен из env, если нет — fallback на localhost для разработки
 	frontendOrigin := os.Getenv("FRONTEND_ORIGIN")
@@ -56,8 +135,9 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     frontendOrigin,
-		AllowHeaders:     "Origin, Content-Type, Accept",
-		AllowMethods:     "GET,POST,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, If-Match, Idempotency-Key",
+		ExposeHeaders:    "ETag, Idempotent-Replayed",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 		AllowCredentials: true,
 	}))
 
@@ -73,11 +153,71 @@ func main() {
 	authRoutes.Post("/refresh", middleware.Refresh)
 
 	// Защищённые API маршруты
-	apiRoutes := app.Group("/api", middleware.JWTMiddleware)
+	// POST-запросы с заголовком Idempotency-Key выполняются один раз, повторы получают сохранённый ответ
+	apiRoutes := app.Group("/api", middleware.JWTMiddleware, idempotency.Middleware)
 	apiRoutes.Get("/transactions", transactions.GetTransactions)
+	apiRoutes.Get("/transactions/export", transactions.ExportTransactions)
+	apiRoutes.Get("/transactions/duplicates", transactions.GetDuplicates)
+	apiRoutes.Post("/transactions/duplicates/:id/merge", transactions.MergeDuplicates)
+	apiRoutes.Post("/transactions/duplicates/:id/dismiss", transactions.DismissDuplicates)
 	apiRoutes.Post("/transactions", transactions.PostTransaction)
+	apiRoutes.Get("/transactions/:id", transactions.GetTransaction)
 	apiRoutes.Patch("/transactions/:id", transactions.UpdateTransaction)
 	apiRoutes.Delete("/transactions/:id", transactions.DeleteTransaction)
+	apiRoutes.Get("/transactions/:id/history", transactions.GetTransactionHistory)
+	apiRoutes.Post("/transactions/:id/history/:revision/revert", transactions.RevertTransaction)
+	apiRoutes.Get("/transactions/:id/attachments", attachments.GetAttachments)
+	apiRoutes.Post("/transactions/:id/attachments", attachments.PostAttachment)
+	apiRoutes.Get("/attachments/quota", attachments.GetQuota)
+	apiRoutes.Get("/attachments/:id", attachments.DownloadAttachment)
+	apiRoutes.Delete("/attachments/:id", attachments.DeleteAttachment)
+	apiRoutes.Post("/transfers", transactions.PostTransfer)
+	apiRoutes.Post("/receipts", receipts.PostReceipt)
+	apiRoutes.Get("/statistics", statistics.GetStatistics)
+	apiRoutes.Get("/categories", categories.GetCategories)
+	apiRoutes.Post("/categories", categories.PostCategory)
+	apiRoutes.Get("/categories/suggest", suggest.GetSuggestions)
+	apiRoutes.Patch("/categories/:id", categories.UpdateCategory)
+	apiRoutes.Post("/categories/:id/merge", categories.MergeCategory)
+	apiRoutes.Delete("/categories/:id", categories.DeleteCategory)
+	apiRoutes.Get("/accounts", accounts.GetAccounts)
+	apiRoutes.Get("/accounts/:id", accounts.GetAccount)
+	apiRoutes.Post("/accounts", accounts.PostAccount)
+	apiRoutes.Patch("/accounts/:id", accounts.UpdateAccount)
+	apiRoutes.Delete("/accounts/:id", accounts.DeleteAccount)
+	apiRoutes.Get("/rates", rates.GetRate)
+	apiRoutes.Get("/budgets", budgets.GetBudgets)
+	apiRoutes.Get("/budgets/status", budgets.GetBudgetStatus)
+	apiRoutes.Post("/budgets", budgets.PostBudget)
+	apiRoutes.Patch("/budgets/:id", budgets.UpdateBudget)
+	apiRoutes.Delete("/budgets/:id", budgets.DeleteBudget)
+	apiRoutes.Get("/recurring", recurring.GetRecurring)
+	apiRoutes.Post("/recurring", recurring.PostRecurring)
+	apiRoutes.Patch("/recurring/:id", recurring.UpdateRecurring)
+	apiRoutes.Delete("/recurring/:id", recurring.DeleteRecurring)
+	apiRoutes.Get("/recurring/:id/occurrences", recurring.GetOccurrences)
+	apiRoutes.Put("/recurring/:id/occurrences/:date", recurring.PutOccurrence)
+	apiRoutes.Delete("/recurring/:id/occurrences/:date", recurring.DeleteOccurrence)
+	apiRoutes.Post("/import/csv", imports.ImportCSV)
+	apiRoutes.Post("/import/ofx", imports.ImportOFX)
+	apiRoutes.Post("/import/qif", imports.ImportQIF)
+	apiRoutes.Get("/import/presets", imports.GetPresets)
+	apiRoutes.Post("/import/presets/:name", imports.ImportPreset)
+	apiRoutes.Get("/import/presets/:name/sample", imports.GetPresetSample)
+	apiRoutes.Get("/import/batches", imports.GetBatches)
+	apiRoutes.Delete("/import/batches/:id", imports.DeleteBatch)
+	apiRoutes.Get("/rules", rules.GetRules)
+	apiRoutes.Post("/rules", rules.PostRule)
+	apiRoutes.Post("/rules/apply", transactions.ApplyRules)
+	apiRoutes.Patch("/rules/:id", rules.UpdateRule)
+	apiRoutes.Delete("/rules/:id", rules.DeleteRule)
+	apiRoutes.Get("/tags", tags.GetTags)
+	apiRoutes.Patch("/tags/:name", tags.RenameTag)
+	apiRoutes.Delete("/tags/:name", tags.DeleteTag)
+	apiRoutes.Get("/trash", trash.GetTrash)
+	apiRoutes.Delete("/trash", trash.EmptyTrash)
+	apiRoutes.Post("/trash/:id/restore", trash.RestoreTransaction)
+	apiRoutes.Delete("/trash/:id", trash.PurgeTransaction)
 
 	//if os.Getenv("ENV") == "production" {
 	//	app.Static("/", "../client") // Путь к собранным файлам React
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log"
+)
+
+// ErrorResponse переводит ошибку операции в HTTP-ответ: *fiber.Error — как есть, остальное — 500 с message.
+func ErrorResponse(c *fiber.Ctx, err error, message string) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{"error": fiberErr.Message})
+	}
+	log.Printf("%s: %v\n", message, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": message})
+}
@@ -1,25 +1,257 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // User представляет собой зарегистрированного пользователя системы.
 // @Description Модель пользователя (без пароля в JSON).
 type User struct {
-	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name     string             `json:"name"`
-	Email    string             `json:"email"`
-	Password []byte             `json:"password"`
-	Provider string             `json:"provider"`
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name         string             `json:"name"`
+	Email        string             `json:"email"`
+	Password     []byte             `json:"password"`
+	Provider     string             `json:"provider"`
+	BaseCurrency string             `json:"base_currency,omitempty" bson:"base_currency,omitempty"` // Валюта статистики ISO 4217; пусто — money.DefaultCurrency
 }
 
 // Transaction описывает финансовую операцию пользователя.
 // @Description Модель транзакции (доход или расход).
 type Transaction struct {
-	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"` // Уникальный идентификатор, `_id` для MongoDB
-	UserID      primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
-	Date        primitive.DateTime `json:"date,omitempty" bson:"date,omitempty"`               // Дата транзакции
-	Description string             `json:"description,omitempty" bson:"description,omitempty"` // Описание
-	Category    string             `json:"category,omitempty" bson:"category,omitempty"`       // Категория
-	Amount      float64            `json:"amount,omitempty" bson:"amount,omitempty"`           // Сумма
-	Type        bool               `json:"type,omitempty" bson:"type,omitempty"`               // Тип: true - доход, false - расход
+	ID          primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"` // Уникальный идентификатор, `_id` для MongoDB
+	UserID      primitive.ObjectID  `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Date        primitive.DateTime  `json:"date,omitempty" bson:"date,omitempty"`                 // Дата транзакции
+	Description string              `json:"description,omitempty" bson:"description,omitempty"`   // Описание
+	Category    string              `json:"category,omitempty" bson:"category,omitempty"`         // Категория
+	Amount      money.Amount        `json:"amount" bson:"amount,omitempty"`                       // Сумма, в MongoDB хранится как Decimal128
+	Currency    string              `json:"currency,omitempty" bson:"currency,omitempty"`         // Код валюты ISO 4217; пусто у старых записей — money.DefaultCurrency
+	Type        bool                `json:"type,omitempty" bson:"type,omitempty"`                 // Тип: true - доход, false - расход
+	AccountID   *primitive.ObjectID `json:"account_id,omitempty" bson:"account_id,omitempty"`     // Счёт, к которому относится операция
+	Kind        string              `json:"kind,omitempty" bson:"kind,omitempty"`                 // Вид операции: пусто - обычная, transfer - нога перевода
+	TransferID  *primitive.ObjectID `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`   // Общий идентификатор двух ног перевода
+	RecurringID *primitive.ObjectID `json:"recurring_id,omitempty" bson:"recurring_id,omitempty"` // Повторяющаяся операция, из которой создана транзакция
+	Occurrence  string              `json:"occurrence,omitempty" bson:"occurrence,omitempty"`     // Дата повтора YYYY-MM-DD; вместе с recurring_id уникальна
+	ImportID    *primitive.ObjectID `json:"import_id,omitempty" bson:"import_id,omitempty"`       // Загрузка выписки, которой создана транзакция
+	ExternalID  string              `json:"external_id,omitempty" bson:"external_id,omitempty"`   // Идентификатор операции в банке (FITID из OFX); уникален в рамках счёта
+	Tags        []string            `json:"tags,omitempty" bson:"tags,omitempty"`                 // Теги в нижнем регистре, например «отпуск-2026»
+	Notes       string              `json:"notes,omitempty" bson:"notes,omitempty"`               // Заметка в свободной форме, до 2000 символов
+	Splits      []Split             `json:"splits,omitempty" bson:"splits,omitempty"`             // Разбивка суммы по категориям; части в сумме дают amount
+	Receipt     *Receipt            `json:"receipt,omitempty" bson:"receipt,omitempty"`           // Фискальные данные кассового чека, по которому создана транзакция
+
+	PossibleDuplicateOf *primitive.ObjectID `json:"possible_duplicate_of,omitempty" bson:"possible_duplicate_of,omitempty"` // Транзакция, дублем которой может быть эта; снимается слиянием или отклонением
+
+	Version int64 `json:"version" bson:"version,omitempty"` // Растёт с каждым изменением, отдаётся как ETag; 0 — транзакция не менялась
+}
+
+// Split — часть транзакции со своей категорией, например бытовая химия в чеке из супермаркета.
+// Сумма части положительная и в валюте транзакции.
+type Split struct {
+	Category string       `json:"category" bson:"category"`
+	Amount   money.Amount `json:"amount" bson:"amount"`
+	Notes    string       `json:"notes,omitempty" bson:"notes,omitempty"`
+}
+
+// Receipt — фискальные признаки кассового чека из его QR-кода и, если их удалось получить, позиции чека.
+// Тройка fn, fd, fp однозначно определяет чек: второй раз один чек не добавляется.
+type Receipt struct {
+	FN        string        `json:"fn" bson:"fn"`                             // Номер фискального накопителя
+	FD        string        `json:"fd" bson:"fd"`                             // Номер фискального документа
+	FP        string        `json:"fp" bson:"fp"`                             // Фискальный признак документа
+	Operation int           `json:"operation" bson:"operation"`               // Признак расчёта: 1 - приход, 2 - возврат прихода, 3 - расход, 4 - возврат расхода
+	Seller    string        `json:"seller,omitempty" bson:"seller,omitempty"` // Продавец
+	Items     []ReceiptItem `json:"items,omitempty" bson:"items,omitempty"`   // Позиции чека
+}
+
+// ReceiptItem — позиция кассового чека.
+type ReceiptItem struct {
+	Name     string       `json:"name" bson:"name"`
+	Price    money.Amount `json:"price" bson:"price"`
+	Quantity float64      `json:"quantity" bson:"quantity"`
+	Sum      money.Amount `json:"sum" bson:"sum"`
+}
+
+// TrashedTransaction — удалённая транзакция в корзине. Хранится отдельно от транзакций, поэтому не попадает
+// в списки, статистику и бюджеты; до очистки корзины её можно восстановить.
+type TrashedTransaction struct {
+	Transaction `bson:",inline"`
+	DeletedAt   primitive.DateTime `json:"deleted_at" bson:"deleted_at"` // Когда транзакция удалена
+}
+
+// CurrencyOrDefault возвращает валюту транзакции с учётом старых записей без валюты.
+func (t Transaction) CurrencyOrDefault() string {
+	if t.Currency == "" {
+		return money.DefaultCurrency
+	}
+	return t.Currency
+}
+
+// KindTransfer — вид транзакции для ноги перевода между счетами.
+// Списание со счёта-источника хранится как расход, зачисление — как доход.
+const KindTransfer = "transfer"
+
+// Category описывает пользовательскую категорию транзакций.
+// @Description Модель категории. Транзакции ссылаются на категорию по имени, категории могут быть вложенными.
+type Category struct {
+	ID       primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID   primitive.ObjectID  `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	ParentID *primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"` // Родительская категория, nil для корневой
+	Name     string              `json:"name" bson:"name"`                               // Название, уникально в рамках пользователя
+	Color    string              `json:"color,omitempty" bson:"color,omitempty"`         // Цвет в формате #RRGGBB
+	Icon     string              `json:"icon,omitempty" bson:"icon,omitempty"`           // Имя иконки lucide-react
+}
+
+// Типы счетов.
+const (
+	AccountCash       = "cash"        // Наличные
+	AccountDebitCard  = "debit_card"  // Дебетовая карта
+	AccountCreditCard = "credit_card" // Кредитная карта
+	AccountSavings    = "savings"     // Накопительный счёт или вклад
+	AccountLoan       = "loan"        // Кредит
+)
+
+// Account описывает счёт пользователя: где лежат деньги.
+// @Description Модель счёта. Баланс вычисляется из начального остатка и транзакций счёта.
+type Account struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Name           string             `json:"name" bson:"name"`
+	Type           string             `json:"type" bson:"type"`                       // cash, debit_card, credit_card, savings, loan
+	Currency       string             `json:"currency" bson:"currency"`               // Код валюты ISO 4217
+	OpeningBalance money.Amount       `json:"opening_balance" bson:"opening_balance"` // Остаток на момент заведения счёта
+	CreatedAt      primitive.DateTime `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// Периоды бюджета.
+const (
+	BudgetWeekly    = "weekly"    // Неделя с понедельника
+	BudgetMonthly   = "monthly"   // Календарный месяц
+	BudgetQuarterly = "quarterly" // Календарный квартал
+	BudgetCustom    = "custom"    // Произвольный диапазон дат start_date..end_date
+)
+
+// Budget описывает лимит расходов на период.
+// @Description Модель бюджета. Расходы считаются по категории вместе с подкатегориями; без категории — по всем расходам.
+type Budget struct {
+	ID         primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID  `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	CategoryID *primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"` // Категория бюджета, nil — все расходы
+	Amount     money.Amount        `json:"amount" bson:"amount"`                               // Лимит на один период
+	Currency   string              `json:"currency" bson:"currency"`                           // Код валюты ISO 4217 лимита
+	Period     string              `json:"period" bson:"period"`                               // weekly, monthly, quarterly, custom
+	StartDate  string              `json:"start_date" bson:"start_date"`                       // Дата YYYY-MM-DD: с какого периода действует бюджет
+	EndDate    string              `json:"end_date,omitempty" bson:"end_date,omitempty"`       // Дата YYYY-MM-DD включительно, только для custom
+	Rollover   bool                `json:"rollover" bson:"rollover"`                           // Переносить неизрасходованный остаток в следующий период
+	CreatedAt  primitive.DateTime  `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// Recurring описывает повторяющуюся операцию: шаблон транзакции и правило повторения.
+// @Description Модель повторяющейся операции. Повторы по правилу RRULE (RFC 5545) создаются планировщиком как обычные транзакции.
+type Recurring struct {
+	ID          primitive.ObjectID            `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID            `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Description string                        `json:"description" bson:"description"`
+	Category    string                        `json:"category" bson:"category"`
+	Amount      money.Amount                  `json:"amount" bson:"amount"`
+	Currency    string                        `json:"currency" bson:"currency"`
+	Type        bool                          `json:"type" bson:"type"` // true - доход, false - расход
+	AccountID   *primitive.ObjectID           `json:"account_id,omitempty" bson:"account_id,omitempty"`
+	RRule       string                        `json:"rrule" bson:"rrule"`                             // Например FREQ=MONTHLY;BYMONTHDAY=5;COUNT=12
+	StartDate   string                        `json:"start_date" bson:"start_date"`                   // Дата YYYY-MM-DD первого повтора (DTSTART)
+	Timezone    string                        `json:"timezone" bson:"timezone"`                       // Часовой пояс IANA: повтор датируется полуночью своего дня
+	NextRun     *primitive.DateTime           `json:"next_run,omitempty" bson:"next_run,omitempty"`   // Ближайший ещё не созданный повтор; nil — повторы закончились
+	Overrides   map[string]OccurrenceOverride `json:"overrides,omitempty" bson:"overrides,omitempty"` // Изменения отдельных повторов по дате YYYY-MM-DD
+	CreatedAt   primitive.DateTime            `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// OccurrenceOverride — изменение одного повтора: пропуск или другие значения полей шаблона.
+type OccurrenceOverride struct {
+	Skip        bool          `json:"skip,omitempty" bson:"skip,omitempty"`
+	Amount      *money.Amount `json:"amount,omitempty" bson:"amount,omitempty"`
+	Description string        `json:"description,omitempty" bson:"description,omitempty"`
+	Category    string        `json:"category,omitempty" bson:"category,omitempty"`
+}
+
+// ImportBatch описывает одну загрузку банковской выписки.
+// @Description Модель загрузки. Все транзакции загрузки помечены её import_id и откатываются вместе.
+type ImportBatch struct {
+	ID        primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID  `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Source    string              `json:"source" bson:"source"`                             // Формат файла: csv, xlsx, ofx, qif или пресет/формат, например tbank/csv
+	FileName  string              `json:"file_name" bson:"file_name"`                       // Имя загруженного файла
+	AccountID *primitive.ObjectID `json:"account_id,omitempty" bson:"account_id,omitempty"` // Счёт, на который загружены операции
+	Count     int                 `json:"count" bson:"count"`                               // Число созданных транзакций
+	CreatedAt primitive.DateTime  `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// RuleMatch — условия правила. Заданные условия должны выполняться все сразу.
+type RuleMatch struct {
+	DescriptionContains string        `json:"description_contains,omitempty" bson:"description_contains,omitempty"` // Подстрока описания без учёта регистра
+	DescriptionRegex    string        `json:"description_regex,omitempty" bson:"description_regex,omitempty"`       // Регулярное выражение RE2 по описанию без учёта регистра
+	MinAmount           *money.Amount `json:"min_amount,omitempty" bson:"min_amount,omitempty"`                     // Сумма не меньше
+	MaxAmount           *money.Amount `json:"max_amount,omitempty" bson:"max_amount,omitempty"`                     // Сумма не больше
+	Type                string        `json:"type,omitempty" bson:"type,omitempty"`                                 // income или expense; пусто — любой
+}
+
+// RuleSet — что правило устанавливает подходящей транзакции.
+type RuleSet struct {
+	Category  string              `json:"category,omitempty" bson:"category,omitempty"`
+	Tags      []string            `json:"tags,omitempty" bson:"tags,omitempty"`             // Добавляются к тегам транзакции
+	AccountID *primitive.ObjectID `json:"account_id,omitempty" bson:"account_id,omitempty"` // Только для транзакций без счёта в валюте счёта
+}
+
+// Rule описывает правило автоматической категоризации.
+// @Description Модель правила: «описание содержит X, сумма в диапазоне → категория, теги, счёт». Правила проверяются по возрастанию priority.
+type Rule struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Priority  int                `json:"priority" bson:"priority"`                     // Порядок проверки: меньше — раньше
+	Disabled  bool               `json:"disabled,omitempty" bson:"disabled,omitempty"` // Выключенное правило не применяется
+	Match     RuleMatch          `json:"match" bson:"match"`
+	Set       RuleSet            `json:"set" bson:"set"`
+	CreatedAt primitive.DateTime `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// Attachment — файл, приложенный к транзакции: фото чека, PDF счёта или гарантийного талона.
+// @Description Модель вложения. Содержимое хранится в хранилище файлов, здесь — только описание.
+type Attachment struct {
+	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	TransactionID primitive.ObjectID `json:"transaction_id" bson:"transaction_id"`
+	FileName      string             `json:"file_name" bson:"file_name"`       // Имя файла при загрузке
+	ContentType   string             `json:"content_type" bson:"content_type"` // MIME-тип, определённый по содержимому
+	Size          int64              `json:"size" bson:"size"`                 // Размер в байтах
+	Key           string             `json:"-" bson:"key"`                     // Ключ содержимого в хранилище
+	CreatedAt     primitive.DateTime `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// Revision — неизменяемая запись истории транзакции: какие поля изменились, кем и когда.
+// @Description Ревизия транзакции. before и after содержат только изменённые поля: у создания нет before, у удаления — after.
+type Revision struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID  `json:"-" bson:"user_id"`
+	TransactionID primitive.ObjectID  `json:"transaction_id" bson:"transaction_id"`
+	Action        string              `json:"action" bson:"action"`                               // create, update, delete, restore или revert
+	Source        string              `json:"source" bson:"source"`                               // Откуда пришло изменение: api, import, recurring, rules
+	ActorID       *primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`       // Пользователь; пусто у изменений планировщика
+	RevertedTo    *primitive.ObjectID `json:"reverted_to,omitempty" bson:"reverted_to,omitempty"` // Ревизия, к которой вернули транзакцию
+	Before        bson.Raw            `json:"-" bson:"before,omitempty"`                          // Изменённые поля до изменения
+	After         bson.Raw            `json:"-" bson:"after,omitempty"`                           // Изменённые поля после изменения
+	CreatedAt     primitive.DateTime  `json:"created_at" bson:"created_at"`
+}
+
+// IdempotencyKey — ключ идемпотентности POST-запроса пользователя и сохранённый ответ на него.
+// Пока запрос выполняется, Status равен 0.
+type IdempotencyKey struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `bson:"user_id"`
+	Key         string             `bson:"key"`               // Значение заголовка Idempotency-Key
+	RequestHash string             `bson:"request_hash"`      // SHA-256 метода, адреса и тела запроса
+	Status      int                `bson:"status"`            // HTTP-статус ответа
+	Headers     map[string]string  `bson:"headers,omitempty"` // Повторяемые заголовки ответа: Content-Type, ETag, Location
+	Body        []byte             `bson:"body,omitempty"`    // Тело ответа
+	CreatedAt   primitive.DateTime `bson:"created_at"`
+	ExpiresAt   primitive.DateTime `bson:"expires_at"` // После этого момента запись удаляется TTL-индексом
 }
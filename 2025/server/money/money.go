@@ -0,0 +1,215 @@
+package money
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"regexp"
+	"strings"
+)
+
+// DefaultCurrency — валюта, в которой считаются суммы без явно указанной валюты.
+const DefaultCurrency = "RUB"
+
+// currencyScales — число знаков после запятой для валют, отличающихся от стандартных двух.
+var currencyScales = map[string]int32{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"CLP": 0,
+	"ISK": 0,
+	"BHD": 3,
+	"IQD": 3,
+	"JOD": 3,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+}
+
+// currencyPattern — код валюты ISO 4217.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidCurrency проверяет, что строка — трёхбуквенный код валюты ISO 4217 в верхнем регистре.
+func ValidCurrency(code string) bool {
+	return currencyPattern.MatchString(code)
+}
+
+// Scale возвращает количество знаков дробной части (минорных единиц) валюты.
+func Scale(currency string) int32 {
+	if scale, ok := currencyScales[strings.ToUpper(currency)]; ok {
+		return scale
+	}
+	return 2
+}
+
+// Amount — денежная сумма с точной десятичной арифметикой.
+// В MongoDB хранится как Decimal128, в JSON — как число без потери точности.
+// Нулевое значение Amount — это 0.
+type Amount struct {
+	d decimal.Decimal
+}
+
+// Zero — нулевая сумма.
+var Zero = Amount{}
+
+// New создаёт сумму value * 10^exp, например New(150050, -2) = 1500.50.
+func New(value int64, exp int32) Amount {
+	return Amount{d: decimal.New(value, exp)}
+}
+
+// FromMinor создаёт сумму из минорных единиц валюты (копеек, центов).
+func FromMinor(minor int64, currency string) Amount {
+	return New(minor, -Scale(currency))
+}
+
+// FromFloat создаёт сумму из float64. Используется кратчайшее десятичное
+// представление числа, поэтому 0.1 превращается ровно в 0.1.
+func FromFloat(value float64) Amount {
+	return Amount{d: decimal.NewFromFloat(value)}
+}
+
+// Parse разбирает десятичную строку вида "1500.50" или "-20".
+func Parse(value string) (Amount, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return Zero, fmt.Errorf("некорректная сумма %q", value)
+	}
+	return Amount{d: d}, nil
+}
+
+// FromValue приводит значение из JSON-тела (число, строку или json.Number) к сумме.
+func FromValue(value interface{}) (Amount, error) {
+	switch v := value.(type) {
+	case float64:
+		return FromFloat(v), nil
+	case string:
+		return Parse(v)
+	case fmt.Stringer: // json.Number
+		return Parse(v.String())
+	}
+	return Zero, errors.New("сумма должна быть числом")
+}
+
+// Add возвращает a + b.
+func (a Amount) Add(b Amount) Amount { return Amount{d: a.d.Add(b.d)} }
+
+// Sub возвращает a - b.
+func (a Amount) Sub(b Amount) Amount { return Amount{d: a.d.Sub(b.d)} }
+
+// Mul возвращает a * b, например сумму, умноженную на курс валюты.
+func (a Amount) Mul(b Amount) Amount { return Amount{d: a.d.Mul(b.d)} }
+
+// Div возвращает a / b с точностью 16 знаков после запятой, например для обратного курса.
+// Деление на ноль вызывает панику, как и у целых чисел.
+func (a Amount) Div(b Amount) Amount { return Amount{d: a.d.Div(b.d)} }
+
+// Neg возвращает -a.
+func (a Amount) Neg() Amount { return Amount{d: a.d.Neg()} }
+
+// Abs возвращает |a|.
+func (a Amount) Abs() Amount { return Amount{d: a.d.Abs()} }
+
+// Cmp сравнивает суммы: -1, если a < b; 0, если равны; 1, если a > b.
+func (a Amount) Cmp(b Amount) int { return a.d.Cmp(b.d) }
+
+// Equal сообщает, равны ли суммы численно (1.5 == 1.50).
+func (a Amount) Equal(b Amount) bool { return a.d.Equal(b.d) }
+
+// Sign возвращает -1, 0 или 1.
+func (a Amount) Sign() int { return a.d.Sign() }
+
+// IsZero сообщает, равна ли сумма нулю. Используется bson omitempty.
+func (a Amount) IsZero() bool { return a.d.IsZero() }
+
+// IsPositive сообщает, что сумма больше нуля.
+func (a Amount) IsPositive() bool { return a.d.IsPositive() }
+
+// Round округляет сумму до минорных единиц валюты по коммерческому правилу
+// (половина — от нуля): 10.005 RUB -> 10.01, 10.5 JPY -> 11.
+func (a Amount) Round(currency string) Amount {
+	return Amount{d: a.d.Round(Scale(currency))}
+}
+
+// Minor возвращает сумму в минорных единицах валюты после округления.
+func (a Amount) Minor(currency string) int64 {
+	return a.d.Shift(Scale(currency)).Round(0).IntPart()
+}
+
+// StringFixed форматирует сумму с фиксированным числом знаков для валюты.
+func (a Amount) StringFixed(currency string) string {
+	return a.d.StringFixed(Scale(currency))
+}
+
+// String возвращает десятичное представление без экспоненты.
+func (a Amount) String() string { return a.d.String() }
+
+// Float64 возвращает приблизительное значение; только для отображения и процентов.
+func (a Amount) Float64() float64 {
+	f, _ := a.d.Float64()
+	return f
+}
+
+// Decimal128 возвращает значение в формате MongoDB.
+func (a Amount) Decimal128() primitive.Decimal128 {
+	value, err := primitive.ParseDecimal128(a.d.String())
+	if err != nil {
+		// Decimal128 вмещает 34 значащие цифры; для больших сумм округляем
+		value, _ = primitive.ParseDecimal128(a.d.Round(6).String())
+	}
+	return value
+}
+
+// MarshalJSON кодирует сумму числом JSON без потери точности.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.d.String()), nil
+}
+
+// UnmarshalJSON принимает как число, так и строку ("1500.50").
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if string(data) == "null" || len(data) == 0 {
+		*a = Zero
+		return nil
+	}
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalBSONValue сохраняет сумму как Decimal128.
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, a.Decimal128()), nil
+}
+
+// UnmarshalBSONValue читает Decimal128, а также double и целые числа —
+// в таком виде суммы хранились до перехода на Decimal128 и приходят из агрегаций.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.Decimal128:
+		parsed, err := Parse(value.Decimal128().String())
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case bsontype.Double:
+		*a = FromFloat(value.Double())
+	case bsontype.Int32:
+		*a = New(int64(value.Int32()), 0)
+	case bsontype.Int64:
+		*a = New(value.Int64(), 0)
+	case bsontype.Null, bsontype.Undefined:
+		*a = Zero
+	default:
+		return fmt.Errorf("нельзя прочитать сумму из BSON-типа %s", t)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package rates
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CSVProvider читает курсы из локального CSV-файла для работы без внешних API.
+// Формат: заголовок date,base,quote,rate и строки вида 2025-01-15,USD,RUB,101.68.
+// Дата — YYYY-MM-DD, курс — десятичное число с точкой.
+type CSVProvider struct {
+	Path string
+}
+
+// NewCSVProvider создаёт провайдер для файла path.
+func NewCSVProvider(path string) *CSVProvider {
+	return &CSVProvider{Path: path}
+}
+
+// Name возвращает имя источника для логов.
+func (p *CSVProvider) Name() string {
+	return "csv:" + p.Path
+}
+
+// Fetch читает файл целиком и возвращает курсы с датами в диапазоне [from, to].
+func (p *CSVProvider) Fetch(ctx context.Context, from, to time.Time) ([]Rate, error) {
+	file, err := os.Open(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	from, to = day(from), day(to)
+	var result []Rate
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Заголовок пропускаем
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		rate, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s, строка %d: %w", p.Path, line, err)
+		}
+		date := rate.Date.Time().UTC()
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+		result = append(result, rate)
+	}
+	return result, nil
+}
+
+// parseRecord разбирает строку CSV date,base,quote,rate.
+func parseRecord(record []string) (Rate, error) {
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(record[0]))
+	if err != nil {
+		return Rate{}, fmt.Errorf("некорректная дата %q", record[0])
+	}
+	base := strings.ToUpper(strings.TrimSpace(record[1]))
+	quote := strings.ToUpper(strings.TrimSpace(record[2]))
+	if !money.ValidCurrency(base) || !money.ValidCurrency(quote) {
+		return Rate{}, fmt.Errorf("некорректная пара валют %s/%s", record[1], record[2])
+	}
+	if base == quote {
+		return Rate{}, fmt.Errorf("пара валют %s/%s совпадает", base, quote)
+	}
+	value, err := money.Parse(record[3])
+	if err != nil {
+		return Rate{}, err
+	}
+	if !value.IsPositive() {
+		return Rate{}, fmt.Errorf("курс должен быть положительным, получено %s", record[3])
+	}
+	return Rate{
+		Date:  primitive.NewDateTimeFromTime(date),
+		Base:  base,
+		Quote: quote,
+		Rate:  value,
+	}, nil
+}
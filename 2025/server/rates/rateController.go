@@ -0,0 +1,52 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"strings"
+	"time"
+)
+
+// GetRate godoc
+// @Summary Получить курс валюты на дату
+// @Description Возвращает последний известный курс не позже указанной даты. Если сохранён только обратный курс, он инвертируется.
+// @Tags rates
+// @Security ApiKeyAuth
+// @Produce json
+// @Param base query string true "Валюта, которую пересчитываем (ISO 4217)"
+// @Param quote query string true "Валюта, в которую пересчитываем (ISO 4217)"
+// @Param date query string false "Дата YYYY-MM-DD (по умолчанию сегодня)"
+// @Success 200 {object} Rate
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rates [get]
+func GetRate(c *fiber.Ctx) error {
+	base := strings.ToUpper(c.Query("base"))
+	quote := strings.ToUpper(c.Query("quote"))
+	if !money.ValidCurrency(base) || !money.ValidCurrency(quote) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметры 'base' и 'quote' должны быть кодами валют ISO 4217, например USD"})
+	}
+
+	date := time.Now().UTC()
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'date' должен быть в формате YYYY-MM-DD"})
+		}
+		date = parsed
+	}
+
+	rate, err := Lookup(context.Background(), base, quote, date)
+	if errors.Is(err, ErrRateNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Курс " + base + "/" + quote + " на эту дату не найден"})
+	}
+	if err != nil {
+		log.Printf("Ошибка поиска курса: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить курс"})
+	}
+	return c.JSON(rate)
+}
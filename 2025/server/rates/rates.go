@@ -0,0 +1,31 @@
+package rates
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Rate — курс валюты на дату: 1 единица Base стоит Rate единиц Quote.
+// @Description Курс валюты. Например, base=USD, quote=RUB, rate=92.5.
+type Rate struct {
+	Date  primitive.DateTime `json:"date" bson:"date"`   // День, на который действует курс (полночь UTC)
+	Base  string             `json:"base" bson:"base"`   // Код валюты ISO 4217, которую покупаем
+	Quote string             `json:"quote" bson:"quote"` // Код валюты ISO 4217, в которой выражен курс
+	Rate  money.Amount       `json:"rate" bson:"rate"`
+}
+
+// RateProvider — источник курсов валют. Реализации могут читать файл,
+// ходить в API центробанка и т.п.; сохранением в базу занимается Sync.
+type RateProvider interface {
+	// Name возвращает имя источника для логов.
+	Name() string
+	// Fetch возвращает курсы с датами в диапазоне [from, to].
+	Fetch(ctx context.Context, from, to time.Time) ([]Rate, error)
+}
+
+// day приводит момент времени к полуночи UTC того же календарного дня.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,142 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// ConvertedField — поле, в которое ConvertStages кладёт сумму в целевой валюте.
+const ConvertedField = "converted_amount"
+
+// ErrRateNotFound — на дату нет курса ни в прямом, ни в обратном направлении.
+var ErrRateNotFound = errors.New("курс валюты не найден")
+
+// Sync загружает курсы из provider за период [from, to] и сохраняет их в коллекцию rates.
+// Существующий курс на ту же дату перезаписывается. Возвращает число новых и изменённых курсов.
+func Sync(ctx context.Context, provider RateProvider, from, to time.Time) (int64, error) {
+	fetched, err := provider.Fetch(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if len(fetched) == 0 {
+		return 0, nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(fetched))
+	for _, rate := range fetched {
+		rate.Date = primitive.NewDateTimeFromTime(day(rate.Date.Time()))
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"base": rate.Base, "quote": rate.Quote, "date": rate.Date}).
+			SetReplacement(rate).
+			SetUpsert(true))
+	}
+
+	result, err := database.RatesCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	return result.UpsertedCount + result.ModifiedCount, nil
+}
+
+// SyncInBackground синхронизирует все курсы провайдера и пишет результат в лог.
+// Предназначена для запуска при старте приложения.
+func SyncInBackground(ctx context.Context, provider RateProvider) {
+	count, err := Sync(ctx, provider, time.Time{}, time.Now())
+	if err != nil {
+		log.Printf("Ошибка загрузки курсов валют из %s: %v\n", provider.Name(), err)
+		return
+	}
+	log.Printf("Курсы валют из %s загружены: %d новых или изменённых\n", provider.Name(), count)
+}
+
+// Lookup возвращает курс from -> to, действующий на дату date: последний известный курс
+// не позже этой даты. Если сохранён только обратный курс to -> from, он инвертируется.
+func Lookup(ctx context.Context, from, to string, date time.Time) (Rate, error) {
+	if from == to {
+		return Rate{Date: primitive.NewDateTimeFromTime(day(date)), Base: from, Quote: to, Rate: money.New(1, 0)}, nil
+	}
+
+	latest := options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}})
+	until := bson.M{"$lte": primitive.NewDateTimeFromTime(date)}
+
+	var direct, inverse Rate
+	directErr := database.RatesCollection.FindOne(ctx, bson.M{"base": from, "quote": to, "date": until}, latest).Decode(&direct)
+	if directErr != nil && !errors.Is(directErr, mongo.ErrNoDocuments) {
+		return Rate{}, directErr
+	}
+	inverseErr := database.RatesCollection.FindOne(ctx, bson.M{"base": to, "quote": from, "date": until}, latest).Decode(&inverse)
+	if inverseErr != nil && !errors.Is(inverseErr, mongo.ErrNoDocuments) {
+		return Rate{}, inverseErr
+	}
+
+	switch {
+	case directErr == nil && (inverseErr != nil || direct.Date >= inverse.Date):
+		return direct, nil
+	case inverseErr == nil:
+		return Rate{Date: inverse.Date, Base: from, Quote: to, Rate: money.New(1, 0).Div(inverse.Rate)}, nil
+	}
+	return Rate{}, ErrRateNotFound
+}
+
+// ConvertStages возвращает стадии агрегации по транзакциям, которые добавляют поле
+// ConvertedField — сумму, пересчитанную в валюту target по курсу на дату транзакции
+// и округлённую до минорных единиц. Как и Lookup, берётся последний курс не позже даты,
+// прямой или обратный. Если курса нет, поле равно null.
+// Транзакции без валюты считаются в money.DefaultCurrency.
+func ConvertStages(target string) mongo.Pipeline {
+	rateLookup := func(base, quote interface{}, as string) bson.D {
+		return bson.D{{Key: "$lookup", Value: bson.M{
+			"from": database.RatesCollection.Name(),
+			"let":  bson.M{"currency": "$currency", "date": "$date"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$base", base}},
+					bson.M{"$eq": bson.A{"$quote", quote}},
+					bson.M{"$lte": bson.A{"$date", "$$date"}},
+				}}}},
+				bson.M{"$sort": bson.M{"date": -1}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 0, "date": 1, "rate": 1}},
+			},
+			"as": as,
+		}}}
+	}
+
+	hasDirect := bson.M{"$gt": bson.A{bson.M{"$size": "$_direct"}, 0}}
+	hasInverse := bson.M{"$gt": bson.A{bson.M{"$size": "$_inverse"}, 0}}
+	first := func(field string) bson.M {
+		return bson.M{"$arrayElemAt": bson.A{field, 0}}
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"currency": bson.M{"$ifNull": bson.A{"$currency", money.DefaultCurrency}}}}},
+		rateLookup("$$currency", target, "_direct"),
+		rateLookup(target, "$$currency", "_inverse"),
+		{{Key: "$set", Value: bson.M{ConvertedField: bson.M{"$round": bson.A{
+			bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{"$currency", target}}, "then": "$amount"},
+					bson.M{
+						"case": bson.M{"$and": bson.A{hasDirect, bson.M{"$or": bson.A{
+							bson.M{"$not": bson.A{hasInverse}},
+							bson.M{"$gte": bson.A{first("$_direct.date"), first("$_inverse.date")}},
+						}}}},
+						"then": bson.M{"$multiply": bson.A{"$amount", first("$_direct.rate")}},
+					},
+					bson.M{"case": hasInverse, "then": bson.M{"$divide": bson.A{"$amount", first("$_inverse.rate")}}},
+				},
+				"default": nil,
+			}},
+			money.Scale(target),
+		}}}}},
+		{{Key: "$unset", Value: bson.A{"_direct", "_inverse"}}},
+	}
+}
@@ -0,0 +1,89 @@
+package receipts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrNoCode возвращается декодером, если на изображении не найден QR-код.
+var ErrNoCode = errors.New("QR-код не найден")
+
+// QRDecoder распознаёт QR-коды на изображении и возвращает их содержимое.
+type QRDecoder interface {
+	// Name возвращает имя декодера для логов.
+	Name() string
+	// Decode возвращает строки всех найденных QR-кодов; без кодов — ErrNoCode.
+	Decode(ctx context.Context, image []byte) ([]string, error)
+}
+
+// Decoder — декодер QR-кодов для фото чеков; nil — распознавание по фото выключено. Задаётся при запуске сервера.
+var Decoder QRDecoder
+
+// decodeTimeout ограничивает время работы внешней программы распознавания.
+const decodeTimeout = 15 * time.Second
+
+// CommandDecoder распознаёт QR-коды программой zbarimg из пакета ZBar: изображение пишется во временный файл,
+// программа печатает содержимое каждого кода отдельной строкой.
+type CommandDecoder struct {
+	Path string
+}
+
+// NewCommandDecoder создаёт декодер, который запускает zbarimg по пути path.
+func NewCommandDecoder(path string) *CommandDecoder {
+	return &CommandDecoder{Path: path}
+}
+
+// Name возвращает имя декодера для логов.
+func (d *CommandDecoder) Name() string {
+	return d.Path
+}
+
+// Decode запускает zbarimg для изображения.
+func (d *CommandDecoder) Decode(ctx context.Context, image []byte) ([]string, error) {
+	file, err := os.CreateTemp("", "receipt-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(image); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, decodeTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.Path, "--quiet", "--raw", "-Sdisable", "-Sqrcode.enable", file.Name())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	// Код выхода 4 означает, что изображение прочитано, но кодов на нём нет
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 4 {
+		return nil, ErrNoCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", d.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var codes []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			codes = append(codes, line)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, ErrNoCode
+	}
+	return codes, nil
+}
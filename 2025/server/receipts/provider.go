@@ -0,0 +1,73 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"sync"
+)
+
+// ErrReceiptNotFound возвращается провайдером, если чек с такими фискальными признаками ему неизвестен.
+var ErrReceiptNotFound = errors.New("чек не найден")
+
+// Details — данные чека от провайдера: продавец и позиции.
+type Details struct {
+	Seller string
+	Items  []models.ReceiptItem
+}
+
+// ItemsProvider получает позиции чека по его QR-коду, например из сервиса проверки чеков ФНС или от ОФД.
+// Провайдер необязателен: без него транзакция создаётся только с итогом чека.
+type ItemsProvider interface {
+	// Name возвращает имя провайдера для логов.
+	Name() string
+	// Fetch возвращает данные чека; неизвестный чек — ErrReceiptNotFound.
+	Fetch(ctx context.Context, q QR) (Details, error)
+}
+
+// Provider — провайдер позиций чеков; nil — позиции не запрашиваются. Задаётся при запуске сервера.
+var Provider ItemsProvider
+
+// FakeProvider — провайдер для тестов и разработки без доступа к внешним сервисам.
+// Чеки, добавленные через Add, возвращаются как есть; для остальных — одна позиция на всю сумму чека.
+type FakeProvider struct {
+	mu       sync.RWMutex
+	receipts map[string]Details
+}
+
+// NewFakeProvider создаёт пустой тестовый провайдер.
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{receipts: map[string]Details{}}
+}
+
+// Name возвращает имя провайдера для логов.
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Add запоминает данные чека q.
+func (p *FakeProvider) Add(q QR, details Details) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.receipts[q.Key()] = details
+}
+
+// Fetch возвращает запомненные данные чека или одну позицию на всю сумму.
+func (p *FakeProvider) Fetch(ctx context.Context, q QR) (Details, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if details, ok := p.receipts[q.Key()]; ok {
+		return details, nil
+	}
+	return Details{Items: []models.ReceiptItem{{Name: "Покупка", Price: q.Sum, Quantity: 1, Sum: q.Sum}}}, nil
+}
+
+// itemsTotal возвращает сумму позиций чека.
+func itemsTotal(items []models.ReceiptItem) money.Amount {
+	total := money.Zero
+	for _, item := range items {
+		total = total.Add(item.Sum)
+	}
+	return total
+}
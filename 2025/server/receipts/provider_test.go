@@ -0,0 +1,86 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"testing"
+	"time"
+)
+
+// failingProvider — провайдер, который всегда возвращает err.
+type failingProvider struct {
+	err error
+}
+
+func (p failingProvider) Name() string {
+	return "failing"
+}
+
+func (p failingProvider) Fetch(ctx context.Context, q QR) (Details, error) {
+	return Details{}, p.err
+}
+
+// amount разбирает сумму для теста.
+func amount(t *testing.T, value string) money.Amount {
+	t.Helper()
+	a, err := money.Parse(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestFetchDetails(t *testing.T) {
+	q, err := ParseQR("t=20240115T123045&s=150.00&fn=9960440300000001&i=12345&fp=1234567890&n=1", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := q
+	other.FD = "12346"
+
+	fake := NewFakeProvider()
+	fake.Add(q, Details{Seller: "ООО Ромашка", Items: []models.ReceiptItem{
+		{Name: "Хлеб", Price: amount(t, "50"), Quantity: 1, Sum: amount(t, "50")},
+		{Name: "Молоко", Price: amount(t, "50"), Quantity: 2, Sum: amount(t, "100")},
+	}})
+	mismatched := NewFakeProvider()
+	mismatched.Add(q, Details{Seller: "ООО Ромашка", Items: []models.ReceiptItem{
+		{Name: "Хлеб", Price: amount(t, "50"), Quantity: 1, Sum: amount(t, "50")},
+	}})
+
+	tests := []struct {
+		name     string
+		provider ItemsProvider
+		q        QR
+		seller   string
+		items    []string // Ожидаемые суммы позиций
+	}{
+		{name: "без провайдера", provider: nil, q: q},
+		{name: "позиции сходятся с итогом", provider: fake, q: q, seller: "ООО Ромашка", items: []string{"50.00", "100.00"}},
+		{name: "позиции не сходятся с итогом", provider: mismatched, q: q, seller: "ООО Ромашка"},
+		{name: "неизвестный чек фейкового провайдера", provider: fake, q: other, items: []string{"150.00"}},
+		{name: "чек не найден", provider: failingProvider{err: ErrReceiptNotFound}, q: q},
+		{name: "сбой провайдера", provider: failingProvider{err: errors.New("timeout")}, q: q},
+	}
+	saved := Provider
+	t.Cleanup(func() { Provider = saved })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Provider = tt.provider
+			details := fetchDetails(context.Background(), tt.q)
+			if details.Seller != tt.seller {
+				t.Errorf("продавец %q, ожидался %q", details.Seller, tt.seller)
+			}
+			if len(details.Items) != len(tt.items) {
+				t.Fatalf("позиций %d, ожидалось %d", len(details.Items), len(tt.items))
+			}
+			for i, item := range details.Items {
+				if got := item.Sum.StringFixed("RUB"); got != tt.items[i] {
+					t.Errorf("позиция %d: сумма %s, ожидалась %s", i, got, tt.items[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package receipts
+
+import (
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Признаки расчёта из поля n QR-кода.
+const (
+	OperationIncome        = 1 // Приход: покупка, для пользователя — расход
+	OperationIncomeReturn  = 2 // Возврат прихода: возврат покупки
+	OperationExpense       = 3 // Расход: продавец платит покупателю, например за сданный металлолом
+	OperationExpenseReturn = 4 // Возврат расхода
+)
+
+// qrTimeLayouts — форматы поля t: время кассы без часового пояса, секунды есть не всегда.
+var qrTimeLayouts = []string{"20060102T150405", "20060102T1504"}
+
+// QR — данные QR-кода кассового чека вида t=20240115T1230&s=1234.56&fn=...&i=...&fp=...&n=1.
+type QR struct {
+	Time      time.Time    // Время расчёта
+	Sum       money.Amount // Итог чека в рублях
+	FN        string       // Номер фискального накопителя
+	FD        string       // Номер фискального документа (поле i)
+	FP        string       // Фискальный признак документа
+	Operation int          // Признак расчёта
+}
+
+// IsIncome сообщает, что деньги по чеку получает пользователь: возврат покупки или выплата продавца.
+func (q QR) IsIncome() bool {
+	return q.Operation == OperationIncomeReturn || q.Operation == OperationExpense
+}
+
+// Key возвращает ключ чека из фискальных признаков.
+func (q QR) Key() string {
+	return q.FN + ":" + q.FD + ":" + q.FP
+}
+
+// digits проверяет, что значение состоит из цифр и не длиннее max символов.
+func digits(value string, max int) bool {
+	if value == "" || len(value) > max {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseQR разбирает строку QR-кода кассового чека. Время кассы не содержит часового пояса и читается в loc.
+// Ошибки формата возвращаются как *fiber.Error со статусом 400.
+func ParseQR(raw string, loc *time.Location) (QR, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(raw))
+	if err != nil {
+		return QR{}, fiber.NewError(fiber.StatusBadRequest, "Строка QR-кода чека не разобрана")
+	}
+	for _, key := range []string{"t", "s", "fn", "i", "fp", "n"} {
+		if values.Get(key) == "" {
+			return QR{}, fiber.NewError(fiber.StatusBadRequest, "В QR-коде чека нет поля '"+key+"'")
+		}
+	}
+
+	var q QR
+	timeValue := values.Get("t")
+	for _, layout := range qrTimeLayouts {
+		if q.Time, err = time.ParseInLocation(layout, timeValue, loc); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return QR{}, fiber.NewError(fiber.StatusBadRequest, "Неверное время в QR-коде чека: "+timeValue)
+	}
+
+	q.Sum, err = money.Parse(values.Get("s"))
+	if err != nil || !q.Sum.IsPositive() {
+		return QR{}, fiber.NewError(fiber.StatusBadRequest, "Неверная сумма в QR-коде чека: "+values.Get("s"))
+	}
+	q.Sum = q.Sum.Round("RUB")
+
+	q.FN, q.FD, q.FP = values.Get("fn"), values.Get("i"), values.Get("fp")
+	if !digits(q.FN, 16) || !digits(q.FD, 10) || !digits(q.FP, 10) {
+		return QR{}, fiber.NewError(fiber.StatusBadRequest, "Неверные фискальные признаки в QR-коде чека")
+	}
+
+	q.Operation, err = strconv.Atoi(values.Get("n"))
+	if err != nil || q.Operation < OperationIncome || q.Operation > OperationExpenseReturn {
+		return QR{}, fiber.NewError(fiber.StatusBadRequest, "Неверный признак расчёта в QR-коде чека: "+values.Get("n"))
+	}
+	return q, nil
+}
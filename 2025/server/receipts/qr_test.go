@@ -0,0 +1,63 @@
+package receipts
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"testing"
+	"time"
+)
+
+func TestParseQR(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	valid := "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&fp=1234567890&n=1"
+
+	tests := []struct {
+		name      string
+		raw       string
+		time      string // Ожидаемое время в формате 2006-01-02 15:04:05 -0700; пусто — ожидается ошибка 400
+		sum       string
+		operation int
+	}{
+		{name: "время с секундами", raw: valid, time: "2024-01-15 12:30:45 +0300", sum: "1234.56", operation: OperationIncome},
+		{name: "время без секунд", raw: "t=20240115T1230&s=99.9&fn=9960440300000001&i=7&fp=42&n=2", time: "2024-01-15 12:30:00 +0300", sum: "99.90", operation: OperationIncomeReturn},
+		{name: "пробелы по краям", raw: "  " + valid + "\n", time: "2024-01-15 12:30:45 +0300", sum: "1234.56", operation: OperationIncome},
+		{name: "нет времени", raw: "s=1234.56&fn=9960440300000001&i=12345&fp=1234567890&n=1"},
+		{name: "нет суммы", raw: "t=20240115T123045&fn=9960440300000001&i=12345&fp=1234567890&n=1"},
+		{name: "нет фискального накопителя", raw: "t=20240115T123045&s=1234.56&i=12345&fp=1234567890&n=1"},
+		{name: "нет номера документа", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&fp=1234567890&n=1"},
+		{name: "нет фискального признака", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&n=1"},
+		{name: "нет признака расчёта", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&fp=1234567890"},
+		{name: "неверное время", raw: "t=2024-01-15 12:30&s=1234.56&fn=9960440300000001&i=12345&fp=1234567890&n=1"},
+		{name: "нулевая сумма", raw: "t=20240115T123045&s=0&fn=9960440300000001&i=12345&fp=1234567890&n=1"},
+		{name: "сумма не числом", raw: "t=20240115T123045&s=abc&fn=9960440300000001&i=12345&fp=1234567890&n=1"},
+		{name: "буквы в fn", raw: "t=20240115T123045&s=1234.56&fn=99604403000000AB&i=12345&fp=1234567890&n=1"},
+		{name: "fn длиннее 16 цифр", raw: "t=20240115T123045&s=1234.56&fn=99604403000000011&i=12345&fp=1234567890&n=1"},
+		{name: "буквы в fp", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&fp=12345x&n=1"},
+		{name: "признак расчёта вне диапазона", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&fp=1234567890&n=5"},
+		{name: "признак расчёта не числом", raw: "t=20240115T123045&s=1234.56&fn=9960440300000001&i=12345&fp=1234567890&n=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQR(tt.raw, loc)
+			if tt.time == "" {
+				var fiberErr *fiber.Error
+				if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+					t.Fatalf("ожидалась ошибка 400, получено %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQR: %v", err)
+			}
+			if got := q.Time.Format("2006-01-02 15:04:05 -0700"); got != tt.time {
+				t.Errorf("время %s, ожидалось %s", got, tt.time)
+			}
+			if got := q.Sum.StringFixed("RUB"); got != tt.sum {
+				t.Errorf("сумма %s, ожидалась %s", got, tt.sum)
+			}
+			if q.Operation != tt.operation {
+				t.Errorf("признак расчёта %d, ожидался %d", q.Operation, tt.operation)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/rules"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxImageSize — ограничение размера фото чека.
+const maxImageSize = 10 << 20
+
+// defaultDescription — описание транзакции, если его не передали и продавец неизвестен.
+const defaultDescription = "Кассовый чек"
+
+// Request — тело запроса на добавление чека: JSON или поля формы multipart/form-data.
+type Request struct {
+	QR          string   `json:"qr" form:"qr"`                   // Строка QR-кода; в форме вместо неё можно передать фото в поле file
+	Category    string   `json:"category" form:"category"`       // Категория; без неё берётся из правил категоризации
+	AccountID   string   `json:"account_id" form:"account_id"`   // Счёт
+	Description string   `json:"description" form:"description"` // Описание; по умолчанию — продавец из данных чека
+	Notes       string   `json:"notes" form:"notes"`
+	Tags        []string `json:"tags" form:"tags"`
+	TZ          string   `json:"tz" form:"tz"` // Часовой пояс кассы, по умолчанию UTC
+}
+
+// decodeUpload распознаёт QR-код на фото чека из поля file и возвращает первую строку, похожую на QR-код чека.
+func decodeUpload(c *fiber.Ctx) (string, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Передайте строку QR-кода в поле 'qr' или фото чека в поле 'file'")
+	}
+	if Decoder == nil {
+		return "", fiber.NewError(fiber.StatusNotImplemented, "Распознавание QR-кода по фото не настроено. Передайте строку QR-кода в поле 'qr'")
+	}
+	if header.Size > maxImageSize {
+		return "", fiber.NewError(fiber.StatusRequestEntityTooLarge, "Фото чека больше 10 МБ")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	codes, err := Decoder.Decode(context.Background(), image)
+	if errors.Is(err, ErrNoCode) {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, "На фото не найден QR-код")
+	}
+	if err != nil {
+		return "", err
+	}
+	// На фото могут попасть и другие коды, например ссылка на сайт магазина
+	for _, code := range codes {
+		if strings.Contains(code, "fn=") {
+			return code, nil
+		}
+	}
+	return "", fiber.NewError(fiber.StatusUnprocessableEntity, "QR-код на фото не похож на QR-код кассового чека")
+}
+
+// fetchDetails запрашивает у провайдера продавца и позиции чека. Позиции, которые не сходятся с итогом,
+// не сохраняются. Сбой провайдера не мешает добавить чек: транзакция создаётся с итогом из QR-кода.
+func fetchDetails(ctx context.Context, q QR) Details {
+	if Provider == nil {
+		return Details{}
+	}
+	details, err := Provider.Fetch(ctx, q)
+	if errors.Is(err, ErrReceiptNotFound) {
+		return Details{}
+	}
+	if err != nil {
+		log.Printf("Ошибка получения позиций чека %s от %s: %v\n", q.Key(), Provider.Name(), err)
+		return Details{}
+	}
+	if len(details.Items) > 0 && itemsTotal(details.Items).Cmp(q.Sum) != 0 {
+		log.Printf("Позиции чека %s от %s не сходятся с итогом %s\n", q.Key(), Provider.Name(), q.Sum.StringFixed("RUB"))
+		details.Items = nil
+	}
+	return details
+}
+
+// existingReceipt возвращает ID транзакции, уже созданной по чеку q, или nil.
+func existingReceipt(ctx context.Context, userID primitive.ObjectID, q QR) (*primitive.ObjectID, error) {
+	var existing models.Transaction
+	err := database.TransactionsCollection.FindOne(ctx,
+		bson.M{"user_id": userID, "receipt.fn": q.FN, "receipt.fd": q.FD, "receipt.fp": q.FP},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing.ID, nil
+}
+
+// PostReceipt godoc
+// @Summary Добавить транзакцию по QR-коду кассового чека
+// @Description Принимает JSON со строкой QR-кода чека (t=20240115T1230&s=1234.56&fn=...&i=...&fp=...&n=1) в поле qr
+// @Description или multipart/form-data с фото чека в поле file. Из кода берутся дата, сумма и тип операции:
+// @Description покупка и возврат выплаты — расход, возврат покупки и выплата продавца — доход. Валюта — рубли.
+// @Description Фискальные признаки сохраняются в receipt, и повторно тот же чек не добавляется (409 с transaction_id).
+// @Description Если настроен провайдер позиций, в receipt сохраняются продавец и позиции чека.
+// @Tags receipts
+// @Security ApiKeyAuth
+// @Accept json,mpfd
+// @Produce json
+// @Param receipt body receipts.Request false "Строка QR-кода и поля транзакции"
+// @Param file formData file false "Фото чека с QR-кодом"
+// @Success 201 {object} models.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "Чек уже добавлен"
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string "На фото не найден QR-код чека"
+// @Failure 500 {object} map[string]string
+// @Failure 501 {object} map[string]string "Распознавание по фото не настроено"
+// @Router /api/receipts [post]
+func PostReceipt(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	var request Request
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат запроса: " + err.Error()})
+	}
+	if request.QR == "" {
+		if request.QR, err = decodeUpload(c); err != nil {
+			return middleware.ErrorResponse(c, err, "Не удалось распознать QR-код чека")
+		}
+	}
+
+	loc := time.UTC
+	if request.TZ != "" {
+		if loc, err = time.LoadLocation(request.TZ); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неизвестный часовой пояс в параметре 'tz'"})
+		}
+	}
+	q, err := ParseQR(request.QR, loc)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось разобрать QR-код чека")
+	}
+
+	existingID, err := existingReceipt(context.Background(), userID, q)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить чек")
+	}
+	if existingID != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Этот чек уже добавлен", "transaction_id": existingID})
+	}
+
+	details := fetchDetails(context.Background(), q)
+	transaction := &models.Transaction{
+		UserID:      userID,
+		Date:        primitive.NewDateTimeFromTime(q.Time),
+		Description: strings.TrimSpace(request.Description),
+		Category:    request.Category,
+		Amount:      q.Sum,
+		Currency:    "RUB",
+		Type:        q.IsIncome(),
+		Notes:       request.Notes,
+		Tags:        request.Tags,
+		Receipt: &models.Receipt{
+			FN:        q.FN,
+			FD:        q.FD,
+			FP:        q.FP,
+			Operation: q.Operation,
+			Seller:    details.Seller,
+			Items:     details.Items,
+		},
+	}
+	if transaction.Description == "" {
+		transaction.Description = details.Seller
+	}
+	if transaction.Description == "" {
+		transaction.Description = defaultDescription
+	}
+	if request.AccountID != "" {
+		accountID, err := primitive.ObjectIDFromHex(request.AccountID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат 'account_id'"})
+		}
+		transaction.AccountID = &accountID
+	}
+
+	// Правила заполняют категорию и счёт, если их не передали, и добавляют теги
+	if engine, err := rules.Load(context.Background(), userID); err != nil {
+		log.Printf("Ошибка загрузки правил: %v\n", err)
+	} else {
+		engine.Fill(transaction)
+	}
+
+	if err := transactions.Validate(context.Background(), transaction); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить транзакцию")
+	}
+
+	// Чек мог уже попасть в приложение из выписки банка или вручную
+	duplicateOf, err := transactions.FindDuplicate(context.Background(), *transaction)
+	if err != nil {
+		log.Printf("Ошибка поиска дублей транзакции: %v\n", err)
+	}
+	transaction.PossibleDuplicateOf = duplicateOf
+
+	transaction.ID = primitive.NewObjectID()
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if _, err := database.TransactionsCollection.InsertOne(sessCtx, transaction); err != nil {
+			return nil, err
+		}
+		return nil, history.Record(sessCtx, history.By(userID, history.SourceAPI), history.ActionCreate, history.Change{After: transaction})
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// Тот же чек добавлен параллельным запросом
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Этот чек уже добавлен"})
+	}
+	if err != nil {
+		log.Printf("Ошибка вставки транзакции по чеку: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать транзакцию"})
+	}
+
+	if err := suggest.Learn(context.Background(), userID, *transaction); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(transaction)
+}
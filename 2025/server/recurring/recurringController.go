@@ -0,0 +1,447 @@
+package recurring
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/gofiber/fiber/v2"
+	"github.com/teambition/rrule-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// Occurrence — повтор в предпросмотре: транзакция, которая будет создана, с учётом изменений.
+type Occurrence struct {
+	Date          string              `json:"date"`                     // Дата повтора YYYY-MM-DD
+	Skipped       bool                `json:"skipped,omitempty"`        // Повтор пропущен
+	TransactionID *primitive.ObjectID `json:"transaction_id,omitempty"` // Транзакция, если повтор уже создан
+	Transaction   models.Transaction  `json:"transaction"`
+}
+
+// prepare проверяет повторяющуюся операцию пользователя и нормализует её шаблон
+// так же, как обычную транзакцию. Возвращает скомпилированное правило.
+func prepare(ctx context.Context, r *models.Recurring) (*rrule.RRule, error) {
+	if r.Timezone == "" {
+		r.Timezone = "UTC"
+	}
+	rule, _, err := compile(*r)
+	if err != nil {
+		return nil, err
+	}
+
+	template := models.Transaction{
+		UserID:      r.UserID,
+		Description: r.Description,
+		Category:    r.Category,
+		Amount:      r.Amount,
+		Currency:    r.Currency,
+		Type:        r.Type,
+		AccountID:   r.AccountID,
+	}
+	if err := transactions.Validate(ctx, &template); err != nil {
+		return nil, err
+	}
+	if !template.Amount.IsPositive() {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Сумма 'amount' должна быть положительной")
+	}
+	r.Amount = template.Amount
+	r.Currency = template.Currency
+	return rule, nil
+}
+
+// findRecurring загружает повторяющуюся операцию пользователя по ID из пути.
+func findRecurring(c *fiber.Ctx, userID primitive.ObjectID) (models.Recurring, error) {
+	var r models.Recurring
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return r, fiber.NewError(fiber.StatusBadRequest, "Неверный формат ID")
+	}
+	err = database.RecurringCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return r, fiber.NewError(fiber.StatusNotFound, "Повторяющаяся операция не найдена")
+	}
+	return r, err
+}
+
+// GetRecurring godoc
+// @Summary Получить повторяющиеся операции пользователя
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.Recurring
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring [get]
+func GetRecurring(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	cursor, err := database.RecurringCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		log.Printf("Ошибка при поиске повторяющихся операций: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить повторяющиеся операции"})
+	}
+
+	list := []models.Recurring{}
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования повторяющихся операций: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования повторяющихся операций"})
+	}
+
+	return c.JSON(list)
+}
+
+// PostRecurring godoc
+// @Summary Создать повторяющуюся операцию
+// @Description Шаблон транзакции и правило RRULE (FREQ=DAILY, WEEKLY, MONTHLY или YEARLY; UNTIL или COUNT). Повторы с датой в прошлом, начиная со start_date, создаются сразу.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param recurring body models.Recurring true "Шаблон и правило"
+// @Success 201 {object} models.Recurring
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring [post]
+func PostRecurring(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	r := new(models.Recurring)
+	if err := c.BodyParser(r); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	r.ID = primitive.NewObjectID()
+	r.UserID = userID
+	r.Overrides = nil
+	r.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	rule, err := prepare(context.Background(), r)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось создать повторяющуюся операцию")
+	}
+	if r.NextRun = nextRun(rule, rule.GetDTStart()); r.NextRun == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Правило не даёт ни одного повтора"})
+	}
+
+	if _, err := database.RecurringCollection.InsertOne(context.Background(), r); err != nil {
+		log.Printf("Ошибка вставки повторяющейся операции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать повторяющуюся операцию"})
+	}
+
+	// Наступившие повторы создаём сразу, не дожидаясь планировщика
+	if _, err := materialize(context.Background(), *r, time.Now()); err != nil {
+		log.Printf("Ошибка создания повторов операции %s: %v\n", r.ID.Hex(), err)
+	}
+	if err := database.RecurringCollection.FindOne(context.Background(), bson.M{"_id": r.ID}).Decode(r); err != nil {
+		log.Printf("Ошибка чтения повторяющейся операции: %v\n", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(r)
+}
+
+// UpdateRecurring godoc
+// @Summary Обновить повторяющуюся операцию
+// @Description Переданные поля накладываются на текущие. Изменения касаются только ещё не созданных повторов;
+// @Description при смене rrule, start_date или timezone расписание пересчитывается начиная с сегодняшнего дня.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID повторяющейся операции"
+// @Param update body map[string]interface{} true "Поля шаблона и правила"
+// @Success 200 {object} models.Recurring
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring/{id} [patch]
+func UpdateRecurring(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	existing, err := findRecurring(c, userID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось получить повторяющуюся операцию")
+	}
+
+	// JSON накладывается поверх сохранённой операции: непереданные поля не меняются
+	r := existing
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+	r.ID, r.UserID, r.CreatedAt = existing.ID, existing.UserID, existing.CreatedAt
+	r.NextRun, r.Overrides = existing.NextRun, existing.Overrides
+
+	rule, err := prepare(context.Background(), &r)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось обновить повторяющуюся операцию")
+	}
+	if r.RRule != existing.RRule || r.StartDate != existing.StartDate || r.Timezone != existing.Timezone {
+		// Сегодняшний повтор, если он уже создан, не задублируется благодаря уникальному индексу
+		_, loc, _ := compile(r)
+		r.NextRun = nextRun(rule, dayStart(time.Now(), loc))
+	}
+
+	if _, err := database.RecurringCollection.ReplaceOne(context.Background(), bson.M{"_id": r.ID, "user_id": userID}, r); err != nil {
+		log.Printf("Ошибка обновления повторяющейся операции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить повторяющуюся операцию"})
+	}
+
+	return c.JSON(r)
+}
+
+// DeleteRecurring godoc
+// @Summary Удалить повторяющуюся операцию
+// @Description Уже созданные транзакции остаются.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID повторяющейся операции"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring/{id} [delete]
+func DeleteRecurring(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	result, err := database.RecurringCollection.DeleteOne(context.Background(), bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Printf("Ошибка удаления повторяющейся операции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить повторяющуюся операцию"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Повторяющаяся операция не найдена"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Повторяющаяся операция удалена"})
+}
+
+// GetOccurrences godoc
+// @Summary Предпросмотр ближайших повторов
+// @Description Повторы начиная с даты from с учётом пропусков и изменений; для уже созданных указан transaction_id.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID повторяющейся операции"
+// @Param from query string false "Дата YYYY-MM-DD, с которой показывать повторы (по умолчанию сегодня)"
+// @Param limit query int false "Количество повторов (по умолчанию 10, максимум 100)"
+// @Success 200 {array} Occurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring/{id}/occurrences [get]
+func GetOccurrences(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	r, err := findRecurring(c, userID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось получить повторяющуюся операцию")
+	}
+	rule, loc, err := compile(r)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось разобрать правило повторения")
+	}
+
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'limit' должен быть от 1 до 100"})
+	}
+	from := dayStart(time.Now(), loc)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation(dateLayout, value, loc); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'from' должен быть датой YYYY-MM-DD"})
+		}
+	}
+
+	dates := upcoming(rule, from, limit)
+	result := make([]Occurrence, 0, len(dates))
+	keys := make([]string, 0, len(dates))
+	for _, at := range dates {
+		t := occurrence(r, at, loc)
+		result = append(result, Occurrence{Date: t.Occurrence, Skipped: r.Overrides[t.Occurrence].Skip, Transaction: t})
+		keys = append(keys, t.Occurrence)
+	}
+
+	// Отмечаем повторы, которые планировщик уже создал
+	cursor, err := database.TransactionsCollection.Find(context.Background(),
+		bson.M{"user_id": userID, "recurring_id": r.ID, "occurrence": bson.M{"$in": keys}},
+		options.Find().SetProjection(bson.M{"_id": 1, "occurrence": 1}))
+	if err != nil {
+		log.Printf("Ошибка поиска созданных повторов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить повторы"})
+	}
+	var created []models.Transaction
+	if err := cursor.All(context.Background(), &created); err != nil {
+		log.Printf("Ошибка декодирования созданных повторов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить повторы"})
+	}
+	for _, t := range created {
+		for i := range result {
+			if result[i].Date == t.Occurrence {
+				id := t.ID
+				result[i].TransactionID = &id
+			}
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// findOccurrence проверяет, что у правила есть повтор в дату из пути и он ещё не создан.
+func findOccurrence(c *fiber.Ctx, r models.Recurring) (string, error) {
+	rule, loc, err := compile(r)
+	if err != nil {
+		return "", err
+	}
+	day, err := time.ParseInLocation(dateLayout, c.Params("date"), loc)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Дата повтора должна быть в формате YYYY-MM-DD")
+	}
+	// Повторы приходятся ровно на полночь своего дня
+	if !rule.After(day, true).Equal(day) {
+		return "", fiber.NewError(fiber.StatusNotFound, "В эту дату повтора нет")
+	}
+
+	date := day.Format(dateLayout)
+	count, err := database.TransactionsCollection.CountDocuments(context.Background(), bson.M{"recurring_id": r.ID, "occurrence": date})
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", fiber.NewError(fiber.StatusConflict, "Повтор уже создан — измените или удалите саму транзакцию")
+	}
+	return date, nil
+}
+
+// PutOccurrence godoc
+// @Summary Изменить один повтор
+// @Description Задаёт для повтора в дату date другие amount, description, category или пропуск (skip). Пустое тело отменяет изменения.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID повторяющейся операции"
+// @Param date path string true "Дата повтора YYYY-MM-DD"
+// @Param override body models.OccurrenceOverride true "Изменения повтора"
+// @Success 200 {object} Occurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring/{id}/occurrences/{date} [put]
+func PutOccurrence(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	var override models.OccurrenceOverride
+	if err := c.BodyParser(&override); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+	if override.Amount != nil && !override.Amount.IsPositive() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Сумма 'amount' должна быть положительной"})
+	}
+	if override.Category != "" {
+		exists, err := categories.Exists(context.Background(), userID, override.Category)
+		if err != nil {
+			log.Printf("Ошибка проверки категории: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить категорию"})
+		}
+		if !exists {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Категория '" + override.Category + "' не найдена"})
+		}
+	}
+
+	return saveOverride(c, userID, override)
+}
+
+// DeleteOccurrence godoc
+// @Summary Пропустить один повтор
+// @Description Повтор в дату date не будет создан. Отменить пропуск можно через PUT с пустым телом.
+// @Tags recurring
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID повторяющейся операции"
+// @Param date path string true "Дата повтора YYYY-MM-DD"
+// @Success 200 {object} Occurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/recurring/{id}/occurrences/{date} [delete]
+func DeleteOccurrence(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	return saveOverride(c, userID, models.OccurrenceOverride{Skip: true})
+}
+
+// saveOverride сохраняет изменение повтора из пути запроса; пустое изменение удаляется.
+func saveOverride(c *fiber.Ctx, userID primitive.ObjectID, override models.OccurrenceOverride) error {
+	r, err := findRecurring(c, userID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось получить повторяющуюся операцию")
+	}
+	date, err := findOccurrence(c, r)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить повтор")
+	}
+
+	field := "overrides." + date
+	update := bson.M{"$set": bson.M{field: override}}
+	if override == (models.OccurrenceOverride{}) {
+		update = bson.M{"$unset": bson.M{field: ""}}
+	}
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := database.RecurringCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": r.ID, "user_id": userID}, update, after).Decode(&r); err != nil {
+		log.Printf("Ошибка сохранения изменения повтора: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось сохранить изменение повтора"})
+	}
+
+	_, loc, _ := compile(r)
+	day, _ := time.ParseInLocation(dateLayout, date, loc)
+	return c.JSON(Occurrence{Date: date, Skipped: r.Overrides[date].Skip, Transaction: occurrence(r, day, loc)})
+}
@@ -0,0 +1,104 @@
+package recurring
+
+import (
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/teambition/rrule-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// dateLayout — формат start_date и дат повторов.
+const dateLayout = "2006-01-02"
+
+// compile строит правило повторения: DTSTART — полночь start_date в часовом поясе правила.
+// Ошибки в правиле возвращаются как *fiber.Error со статусом 400.
+func compile(r models.Recurring) (*rrule.RRule, *time.Location, error) {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Неизвестный часовой пояс в поле 'timezone'")
+	}
+	start, err := time.ParseInLocation(dateLayout, r.StartDate, loc)
+	if err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Поле 'start_date' должно быть датой YYYY-MM-DD")
+	}
+
+	option, err := rrule.StrToROptionInLocation(strings.TrimPrefix(strings.TrimSpace(r.RRule), "RRULE:"), loc)
+	if err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Некорректное правило 'rrule': "+err.Error())
+	}
+	// Повтор определяется датой, поэтому чаще раза в день повторять нельзя
+	if option.Freq > rrule.DAILY || len(option.Byhour)+len(option.Byminute)+len(option.Bysecond) > 0 {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Поддерживаются FREQ=DAILY, WEEKLY, MONTHLY и YEARLY без BYHOUR, BYMINUTE и BYSECOND")
+	}
+	option.Dtstart = start
+
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Некорректное правило 'rrule': "+err.Error())
+	}
+	return rule, loc, nil
+}
+
+// dayStart возвращает полночь дня момента t в часовом поясе loc.
+func dayStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// upcoming возвращает до limit повторов не раньше from.
+func upcoming(rule *rrule.RRule, from time.Time, limit int) []time.Time {
+	var result []time.Time
+	next := rule.Iterator()
+	for len(result) < limit {
+		at, ok := next()
+		if !ok {
+			break
+		}
+		if !at.Before(from) {
+			result = append(result, at)
+		}
+	}
+	return result
+}
+
+// nextRun возвращает первый повтор не раньше from или nil, если повторы закончились.
+func nextRun(rule *rrule.RRule, from time.Time) *primitive.DateTime {
+	at := rule.After(from, true)
+	if at.IsZero() {
+		return nil
+	}
+	next := primitive.NewDateTimeFromTime(at)
+	return &next
+}
+
+// occurrence строит транзакцию повтора с датой at из шаблона с учётом изменений этого повтора.
+func occurrence(r models.Recurring, at time.Time, loc *time.Location) models.Transaction {
+	date := at.In(loc).Format(dateLayout)
+	recurringID := r.ID
+	t := models.Transaction{
+		UserID:      r.UserID,
+		Date:        primitive.NewDateTimeFromTime(at),
+		Description: r.Description,
+		Category:    r.Category,
+		Amount:      r.Amount,
+		Currency:    r.Currency,
+		Type:        r.Type,
+		AccountID:   r.AccountID,
+		RecurringID: &recurringID,
+		Occurrence:  date,
+	}
+
+	override := r.Overrides[date]
+	if override.Amount != nil {
+		t.Amount = override.Amount.Round(r.Currency)
+	}
+	if override.Description != "" {
+		t.Description = override.Description
+	}
+	if override.Category != "" {
+		t.Category = override.Category
+	}
+	return t
+}
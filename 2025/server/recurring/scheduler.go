@@ -0,0 +1,122 @@
+package recurring
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// RunScheduler раз в interval создаёт наступившие повторы всех пользователей.
+// Запускается в отдельной горутине и работает до отмены ctx.
+func RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := MaterializeDue(ctx, time.Now())
+		if err != nil {
+			log.Printf("Ошибка планировщика повторяющихся операций: %v\n", err)
+		} else if created > 0 {
+			log.Printf("Планировщик создал повторов: %d\n", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaterializeDue создаёт транзакции для всех повторов с датой не позже now.
+// Ошибка одного правила не останавливает обработку остальных.
+func MaterializeDue(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := database.RecurringCollection.Find(ctx, bson.M{"next_run": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	total := 0
+	for cursor.Next(ctx) {
+		var r models.Recurring
+		if err := cursor.Decode(&r); err != nil {
+			log.Printf("Ошибка декодирования повторяющейся операции: %v\n", err)
+			continue
+		}
+		created, err := materialize(ctx, r, now)
+		total += created
+		if err != nil {
+			log.Printf("Ошибка создания повторов операции %s: %v\n", r.ID.Hex(), err)
+		}
+	}
+	return total, cursor.Err()
+}
+
+// materialize создаёт транзакции для повторов правила с next_run по now и сдвигает next_run.
+//
+// Каждый повтор создаётся ровно один раз: уникальный индекс (recurring_id, occurrence)
+// отклоняет повторную вставку, если сервер упал между вставкой и сдвигом next_run
+// или правило одновременно обрабатывают два экземпляра сервера.
+func materialize(ctx context.Context, r models.Recurring, now time.Time) (int, error) {
+	if r.NextRun == nil {
+		return 0, nil
+	}
+	rule, loc, err := compile(r)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, at := range rule.Between(r.NextRun.Time(), now, true) {
+		if r.Overrides[at.In(loc).Format(dateLayout)].Skip {
+			continue
+		}
+		t := occurrence(r, at, loc)
+		t.ID = primitive.NewObjectID()
+		// Категорию из изменения повтора могли удалить: тогда повтор создаётся с категорией шаблона
+		if t.Category != r.Category {
+			exists, err := categories.Exists(ctx, r.UserID, t.Category)
+			if err != nil {
+				return created, err
+			}
+			if !exists {
+				log.Printf("Категория '%s' повтора %s операции %s удалена, используется категория шаблона\n", t.Category, t.Occurrence, r.ID.Hex())
+				t.Category = r.Category
+			}
+		}
+		_, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			if _, err := database.TransactionsCollection.InsertOne(sessCtx, t); err != nil {
+				return nil, err
+			}
+			return nil, history.Record(sessCtx, history.Origin{Source: history.SourceRecurring}, history.ActionCreate, history.Change{After: &t})
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			// next_run не сдвигаем: оставшиеся повторы создадутся при следующем запуске
+			return created, err
+		}
+		created++
+		if err := suggest.Learn(ctx, r.UserID, t); err != nil {
+			log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+		}
+	}
+
+	// Условие на старый next_run не даёт затереть расписание, изменённое параллельно
+	update := bson.M{"$unset": bson.M{"next_run": ""}}
+	if next := nextRun(rule, now.Add(time.Second)); next != nil {
+		update = bson.M{"$set": bson.M{"next_run": next}}
+	}
+	_, err = database.RecurringCollection.UpdateOne(ctx, bson.M{"_id": r.ID, "next_run": r.NextRun}, update)
+	return created, err
+}
@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strings"
+)
+
+// compiled — правило с подготовленными условиями.
+type compiled struct {
+	rule     models.Rule
+	contains string         // Подстрока в нижнем регистре
+	pattern  *regexp.Regexp // nil — условия по регулярному выражению нет
+}
+
+// Engine — включённые правила пользователя в порядке проверки.
+type Engine struct {
+	rules    []compiled
+	accounts map[primitive.ObjectID]string // Валюты счетов, которые устанавливают правила
+}
+
+// Result — что устанавливают подошедшие правила. Категорию и счёт задаёт первое правило,
+// в котором они указаны; теги складываются из всех подошедших правил.
+type Result struct {
+	Category  string
+	Tags      []string
+	AccountID *primitive.ObjectID
+	Rules     []primitive.ObjectID // Подошедшие правила в порядке проверки
+}
+
+// fold приводит текст к виду для сравнения без учёта регистра и различия е/ё.
+func fold(text string) string {
+	return strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+}
+
+// compile готовит условия правила. Регулярное выражение проверяется при сохранении правила.
+func compile(rule models.Rule) (compiled, error) {
+	c := compiled{rule: rule, contains: fold(rule.Match.DescriptionContains)}
+	if rule.Match.DescriptionRegex != "" {
+		pattern, err := regexp.Compile("(?i)" + rule.Match.DescriptionRegex)
+		if err != nil {
+			return compiled{}, err
+		}
+		c.pattern = pattern
+	}
+	return c, nil
+}
+
+// matches проверяет все условия правила для транзакции.
+func (c compiled) matches(t models.Transaction) bool {
+	m := c.rule.Match
+	if c.contains != "" && !strings.Contains(fold(t.Description), c.contains) {
+		return false
+	}
+	if c.pattern != nil && !c.pattern.MatchString(t.Description) {
+		return false
+	}
+	if m.MinAmount != nil && t.Amount.Cmp(*m.MinAmount) < 0 {
+		return false
+	}
+	if m.MaxAmount != nil && t.Amount.Cmp(*m.MaxAmount) > 0 {
+		return false
+	}
+	switch m.Type {
+	case "income":
+		return t.Type
+	case "expense":
+		return !t.Type
+	}
+	return true
+}
+
+// Load загружает включённые правила пользователя и валюты счетов, которые они устанавливают.
+// Правило с некорректным регулярным выражением пропускается.
+func Load(ctx context.Context, userID primitive.ObjectID) (*Engine, error) {
+	return load(ctx, bson.M{"user_id": userID, "disabled": bson.M{"$ne": true}})
+}
+
+// LoadRule загружает одно правило пользователя, в том числе выключенное. Без правила движок пуст.
+func LoadRule(ctx context.Context, userID primitive.ObjectID, ruleID primitive.ObjectID) (*Engine, error) {
+	return load(ctx, bson.M{"_id": ruleID, "user_id": userID})
+}
+
+// load загружает правила по фильтру в порядке проверки.
+func load(ctx context.Context, filter bson.M) (*Engine, error) {
+	sortOrder := bson.D{{Key: "priority", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := database.RulesCollection.Find(ctx, filter, options.Find().SetSort(sortOrder))
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Rule
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{accounts: map[primitive.ObjectID]string{}}
+	var accountIDs []primitive.ObjectID
+	for _, rule := range list {
+		c, err := compile(rule)
+		if err != nil {
+			continue
+		}
+		e.rules = append(e.rules, c)
+		if rule.Set.AccountID != nil {
+			accountIDs = append(accountIDs, *rule.Set.AccountID)
+		}
+	}
+
+	if len(accountIDs) > 0 {
+		cursor, err := database.AccountsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": accountIDs}})
+		if err != nil {
+			return nil, err
+		}
+		var accounts []models.Account
+		if err := cursor.All(ctx, &accounts); err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			e.accounts[account.ID] = account.Currency
+		}
+	}
+	return e, nil
+}
+
+// Empty сообщает, что правил нет.
+func (e *Engine) Empty() bool {
+	return len(e.rules) == 0
+}
+
+// Evaluate проверяет правила по порядку. Счёт правила предлагается только транзакции без счёта
+// в валюте этого счёта (или без валюты): перенос операции между валютами правилом не делается.
+func (e *Engine) Evaluate(t models.Transaction) Result {
+	var r Result
+	for _, c := range e.rules {
+		if !c.matches(t) {
+			continue
+		}
+		r.Rules = append(r.Rules, c.rule.ID)
+		set := c.rule.Set
+		if r.Category == "" {
+			r.Category = set.Category
+		}
+		if r.AccountID == nil && set.AccountID != nil && t.AccountID == nil {
+			currency, ok := e.accounts[*set.AccountID]
+			if ok && (t.Currency == "" || t.Currency == currency) {
+				r.AccountID = set.AccountID
+			}
+		}
+		r.Tags = tags.Merge(r.Tags, set.Tags)
+	}
+	return r
+}
+
+// Fill дополняет новую транзакцию по правилам: пустые категория и счёт заполняются,
+// теги добавляются к переданным. Возвращает подошедшие правила.
+func (e *Engine) Fill(t *models.Transaction) []primitive.ObjectID {
+	r := e.Evaluate(*t)
+	if t.Category == "" {
+		t.Category = r.Category
+	}
+	if t.AccountID == nil {
+		t.AccountID = r.AccountID
+	}
+	t.Tags = tags.Merge(t.Tags, r.Tags)
+	return r.Rules
+}
@@ -0,0 +1,268 @@
+package rules
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxRegexLength — ограничение длины регулярного выражения правила.
+const maxRegexLength = 200
+
+// validate проверяет и нормализует правило перед сохранением.
+// Ошибки валидации возвращаются как *fiber.Error со статусом 400.
+func validate(ctx context.Context, rule *models.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'name' обязательно")
+	}
+
+	m := &rule.Match
+	m.DescriptionContains = strings.TrimSpace(m.DescriptionContains)
+	if m.DescriptionContains == "" && m.DescriptionRegex == "" && m.MinAmount == nil && m.MaxAmount == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Укажите хотя бы одно условие: description_contains, description_regex, min_amount или max_amount")
+	}
+	if m.DescriptionRegex != "" {
+		if len(m.DescriptionRegex) > maxRegexLength {
+			return fiber.NewError(fiber.StatusBadRequest, "Регулярное выражение длиннее 200 символов")
+		}
+		if _, err := regexp.Compile(m.DescriptionRegex); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Некорректное регулярное выражение: "+err.Error())
+		}
+	}
+	if (m.MinAmount != nil && m.MinAmount.Sign() < 0) || (m.MaxAmount != nil && m.MaxAmount.Sign() < 0) {
+		return fiber.NewError(fiber.StatusBadRequest, "Суммы условия не могут быть отрицательными")
+	}
+	if m.MinAmount != nil && m.MaxAmount != nil && m.MinAmount.Cmp(*m.MaxAmount) > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'min_amount' не может быть больше 'max_amount'")
+	}
+	if m.Type != "" && m.Type != "income" && m.Type != "expense" {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'type' должно быть 'income' или 'expense'")
+	}
+
+	set := &rule.Set
+	var err error
+	if set.Tags, err = tags.Normalize(set.Tags); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if set.AccountID != nil && set.AccountID.IsZero() {
+		set.AccountID = nil
+	}
+	if set.Category == "" && len(set.Tags) == 0 && set.AccountID == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Укажите, что устанавливает правило: category, tags или account_id")
+	}
+	if set.Category != "" {
+		exists, err := categories.Exists(ctx, rule.UserID, set.Category)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusBadRequest, "Категория '"+set.Category+"' не найдена")
+		}
+	}
+	if set.AccountID != nil {
+		account, err := accounts.Find(ctx, rule.UserID, *set.AccountID)
+		if err != nil {
+			return err
+		}
+		if account == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Счёт не найден")
+		}
+	}
+	return nil
+}
+
+// GetRules godoc
+// @Summary Получить правила категоризации
+// @Description Правила в порядке проверки: по возрастанию priority, затем по дате создания.
+// @Tags rules
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.Rule
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rules [get]
+func GetRules(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	sortOrder := bson.D{{Key: "priority", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := database.RulesCollection.Find(context.Background(), bson.M{"user_id": userID}, options.Find().SetSort(sortOrder))
+	if err != nil {
+		log.Printf("Ошибка при поиске правил: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить правила"})
+	}
+
+	list := []models.Rule{}
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования правил: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования правил"})
+	}
+
+	return c.JSON(list)
+}
+
+// PostRule godoc
+// @Summary Создать правило категоризации
+// @Description Правило применяется к новым транзакциям (POST /api/transactions и импорт выписок) и по запросу к уже сохранённым (POST /api/rules/apply).
+// @Description Условия match выполняются все сразу; set задаёт категорию, добавляемые теги и счёт.
+// @Tags rules
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param rule body models.Rule true "Данные правила"
+// @Success 201 {object} models.Rule
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rules [post]
+func PostRule(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	rule := new(models.Rule)
+	if err := c.BodyParser(rule); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	rule.ID = primitive.NilObjectID
+	rule.UserID = userID
+	rule.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := validate(context.Background(), rule); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось создать правило")
+	}
+
+	insertRes, err := database.RulesCollection.InsertOne(context.Background(), rule)
+	if err != nil {
+		log.Printf("Ошибка вставки правила: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать правило"})
+	}
+
+	rule.ID = insertRes.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateRule godoc
+// @Summary Обновить правило категоризации
+// @Description Переданные поля накладываются на текущее правило, после чего оно проверяется целиком. Объекты match и set заменяются целиком.
+// @Tags rules
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID правила"
+// @Param update body map[string]interface{} true "Поля: name, priority, disabled, match, set"
+// @Success 200 {object} models.Rule
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rules/{id} [patch]
+func UpdateRule(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	filter := bson.M{"_id": objectID, "user_id": userID}
+	var rule models.Rule
+	if err := database.RulesCollection.FindOne(context.Background(), filter).Decode(&rule); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Правило не найдено"})
+	}
+
+	// Условия и действия заменяются целиком: иначе не убрать условие, заданное раньше
+	var patch struct {
+		models.Rule
+		Match *models.RuleMatch `json:"match"`
+		Set   *models.RuleSet   `json:"set"`
+	}
+	patch.Rule = rule
+	if err := c.BodyParser(&patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+	rule = patch.Rule
+	if patch.Match != nil {
+		rule.Match = *patch.Match
+	}
+	if patch.Set != nil {
+		rule.Set = *patch.Set
+	}
+	rule.ID = objectID
+	rule.UserID = userID
+	if err := validate(context.Background(), &rule); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось обновить правило")
+	}
+
+	result, err := database.RulesCollection.ReplaceOne(context.Background(), filter, rule)
+	if err != nil {
+		log.Printf("Ошибка обновления правила: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить правило"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Правило не найдено"})
+	}
+
+	return c.JSON(rule)
+}
+
+// DeleteRule godoc
+// @Summary Удалить правило категоризации
+// @Description Транзакции, уже изменённые правилом, остаются как есть.
+// @Tags rules
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID правила"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rules/{id} [delete]
+func DeleteRule(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	result, err := database.RulesCollection.DeleteOne(context.Background(), bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Printf("Ошибка удаления правила: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить правило"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Правило не найдено"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Правило успешно удалено"})
+}
@@ -0,0 +1,305 @@
+package statistics
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/auth"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/rates"
+	"github.com/IIkar/WealFlow/2025/transactions"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"strings"
+)
+
+// intervals — допустимые шаги временного ряда (единицы $dateTrunc).
+var intervals = map[string]bool{
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+}
+
+// Totals — итоговые суммы за период.
+type Totals struct {
+	Income  money.Amount `json:"income" bson:"income"`
+	Expense money.Amount `json:"expense" bson:"expense"`
+	Net     money.Amount `json:"net" bson:"net"`
+	Count   int64        `json:"count" bson:"count"`
+}
+
+// CategoryTotal — сумма операций одной категории и одного типа.
+type CategoryTotal struct {
+	Category string       `json:"category" bson:"category"`
+	Type     string       `json:"type" bson:"type"` // income или expense
+	Total    money.Amount `json:"total" bson:"total"`
+	Count    int64        `json:"count" bson:"count"`
+}
+
+// TagTotal — сумма операций с одним тегом и одного типа. Операция с несколькими тегами входит в сумму каждого.
+type TagTotal struct {
+	Tag   string       `json:"tag" bson:"tag"`
+	Type  string       `json:"type" bson:"type"` // income или expense
+	Total money.Amount `json:"total" bson:"total"`
+	Count int64        `json:"count" bson:"count"`
+}
+
+// SeriesPoint — точка временного ряда; Period — начало интервала в выбранном часовом поясе.
+type SeriesPoint struct {
+	Period  primitive.DateTime `json:"period" bson:"period"`
+	Income  money.Amount       `json:"income" bson:"income"`
+	Expense money.Amount       `json:"expense" bson:"expense"`
+	Net     money.Amount       `json:"net" bson:"net"`
+}
+
+// MissingRate — валюта, для операций в которой не нашёлся курс к валюте статистики.
+// Такие операции не входят в суммы.
+type MissingRate struct {
+	Currency string `json:"currency" bson:"currency"`
+	Count    int64  `json:"count" bson:"count"`
+}
+
+// Statistics — ответ эндпоинта статистики. Все суммы — в валюте Currency.
+type Statistics struct {
+	Group        string          `json:"group"`
+	Interval     string          `json:"interval"`
+	Timezone     string          `json:"timezone"`
+	Currency     string          `json:"currency"`
+	Totals       Totals          `json:"totals"`
+	Categories   []CategoryTotal `json:"categories"`
+	Tags         []TagTotal      `json:"tags"`
+	Series       []SeriesPoint   `json:"series"`
+	MissingRates []MissingRate   `json:"missing_rates"`
+}
+
+// facetResult — сырой результат стадии $facet.
+type facetResult struct {
+	Totals       []Totals        `bson:"totals"`
+	Categories   []CategoryTotal `bson:"categories"`
+	Tags         []TagTotal      `bson:"tags"`
+	Series       []SeriesPoint   `bson:"series"`
+	MissingRates []MissingRate   `bson:"missing_rates"`
+}
+
+// amountField — сумма операции, пересчитанная в валюту статистики.
+const amountField = "$" + rates.ConvertedField
+
+// incomeExpr и expenseExpr раскладывают сумму операции по типу.
+// Поле type с omitempty отсутствует у расходов, поэтому сравниваем с true.
+var (
+	incomeExpr  = bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", true}}, amountField, 0}}
+	expenseExpr = bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", true}}, 0, amountField}}
+)
+
+// buildPipeline строит агрегацию: итоги, разбивку по категориям и тегам и временной ряд за один проход.
+// Транзакция с разбивкой учитывается по частям: каждая часть попадает в свою категорию, а при фильтре
+// categoryNames — только подходящие части. Суммы пересчитываются в currency по курсу на дату каждой операции;
+// операции без курса попадают только в missing_rates. categoryExpr задаёт поле группировки категорий (см. categories.Tree.GroupExpr).
+func buildPipeline(match bson.M, categoryNames []string, categoryExpr interface{}, interval string, timezone string, currency string) mongo.Pipeline {
+	converted := bson.M{"$match": bson.M{rates.ConvertedField: bson.M{"$ne": nil}}}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	pipeline = append(pipeline, transactions.SplitStages(categoryNames)...)
+	pipeline = append(pipeline, rates.ConvertStages(currency)...)
+	return append(pipeline,
+		bson.D{{Key: "$facet", Value: bson.M{
+			"missing_rates": bson.A{
+				bson.M{"$match": bson.M{rates.ConvertedField: nil}},
+				bson.M{"$group": bson.M{"_id": "$currency", "count": bson.M{"$sum": transactions.TransactionCountExpr}}},
+				bson.M{"$project": bson.M{"_id": 0, "currency": "$_id", "count": 1}},
+				bson.M{"$sort": bson.M{"currency": 1}},
+			},
+			"totals": bson.A{
+				converted,
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"income":  bson.M{"$sum": incomeExpr},
+					"expense": bson.M{"$sum": expenseExpr},
+					"count":   bson.M{"$sum": transactions.TransactionCountExpr},
+				}},
+				bson.M{"$project": bson.M{
+					"_id":     0,
+					"income":  1,
+					"expense": 1,
+					"count":   1,
+					"net":     bson.M{"$subtract": bson.A{"$income", "$expense"}},
+				}},
+			},
+			"categories": bson.A{
+				converted,
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"category": categoryExpr, "income": bson.M{"$eq": bson.A{"$type", true}}},
+					"total": bson.M{"$sum": amountField},
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$project": bson.M{
+					"_id":      0,
+					"category": "$_id.category",
+					"type":     bson.M{"$cond": bson.A{"$_id.income", "income", "expense"}},
+					"total":    1,
+					"count":    1,
+				}},
+				bson.M{"$sort": bson.D{{Key: "total", Value: -1}, {Key: "category", Value: 1}}},
+			},
+			"tags": bson.A{
+				converted,
+				bson.M{"$unwind": "$tags"},
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"tag": "$tags", "income": bson.M{"$eq": bson.A{"$type", true}}},
+					"total": bson.M{"$sum": amountField},
+					"count": bson.M{"$sum": transactions.TransactionCountExpr},
+				}},
+				bson.M{"$project": bson.M{
+					"_id":   0,
+					"tag":   "$_id.tag",
+					"type":  bson.M{"$cond": bson.A{"$_id.income", "income", "expense"}},
+					"total": 1,
+					"count": 1,
+				}},
+				bson.M{"$sort": bson.D{{Key: "total", Value: -1}, {Key: "tag", Value: 1}}},
+			},
+			"series": bson.A{
+				converted,
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateTrunc": bson.M{
+						"date":        "$date",
+						"unit":        interval,
+						"timezone":    timezone,
+						"startOfWeek": "monday",
+					}},
+					"income":  bson.M{"$sum": incomeExpr},
+					"expense": bson.M{"$sum": expenseExpr},
+				}},
+				bson.M{"$project": bson.M{
+					"_id":     0,
+					"period":  "$_id",
+					"income":  1,
+					"expense": 1,
+					"net":     bson.M{"$subtract": bson.A{"$income", "$expense"}},
+				}},
+				bson.M{"$sort": bson.M{"period": 1}},
+			},
+		}}},
+	)
+}
+
+// GetStatistics godoc
+// @Summary Получить агрегированную статистику
+// @Description Итоги, разбивка по категориям и тегам и временной ряд по транзакциям пользователя. Принимает те же фильтры, что и список транзакций.
+// @Description Переводы между счетами не учитываются. Суммы пересчитываются в базовую валюту пользователя по курсу на дату каждой операции;
+// @Description валюты без курса перечислены в missing_rates и в суммы не входят.
+// @Tags statistics
+// @Security ApiKeyAuth
+// @Produce json
+// @Param from query string false "Начало периода (YYYY-MM-DD или ISO 8601)"
+// @Param to query string false "Конец периода включительно (YYYY-MM-DD или ISO 8601)"
+// @Param interval query string false "Шаг временного ряда: day, week, month, year (по умолчанию month)"
+// @Param tz query string false "Часовой пояс IANA для границ дат и интервалов (по умолчанию UTC)"
+// @Param type query string false "Тип: income или expense"
+// @Param category query string false "Список категорий через запятую (включая подкатегории)"
+// @Param tag query string false "Список тегов через запятую: операции хотя бы с одним из них"
+// @Param currency query string false "Валюта статистики ISO 4217 (по умолчанию базовая валюта пользователя)"
+// @Param group query string false "Группировка категорий: leaf (как есть) или top (свёртка в корневые), по умолчанию leaf"
+// @Success 200 {object} Statistics
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/statistics [get]
+func GetStatistics(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	interval := c.Query("interval", "month")
+	if !intervals[interval] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'interval' должен быть одним из: day, week, month, year"})
+	}
+
+	group, err := categories.ParseGroup(c.Query("group"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency == "" {
+		currency, err = auth.BaseCurrency(context.Background(), userID)
+		if err != nil {
+			log.Printf("Ошибка получения базовой валюты: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать статистику"})
+		}
+	}
+	if !money.ValidCurrency(currency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'currency' должен быть кодом валюты ISO 4217, например RUB"})
+	}
+
+	loc, err := transactions.ParseLocation(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Переводы между счетами не являются ни доходом, ни расходом
+	if c.Query("type") == "transfer" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Статистика не считается по переводам"})
+	}
+	match, err := transactions.ParseFilter(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	match["kind"] = bson.M{"$ne": models.KindTransfer}
+
+	tree, err := categories.LoadTree(context.Background(), userID)
+	if err != nil {
+		log.Printf("Ошибка загрузки дерева категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать статистику"})
+	}
+
+	pipeline := buildPipeline(match, transactions.ParseCategories(c, userID), tree.GroupExpr(group), interval, loc.String(), currency)
+	cursor, err := database.TransactionsCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		log.Printf("Ошибка агрегации статистики: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось посчитать статистику"})
+	}
+
+	var results []facetResult
+	if err := cursor.All(context.Background(), &results); err != nil {
+		log.Printf("Ошибка декодирования статистики: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования статистики"})
+	}
+
+	stats := Statistics{
+		Group:        group,
+		Interval:     interval,
+		Timezone:     loc.String(),
+		Currency:     currency,
+		Categories:   []CategoryTotal{},
+		Tags:         []TagTotal{},
+		Series:       []SeriesPoint{},
+		MissingRates: []MissingRate{},
+	}
+	if len(results) > 0 {
+		if len(results[0].Totals) > 0 {
+			stats.Totals = results[0].Totals[0]
+		}
+		if results[0].Categories != nil {
+			stats.Categories = results[0].Categories
+		}
+		if results[0].Tags != nil {
+			stats.Tags = results[0].Tags
+		}
+		if results[0].Series != nil {
+			stats.Series = results[0].Series
+		}
+		if results[0].MissingRates != nil {
+			stats.MissingRates = results[0].MissingRates
+		}
+	}
+
+	return c.JSON(stats)
+}
@@ -0,0 +1,250 @@
+package suggest
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// categoryWords — статистика слов одной категории пользователя для наивного байесовского классификатора.
+// Слово считается один раз на транзакцию: в коротком описании повтор ничего не добавляет.
+type categoryWords struct {
+	UserID   primitive.ObjectID `bson:"user_id"`
+	Category string             `bson:"category"`
+	Docs     int                `bson:"docs"`   // Транзакций категории
+	Tokens   int                `bson:"tokens"` // Сумма words
+	Words    map[string]int     `bson:"words"`  // Число транзакций категории с этим словом
+}
+
+// Suggestion — предлагаемая категория и уверенность от 0 до 1. Уверенности всех категорий в сумме дают 1.
+type Suggestion struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Tokens разбивает описание на слова для модели: нижний регистр, е вместо ё, без чисел и однобуквенных слов.
+// Слова не повторяются.
+func Tokens(description string) []string {
+	fields := strings.FieldsFunc(strings.ReplaceAll(strings.ToLower(description), "ё", "е"), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	result := make([]string, 0, len(fields))
+	for _, word := range fields {
+		if utf8.RuneCountInString(word) < 2 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		result = append(result, word)
+	}
+	return result
+}
+
+// learnable сообщает, участвует ли транзакция в обучении: переводы категорий не имеют.
+func learnable(t models.Transaction) bool {
+	return t.Kind != models.KindTransfer && t.Category != "" && t.Description != ""
+}
+
+// counts складывает статистику транзакций по категориям.
+func counts(list []models.Transaction) map[string]*categoryWords {
+	result := map[string]*categoryWords{}
+	for _, t := range list {
+		if !learnable(t) {
+			continue
+		}
+		stats := result[t.Category]
+		if stats == nil {
+			stats = &categoryWords{UserID: t.UserID, Category: t.Category, Words: map[string]int{}}
+			result[t.Category] = stats
+		}
+		stats.Docs++
+		for _, word := range Tokens(t.Description) {
+			stats.Words[word]++
+			stats.Tokens++
+		}
+	}
+	return result
+}
+
+// trained сообщает, есть ли у пользователя обученная модель.
+func trained(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	count, err := database.CategoryWordsCollection.CountDocuments(ctx, bson.M{"user_id": userID}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// update прибавляет (sign = 1) или вычитает (sign = -1) статистику транзакций.
+// Пока модель не обучена, ничего не делает: полное обучение при первой подсказке учтёт все транзакции.
+func update(ctx context.Context, userID primitive.ObjectID, list []models.Transaction, sign int) error {
+	byCategory := counts(list)
+	if len(byCategory) == 0 {
+		return nil
+	}
+	ok, err := trained(ctx, userID)
+	if err != nil || !ok {
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(byCategory))
+	for category, stats := range byCategory {
+		inc := bson.M{"docs": sign * stats.Docs, "tokens": sign * stats.Tokens}
+		for word, n := range stats.Words {
+			inc["words."+word] = sign * n
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user_id": userID, "category": category}).
+			SetUpdate(bson.M{"$inc": inc}).
+			SetUpsert(sign > 0))
+	}
+	_, err = database.CategoryWordsCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Learn дообучает модель на новых или изменённых транзакциях.
+func Learn(ctx context.Context, userID primitive.ObjectID, list ...models.Transaction) error {
+	return update(ctx, userID, list, 1)
+}
+
+// Forget убирает из модели удалённые транзакции или их старые категории и описания.
+func Forget(ctx context.Context, userID primitive.ObjectID, list ...models.Transaction) error {
+	return update(ctx, userID, list, -1)
+}
+
+// Reset удаляет модель пользователя после массовых изменений; при следующей подсказке она обучится заново.
+func Reset(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := database.CategoryWordsCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// train обучает модель заново по всем транзакциям пользователя. Категории записываются целиком,
+// поэтому одновременное обучение двумя запросами даёт тот же результат.
+func train(ctx context.Context, userID primitive.ObjectID) (map[string]*categoryWords, error) {
+	filter := bson.M{"user_id": userID, "kind": bson.M{"$ne": models.KindTransfer}}
+	projection := bson.M{"user_id": 1, "description": 1, "category": 1}
+	cursor, err := database.TransactionsCollection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Transaction
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	byCategory := counts(list)
+	for category, stats := range byCategory {
+		_, err := database.CategoryWordsCollection.ReplaceOne(ctx,
+			bson.M{"user_id": userID, "category": category}, stats, options.Replace().SetUpsert(true))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return byCategory, nil
+}
+
+// load загружает модель пользователя, при её отсутствии — обучает.
+func load(ctx context.Context, userID primitive.ObjectID) (map[string]*categoryWords, error) {
+	cursor, err := database.CategoryWordsCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var list []categoryWords
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return train(ctx, userID)
+	}
+	byCategory := make(map[string]*categoryWords, len(list))
+	for i := range list {
+		byCategory[list[i].Category] = &list[i]
+	}
+	return byCategory, nil
+}
+
+// rank оценивает категории для описания: log P(c) + Σ log P(слово|c) со сглаживанием Лапласа,
+// затем переводит оценки в вероятности. Слова, которых модель не видела, не учитываются;
+// если неизвестны все слова, подсказок нет.
+func rank(byCategory map[string]*categoryWords, description string) []Suggestion {
+	vocabulary := map[string]bool{}
+	totalDocs := 0
+	for _, stats := range byCategory {
+		if stats.Docs <= 0 {
+			continue
+		}
+		totalDocs += stats.Docs
+		for word, n := range stats.Words {
+			if n > 0 {
+				vocabulary[word] = true
+			}
+		}
+	}
+
+	var known []string
+	for _, word := range Tokens(description) {
+		if vocabulary[word] {
+			known = append(known, word)
+		}
+	}
+	if len(known) == 0 {
+		return []Suggestion{}
+	}
+
+	scores := map[string]float64{}
+	best := math.Inf(-1)
+	for category, stats := range byCategory {
+		if stats.Docs <= 0 {
+			continue
+		}
+		score := math.Log(float64(stats.Docs) / float64(totalDocs))
+		for _, word := range known {
+			score += math.Log(float64(stats.Words[word]+1) / float64(stats.Tokens+len(vocabulary)))
+		}
+		scores[category] = score
+		best = math.Max(best, score)
+	}
+
+	// Вычитаем максимум, чтобы экспонента не ушла в ноль
+	sum := 0.0
+	for category, score := range scores {
+		scores[category] = math.Exp(score - best)
+		sum += scores[category]
+	}
+	result := make([]Suggestion, 0, len(scores))
+	for category, weight := range scores {
+		result = append(result, Suggestion{Category: category, Confidence: math.Round(weight/sum*1000) / 1000})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].Category < result[j].Category
+	})
+	return result
+}
+
+// Suggest возвращает до limit категорий для описания в порядке убывания уверенности.
+// Категории, которых у пользователя больше нет, пропускаются через exists.
+func Suggest(ctx context.Context, userID primitive.ObjectID, description string, limit int, exists func(string) bool) ([]Suggestion, error) {
+	byCategory, err := load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for category := range byCategory {
+		if !exists(category) {
+			delete(byCategory, category)
+		}
+	}
+	result := rank(byCategory, description)
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
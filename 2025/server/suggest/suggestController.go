@@ -0,0 +1,56 @@
+package suggest
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"strings"
+)
+
+// GetSuggestions godoc
+// @Summary Подсказать категорию по описанию
+// @Description Категории предлагаются по истории пользователя: наивный байесовский классификатор по словам описаний категоризированных транзакций.
+// @Description Модель обучается при первом запросе и дообучается при создании, изменении, удалении и импорте транзакций.
+// @Description Если ни одно слово описания ещё не встречалось, список пуст.
+// @Tags categories
+// @Security ApiKeyAuth
+// @Produce json
+// @Param description query string true "Описание транзакции"
+// @Param limit query int false "Сколько категорий вернуть, от 1 до 20 (по умолчанию 3)"
+// @Success 200 {array} suggest.Suggestion
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/categories/suggest [get]
+func GetSuggestions(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	description := strings.TrimSpace(c.Query("description"))
+	if description == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'description' обязателен"})
+	}
+	limit := c.QueryInt("limit", 3)
+	if limit < 1 || limit > 20 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'limit' должен быть от 1 до 20"})
+	}
+
+	tree, err := categories.LoadTree(context.Background(), userID)
+	if err != nil {
+		log.Printf("Ошибка загрузки категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось загрузить категории"})
+	}
+
+	list, err := Suggest(context.Background(), userID, description, limit, tree.Has)
+	if err != nil {
+		log.Printf("Ошибка подсказки категорий: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось подобрать категории"})
+	}
+
+	return c.JSON(list)
+}
@@ -0,0 +1,251 @@
+package tags
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/url"
+)
+
+// Usage — тег и число транзакций с ним.
+type Usage struct {
+	Tag   string `json:"tag" bson:"tag"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// tagParam возвращает тег из пути запроса в нормализованном виде; пустая строка — тег некорректен.
+// Fiber не декодирует параметры пути, а теги обычно кириллические.
+func tagParam(c *fiber.Ctx) string {
+	value, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return ""
+	}
+	list, err := Normalize([]string{value})
+	if err != nil || len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
+
+// GetTags godoc
+// @Summary Получить теги пользователя
+// @Description Все теги транзакций с числом транзакций, от часто используемых к редким.
+// @Tags tags
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} tags.Usage
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags [get]
+func GetTags(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "tags": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "tag": "$_id", "count": 1}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "tag", Value: 1}}}},
+	}
+	cursor, err := database.TransactionsCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		log.Printf("Ошибка агрегации тегов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить теги"})
+	}
+
+	list := []Usage{}
+	if err := cursor.All(context.Background(), &list); err != nil {
+		log.Printf("Ошибка декодирования тегов: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования тегов"})
+	}
+
+	return c.JSON(list)
+}
+
+// RenameTag godoc
+// @Summary Переименовать тег
+// @Description Тег меняется во всех транзакциях, в том числе в корзине, и правилах категоризации пользователя в одной транзакции MongoDB.
+// @Description Если у транзакции уже есть тег с новым именем, старый тег просто убирается: так два тега объединяются в один.
+// @Tags tags
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Тег"
+// @Param update body map[string]string true "Поле name — новое имя тега"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags/{name} [patch]
+func RenameTag(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	old := tagParam(c)
+	if old == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат тега"})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON: " + err.Error()})
+	}
+	list, err := Normalize([]string{data["name"]})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(list) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'name' обязательно"})
+	}
+	name := list[0]
+	if name == old {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Новое имя тега совпадает с текущим"})
+	}
+
+	// В каждой коллекции сначала убираем старый тег там, где новый уже есть, затем переименовываем оставшиеся
+	// versioned — у документов коллекции есть версия, как у транзакций
+	rename := func(sessCtx mongo.SessionContext, collection *mongo.Collection, field string, versioned bool) (int64, error) {
+		pull := bson.M{"$pull": bson.M{field: old}}
+		set := bson.M{"$set": bson.M{field + ".$": name}}
+		if versioned {
+			database.BumpVersion(pull)
+			database.BumpVersion(set)
+		}
+		merged, err := collection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, field: bson.M{"$all": bson.A{old, name}}},
+			pull)
+		if err != nil {
+			return 0, err
+		}
+		renamed, err := collection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, field: old},
+			set)
+		if err != nil {
+			return 0, err
+		}
+		return merged.ModifiedCount + renamed.ModifiedCount, nil
+	}
+
+	var rules, trashed int64
+	modified, err := database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		tracked, err := history.Track(sessCtx, bson.M{"user_id": userID, "tags": old})
+		if err != nil {
+			return nil, err
+		}
+		modified, err := rename(sessCtx, database.TransactionsCollection, "tags", true)
+		if err != nil {
+			return nil, err
+		}
+		rules, err = rename(sessCtx, database.RulesCollection, "set.tags", false)
+		if err != nil {
+			return nil, err
+		}
+		// Транзакции в корзине переименовываются без версии: при восстановлении она всё равно увеличится
+		trashed, err = rename(sessCtx, database.TrashCollection, "tags", false)
+		if err != nil {
+			return nil, err
+		}
+		return modified, tracked.Record(sessCtx, history.By(userID, history.SourceAPI))
+	})
+	if err != nil {
+		log.Printf("Ошибка переименования тега: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось переименовать тег"})
+	}
+	if modified.(int64) == 0 && rules == 0 && trashed == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Тег не найден"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Тег успешно переименован", "modified": modified, "rules": rules, "trashed": trashed})
+}
+
+// DeleteTag godoc
+// @Summary Удалить тег
+// @Description Тег убирается из всех транзакций пользователя, в том числе в корзине; сами транзакции остаются.
+// @Tags tags
+// @Security ApiKeyAuth
+// @Produce json
+// @Param name path string true "Тег"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Тег устанавливают правила категоризации"
+// @Failure 500 {object} map[string]string
+// @Router /api/tags/{name} [delete]
+func DeleteTag(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	tag := tagParam(c)
+	if tag == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат тега"})
+	}
+
+	// Иначе правила продолжат ставить удалённый тег новым транзакциям
+	rules, err := database.RulesCollection.CountDocuments(context.Background(), bson.M{"user_id": userID, "set.tags": tag})
+	if err != nil {
+		log.Printf("Ошибка подсчёта правил тега: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить тег"})
+	}
+	if rules > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Тег устанавливают правила категоризации. Измените их или переименуйте тег", "rules": rules})
+	}
+
+	var modified, trashed int64
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		tracked, err := history.Track(sessCtx, bson.M{"user_id": userID, "tags": tag})
+		if err != nil {
+			return nil, err
+		}
+		result, err := database.TransactionsCollection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, "tags": tag},
+			database.BumpVersion(bson.M{"$pull": bson.M{"tags": tag}}))
+		if err != nil {
+			return nil, err
+		}
+		modified = result.ModifiedCount
+
+		result, err = database.TrashCollection.UpdateMany(sessCtx,
+			bson.M{"user_id": userID, "tags": tag},
+			bson.M{"$pull": bson.M{"tags": tag}})
+		if err != nil {
+			return nil, err
+		}
+		trashed = result.ModifiedCount
+
+		// Пустой список тегов не храним, как и при сохранении транзакции
+		for _, collection := range []*mongo.Collection{database.TransactionsCollection, database.TrashCollection} {
+			if _, err := collection.UpdateMany(sessCtx,
+				bson.M{"user_id": userID, "tags": bson.M{"$size": 0}},
+				bson.M{"$unset": bson.M{"tags": ""}}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, tracked.Record(sessCtx, history.By(userID, history.SourceAPI))
+	})
+	if err != nil {
+		log.Printf("Ошибка удаления тега: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить тег"})
+	}
+	if modified == 0 && trashed == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Тег не найден"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Тег успешно удалён", "modified": modified, "trashed": trashed})
+}
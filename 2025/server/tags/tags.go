@@ -0,0 +1,62 @@
+package tags
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения тегов транзакции.
+const (
+	MaxTags   = 20 // Тегов у одной транзакции
+	MaxLength = 50 // Символов в одном теге
+)
+
+// Normalize приводит теги к виду для хранения: без пробелов по краям, в нижнем регистре,
+// без пустых и повторов, в исходном порядке. «Отпуск-2026» и «отпуск-2026 » — один тег.
+func Normalize(list []string) ([]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(list))
+	result := make([]string, 0, len(list))
+	for _, tag := range list {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxLength {
+			return nil, errors.New("Тег '" + tag + "' длиннее 50 символов")
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > MaxTags {
+		return nil, errors.New("У транзакции может быть не больше 20 тегов")
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// Merge добавляет к тегам list теги extra, которых в нём ещё нет, не превышая MaxTags.
+// Оба списка уже нормализованы.
+func Merge(list []string, extra []string) []string {
+	for _, tag := range extra {
+		if len(list) >= MaxTags {
+			break
+		}
+		found := false
+		for _, existing := range list {
+			if existing == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
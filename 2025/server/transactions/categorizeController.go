@@ -0,0 +1,218 @@
+package transactions
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/rules"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+)
+
+// Ограничения применения правил к сохранённым транзакциям.
+const (
+	rulesPreviewLimit = 500 // Изменений в ответе; применяются все
+	rulesWriteBatch   = 500 // Обновлений в одной пакетной записи
+)
+
+// RuleChange — как правила изменят сохранённую транзакцию.
+type RuleChange struct {
+	Transaction models.Transaction   `json:"transaction"`          // Транзакция до изменения
+	Category    string               `json:"category,omitempty"`   // Новая категория
+	Tags        []string             `json:"tags,omitempty"`       // Добавляемые теги
+	AccountID   *primitive.ObjectID  `json:"account_id,omitempty"` // Счёт для транзакции без счёта
+	Rules       []primitive.ObjectID `json:"rules"`                // Подошедшие правила в порядке проверки
+}
+
+// ruleChange сравнивает результат правил с транзакцией. В отличие от новой транзакции,
+// категория сохранённой заменяется категорией правила. nil — изменений нет.
+func ruleChange(engine *rules.Engine, t models.Transaction) *RuleChange {
+	probe := t
+	probe.Currency = t.CurrencyOrDefault()
+	result := engine.Evaluate(probe)
+	if len(result.Rules) == 0 {
+		return nil
+	}
+
+	change := &RuleChange{Transaction: t, Rules: result.Rules}
+	if result.Category != "" && result.Category != t.Category {
+		change.Category = result.Category
+	}
+	if added := tags.Merge(append([]string{}, t.Tags...), result.Tags); len(added) > len(t.Tags) {
+		change.Tags = added[len(t.Tags):]
+	}
+	change.AccountID = result.AccountID
+	if change.Category == "" && len(change.Tags) == 0 && change.AccountID == nil {
+		return nil
+	}
+	return change
+}
+
+// update возвращает операцию пакетной записи для изменения. Условие на версию не даёт затереть транзакцию,
+// изменённую после того, как правила её проверили: такая транзакция пропускается.
+func (change RuleChange) update() mongo.WriteModel {
+	set := bson.M{}
+	if change.Category != "" {
+		set["category"] = change.Category
+	}
+	if change.AccountID != nil {
+		set["account_id"] = *change.AccountID
+		set["currency"] = change.Transaction.CurrencyOrDefault()
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(change.Tags) > 0 {
+		update["$addToSet"] = bson.M{"tags": bson.M{"$each": change.Tags}}
+	}
+	return mongo.NewUpdateOneModel().
+		SetFilter(database.VersionFilter(bson.M{"_id": change.Transaction.ID, "user_id": change.Transaction.UserID}, change.Transaction.Version)).
+		SetUpdate(database.BumpVersion(update))
+}
+
+// ApplyRules godoc
+// @Summary Применить правила к сохранённым транзакциям
+// @Description Без confirm=true только показывает, какие транзакции изменятся. Категория транзакции заменяется категорией первого подошедшего правила,
+// @Description теги правил добавляются, счёт правила устанавливается только транзакциям без счёта в валюте этого счёта. Переводы не меняются.
+// @Tags rules
+// @Security ApiKeyAuth
+// @Produce json
+// @Param rule query string false "ID правила; по умолчанию все включённые правила"
+// @Param confirm query bool false "Применить изменения"
+// @Param from query string false "Начало периода (YYYY-MM-DD или ISO 8601)"
+// @Param to query string false "Конец периода включительно (YYYY-MM-DD или ISO 8601)"
+// @Param type query string false "Тип: income или expense"
+// @Param category query string false "Список категорий через запятую"
+// @Param tag query string false "Список тегов через запятую: операции хотя бы с одним из них"
+// @Param account query string false "Список ID счетов через запятую"
+// @Param q query string false "Поиск по описанию и заметке"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/rules/apply [post]
+func ApplyRules(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	if c.Query("type") == "transfer" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Правила не применяются к переводам"})
+	}
+	filter, err := ParseFilter(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter["kind"] = bson.M{"$ne": models.KindTransfer}
+	confirm := c.QueryBool("confirm")
+
+	ctx := context.Background()
+	var engine *rules.Engine
+	if ruleID := c.Query("rule"); ruleID != "" {
+		objectID, err := primitive.ObjectIDFromHex(ruleID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат параметра 'rule'"})
+		}
+		engine, err = rules.LoadRule(ctx, userID, objectID)
+		if err == nil && engine.Empty() {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Правило не найдено"})
+		}
+	} else {
+		engine, err = rules.Load(ctx, userID)
+	}
+	if err != nil {
+		log.Printf("Ошибка загрузки правил: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось загрузить правила"})
+	}
+
+	cursor, err := database.TransactionsCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакций для правил: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось применить правила"})
+	}
+	defer cursor.Close(ctx)
+
+	changes := []RuleChange{}
+	var writes []mongo.WriteModel
+	var ids []primitive.ObjectID
+	changed, skipped := 0, 0
+	// Пакет обновлений и их ревизии истории записываются одной транзакцией MongoDB.
+	// Ревизии строятся по состоянию транзакций в ней, а не по прочитанному курсором
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		applied, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			tracked, err := history.Track(sessCtx, bson.M{"_id": bson.M{"$in": ids}})
+			if err != nil {
+				return nil, err
+			}
+			result, err := database.TransactionsCollection.BulkWrite(sessCtx, writes, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return nil, err
+			}
+			return int(result.MatchedCount), tracked.Record(sessCtx, history.By(userID, history.SourceRules))
+		})
+		if err == nil {
+			skipped += len(writes) - applied.(int)
+		}
+		writes = writes[:0]
+		ids = ids[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var t models.Transaction
+		if err := cursor.Decode(&t); err != nil {
+			log.Printf("Ошибка декодирования транзакции: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования транзакции"})
+		}
+		change := ruleChange(engine, t)
+		if change == nil {
+			continue
+		}
+		changed++
+		if len(changes) < rulesPreviewLimit {
+			changes = append(changes, *change)
+		}
+		if confirm {
+			writes = append(writes, change.update())
+			ids = append(ids, change.Transaction.ID)
+			if len(writes) >= rulesWriteBatch {
+				if err := flush(); err != nil {
+					log.Printf("Ошибка применения правил: %v\n", err)
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось применить правила"})
+				}
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Ошибка курсора: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка при итерации курсора"})
+	}
+	if confirm {
+		if err := flush(); err != nil {
+			log.Printf("Ошибка применения правил: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось применить правила"})
+		}
+		// После массовой смены категорий подсказки обучаются заново
+		if changed > 0 {
+			if err := suggest.Reset(ctx, userID); err != nil {
+				log.Printf("Ошибка сброса подсказок категорий: %v\n", err)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"applied": confirm, "changed": changed, "skipped": skipped, "changes": changes})
+}
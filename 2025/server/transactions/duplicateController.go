@@ -0,0 +1,267 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/attachments"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/trash"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"sort"
+)
+
+// DuplicateGroup — исходная транзакция и транзакции, помеченные как её вероятные дубли.
+type DuplicateGroup struct {
+	Original   models.Transaction   `json:"original"`
+	Duplicates []models.Transaction `json:"duplicates"`
+}
+
+// DuplicateRequest — тело запроса слияния или отклонения дублей. Пустой список — все дубли группы.
+type DuplicateRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// duplicateFilter разбирает ID группы из пути и необязательный список дублей из тела
+// и возвращает фильтр дублей группы. Ошибки — некорректный запрос.
+func duplicateFilter(c *fiber.Ctx, userID primitive.ObjectID) (primitive.ObjectID, bson.M, error) {
+	originalID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return primitive.NilObjectID, nil, errors.New("Неверный формат ID")
+	}
+	filter := bson.M{"user_id": userID, "possible_duplicate_of": originalID}
+
+	request := new(DuplicateRequest)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			return primitive.NilObjectID, nil, errors.New("Некорректный формат JSON")
+		}
+	}
+	if len(request.IDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(request.IDs))
+		for _, value := range request.IDs {
+			id, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				return primitive.NilObjectID, nil, errors.New("Неверный формат ID в 'ids'")
+			}
+			ids = append(ids, id)
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	return originalID, filter, nil
+}
+
+// GetDuplicates godoc
+// @Summary Получить группы вероятных дублей
+// @Description Группа — исходная транзакция и транзакции, помеченные при создании или импорте как её вероятные дубли
+// @Description (тот же счёт, тип и валюта, близкая сумма, дата в пределах трёх дней, похожее описание). Новые группы — первыми.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} DuplicateGroup
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/duplicates [get]
+func GetDuplicates(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	ctx := context.Background()
+	cursor, err := database.TransactionsCollection.Find(ctx,
+		bson.M{"user_id": userID, "possible_duplicate_of": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		log.Printf("Ошибка при поиске дублей: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить дубли"})
+	}
+	var flagged []models.Transaction
+	if err := cursor.All(ctx, &flagged); err != nil {
+		log.Printf("Ошибка декодирования дублей: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить дубли"})
+	}
+
+	groups := map[primitive.ObjectID]*DuplicateGroup{}
+	var originalIDs []primitive.ObjectID
+	for _, t := range flagged {
+		id := *t.PossibleDuplicateOf
+		if groups[id] == nil {
+			groups[id] = &DuplicateGroup{}
+			originalIDs = append(originalIDs, id)
+		}
+		groups[id].Duplicates = append(groups[id].Duplicates, t)
+	}
+
+	result := make([]DuplicateGroup, 0, len(groups))
+	if len(originalIDs) > 0 {
+		cursor, err := database.TransactionsCollection.Find(ctx, bson.M{"user_id": userID, "_id": bson.M{"$in": originalIDs}})
+		if err != nil {
+			log.Printf("Ошибка при поиске исходных транзакций: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить дубли"})
+		}
+		var originals []models.Transaction
+		if err := cursor.All(ctx, &originals); err != nil {
+			log.Printf("Ошибка декодирования исходных транзакций: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить дубли"})
+		}
+		// Группы без исходной транзакции не показываются: ссылки на удалённые транзакции снимаются при удалении
+		for _, original := range originals {
+			group := groups[original.ID]
+			group.Original = original
+			result = append(result, *group)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Original.Date > result[j].Original.Date
+	})
+
+	return c.JSON(result)
+}
+
+// MergeDuplicates godoc
+// @Summary Слить дубли с исходной транзакцией
+// @Description Переносит дубли группы в корзину и оставляет исходную транзакцию. Если у исходной нет банковского идентификатора, она получает
+// @Description external_id дубля, чтобы повторный импорт той же выписки её не дублировал.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID исходной транзакции"
+// @Param request body DuplicateRequest false "Дубли для слияния; по умолчанию все"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/duplicates/{id}/merge [post]
+func MergeDuplicates(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	originalID, filter, err := duplicateFilter(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var removed []models.Transaction
+	merged, err := database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var original models.Transaction
+		err := database.TransactionsCollection.FindOne(sessCtx, bson.M{"_id": originalID, "user_id": userID}).Decode(&original)
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Транзакция не найдена")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cursor, err := database.TransactionsCollection.Find(sessCtx, filter)
+		if err != nil {
+			return nil, err
+		}
+		var duplicates []models.Transaction
+		if err := cursor.All(sessCtx, &duplicates); err != nil {
+			return nil, err
+		}
+		if len(duplicates) == 0 {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Дубли не найдены")
+		}
+
+		ids := make([]primitive.ObjectID, len(duplicates))
+		externalID := ""
+		for i, d := range duplicates {
+			ids[i] = d.ID
+			if externalID == "" {
+				externalID = d.ExternalID
+			}
+		}
+		origin := history.By(userID, history.SourceAPI)
+		// Дубли уходят в корзину: ошибочное слияние можно отменить, восстановив дубль
+		if _, err := trash.Move(sessCtx, userID, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return nil, err
+		}
+		// Чеки и документы дублей остаются у исходной транзакции
+		if err := attachments.Move(sessCtx, userID, ids, originalID); err != nil {
+			return nil, err
+		}
+		// Идентификатор переносится после удаления дубля: он уникален в рамках счёта
+		if original.ExternalID == "" && externalID != "" {
+			if _, err := history.Update(sessCtx, origin, bson.M{"_id": originalID, "user_id": userID}, bson.M{"$set": bson.M{"external_id": externalID}}); err != nil {
+				return nil, err
+			}
+		}
+		removed = duplicates
+		return len(ids), nil
+	})
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось слить дубли")
+	}
+
+	if err := suggest.Forget(context.Background(), userID, removed...); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Дубли перенесены в корзину", "merged": merged})
+}
+
+// DismissDuplicates godoc
+// @Summary Отклонить дубли
+// @Description Снимает пометку possible_duplicate_of: транзакции остаются и больше не показываются в группе.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID исходной транзакции"
+// @Param request body DuplicateRequest false "Отклоняемые дубли; по умолчанию все"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/duplicates/{id}/dismiss [post]
+func DismissDuplicates(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	_, filter, err := duplicateFilter(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var dismissed int64
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		tracked, err := history.Track(sessCtx, filter)
+		if err != nil {
+			return nil, err
+		}
+		result, err := database.TransactionsCollection.UpdateMany(sessCtx, filter, database.BumpVersion(bson.M{"$unset": bson.M{"possible_duplicate_of": ""}}))
+		if err != nil {
+			return nil, err
+		}
+		dismissed = result.ModifiedCount
+		return nil, tracked.Record(sessCtx, history.By(userID, history.SourceAPI))
+	})
+	if err != nil {
+		log.Printf("Ошибка отклонения дублей: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось отклонить дубли"})
+	}
+	if dismissed == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Дубли не найдены"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Дубли отклонены", "dismissed": dismissed})
+}
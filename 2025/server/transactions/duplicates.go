@@ -0,0 +1,187 @@
+package transactions
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Пороги поиска вероятных дублей.
+const (
+	DuplicateWindow     = 3 * 24 * time.Hour // Даты дублей расходятся не больше чем на три дня
+	duplicateSimilarity = 0.5                // Доля общих слов в описаниях, начиная с которой они считаются похожими
+)
+
+// duplicateTolerance — допустимое относительное расхождение сумм дублей: банк может округлить
+// сумму или списать её с комиссией.
+var duplicateTolerance = money.New(1, -2)
+
+// DuplicateFinder ищет вероятные дубли новых транзакций среди уже сохранённых.
+// Кандидаты загружаются один раз на весь период, поэтому один поиск подходит и для целой выписки.
+type DuplicateFinder struct {
+	candidates []models.Transaction
+}
+
+// NewDuplicateFinder загружает обычные транзакции пользователя на счёте accountID (nil — без счёта)
+// с датами от from до to, расширенными на DuplicateWindow.
+func NewDuplicateFinder(ctx context.Context, userID primitive.ObjectID, accountID *primitive.ObjectID, from time.Time, to time.Time) (*DuplicateFinder, error) {
+	// account_id: null совпадает и с операциями без счёта
+	filter := bson.M{
+		"user_id":    userID,
+		"account_id": accountID,
+		"kind":       bson.M{"$ne": models.KindTransfer},
+		"date": bson.M{
+			"$gte": primitive.NewDateTimeFromTime(from.Add(-DuplicateWindow)),
+			"$lte": primitive.NewDateTimeFromTime(to.Add(DuplicateWindow)),
+		},
+	}
+	projection := bson.M{"date": 1, "description": 1, "amount": 1, "currency": 1, "type": 1, "external_id": 1, "possible_duplicate_of": 1}
+	cursor, err := database.TransactionsCollection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	f := &DuplicateFinder{}
+	if err := cursor.All(ctx, &f.candidates); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// FindDuplicate ищет вероятный дубль одной новой транзакции.
+func FindDuplicate(ctx context.Context, t models.Transaction) (*primitive.ObjectID, error) {
+	date := t.Date.Time()
+	f, err := NewDuplicateFinder(ctx, t.UserID, t.AccountID, date, date)
+	if err != nil {
+		return nil, err
+	}
+	return f.Find(t), nil
+}
+
+// Find возвращает транзакцию, дублем которой вероятно является t, или nil. Дубль — операция того же
+// типа и валюты на том же счёте, с суммой в пределах duplicateTolerance, датой в пределах DuplicateWindow
+// и похожим описанием. Из нескольких подходящих выбирается самая похожая, затем ближайшая по дате.
+// Если найденная транзакция сама помечена как дубль, возвращается её исходная: группа остаётся одноуровневой.
+// Две операции с разными банковскими идентификаторами дублями не считаются: повтор одной
+// операции банка отсекает уникальный external_id.
+func (f *DuplicateFinder) Find(t models.Transaction) *primitive.ObjectID {
+	var best *models.Transaction
+	var bestScore float64
+	var bestGap time.Duration
+
+	date := t.Date.Time()
+	tolerance := t.Amount.Mul(duplicateTolerance)
+	for i := range f.candidates {
+		c := &f.candidates[i]
+		if c.ID == t.ID || c.Type != t.Type || c.CurrencyOrDefault() != t.CurrencyOrDefault() {
+			continue
+		}
+		if c.ExternalID != "" && t.ExternalID != "" {
+			continue
+		}
+		if c.Amount.Sub(t.Amount).Abs().Cmp(tolerance) > 0 {
+			continue
+		}
+		gap := c.Date.Time().Sub(date)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap > DuplicateWindow {
+			continue
+		}
+		score := similarity(c.Description, t.Description)
+		if score < duplicateSimilarity {
+			continue
+		}
+		if best == nil || score > bestScore || (score == bestScore && gap < bestGap) {
+			best, bestScore, bestGap = c, score, gap
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	if best.PossibleDuplicateOf != nil {
+		return best.PossibleDuplicateOf
+	}
+	id := best.ID
+	return &id
+}
+
+// words разбивает описание на слова в нижнем регистре. Числа пропускаются: номера карт,
+// чеков и терминалов у одной и той же операции в разных источниках обычно различаются.
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ReplaceAll(strings.ToLower(text), "ё", "е"), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	result := fields[:0]
+	for _, word := range fields {
+		if strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// sameWord сравнивает слова с точностью до окончания: «продукт» и «продукты» совпадают.
+func sameWord(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	if len([]rune(a)) < 4 || len([]rune(b)) < 4 {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// similarity возвращает долю слов более короткого описания, которые есть в другом (от 0 до 1).
+// «Пятёрочка» и «ПЯТЁРОЧКА Москва 1234» похожи полностью.
+func similarity(a string, b string) float64 {
+	left, right := words(a), words(b)
+	if len(left) == 0 || len(right) == 0 {
+		if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+			return 1
+		}
+		return 0
+	}
+	if len(left) > len(right) {
+		left, right = right, left
+	}
+	common := 0
+	for _, word := range left {
+		for _, other := range right {
+			if sameWord(word, other) {
+				common++
+				break
+			}
+		}
+	}
+	return float64(common) / float64(len(left))
+}
+
+// ClearDuplicateRefs снимает пометку дубля с транзакций, ссылающихся на удаляемые транзакции ids, и записывает изменения в историю.
+// Вызывается внутри транзакции MongoDB.
+func ClearDuplicateRefs(ctx context.Context, origin history.Origin, userID primitive.ObjectID, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	filter := bson.M{"user_id": userID, "possible_duplicate_of": bson.M{"$in": ids}}
+	tracked, err := history.Track(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = database.TransactionsCollection.UpdateMany(ctx, filter,
+		database.BumpVersion(bson.M{"$unset": bson.M{"possible_duplicate_of": ""}}),
+	)
+	if err != nil {
+		return err
+	}
+	return tracked.Record(ctx, origin)
+}
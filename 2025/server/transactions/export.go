@@ -0,0 +1,479 @@
+package transactions
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exportFlushRows — через сколько строк CSV и JSON отдаются клиенту, не дожидаясь конца выгрузки.
+const exportFlushRows = 500
+
+// exportContentTypes — поддерживаемые форматы выгрузки и их MIME-типы.
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"json": "application/json",
+}
+
+// exportLocale — заголовки и форматы выгрузки на одном языке.
+type exportLocale struct {
+	Columns        []string // Колонки листа операций
+	SummaryColumns []string // Колонки листа итогов
+	Sheet          string   // Название листа операций
+	SummarySheet   string   // Название листа итогов
+	Income         string
+	Expense        string
+	Transfer       string
+	DateLayout     string // Формат даты в CSV
+	Comma          rune   // Разделитель колонок CSV
+	DecimalComma   bool   // Десятичная запятая в суммах CSV
+}
+
+// exportLocales — языки выгрузки. Русский CSV открывается в Excel с русской локалью без настройки импорта.
+var exportLocales = map[string]exportLocale{
+	"ru": {
+		Columns:        []string{"Дата", "Тип", "Категория", "Описание", "Сумма", "Валюта", "Счёт", "Теги", "Заметка"},
+		SummaryColumns: []string{"Категория", "Тип", "Валюта", "Сумма", "Операций"},
+		Sheet:          "Операции",
+		SummarySheet:   "Итоги по категориям",
+		Income:         "Доход",
+		Expense:        "Расход",
+		Transfer:       "Перевод",
+		DateLayout:     "02.01.2006 15:04",
+		Comma:          ';',
+		DecimalComma:   true,
+	},
+	"en": {
+		Columns:        []string{"Date", "Type", "Category", "Description", "Amount", "Currency", "Account", "Tags", "Notes"},
+		SummaryColumns: []string{"Category", "Type", "Currency", "Total", "Count"},
+		Sheet:          "Transactions",
+		SummarySheet:   "Category totals",
+		Income:         "Income",
+		Expense:        "Expense",
+		Transfer:       "Transfer",
+		DateLayout:     "2006-01-02 15:04",
+		Comma:          ',',
+	},
+}
+
+// exporter выгружает транзакции из курсора в одном из форматов.
+type exporter struct {
+	locale   exportLocale
+	loc      *time.Location
+	accounts map[primitive.ObjectID]string // Названия счетов пользователя
+}
+
+// summaryKey — строка листа итогов: категория, тип и валюта.
+type summaryKey struct {
+	Category string
+	Income   bool
+	Currency string
+}
+
+// summaryTotal — сумма и число операций строки итогов.
+type summaryTotal struct {
+	Total money.Amount
+	Count int
+}
+
+// typeLabel возвращает подпись типа операции.
+func (e exporter) typeLabel(t models.Transaction) string {
+	switch {
+	case t.Kind == models.KindTransfer:
+		return e.locale.Transfer
+	case t.Type:
+		return e.locale.Income
+	}
+	return e.locale.Expense
+}
+
+// signed возвращает сумму со знаком: расходы и списания — отрицательные.
+func signed(t models.Transaction) money.Amount {
+	if t.Type {
+		return t.Amount
+	}
+	return t.Amount.Neg()
+}
+
+// accountName возвращает название счёта операции или пустую строку.
+func (e exporter) accountName(t models.Transaction) string {
+	if t.AccountID == nil {
+		return ""
+	}
+	return e.accounts[*t.AccountID]
+}
+
+// formulaPrefixes — символы, с которых Excel и другие табличные редакторы начинают формулу.
+const formulaPrefixes = "=+-@\t\r"
+
+// cellText экранирует текст ячейки CSV апострофом, если он начинается как формула:
+// описание из выписки или заметка не должны выполняться при открытии файла.
+func cellText(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// writeCSV выгружает транзакции в CSV. Метка BOM нужна, чтобы Excel распознал UTF-8.
+func (e exporter) writeCSV(ctx context.Context, w *bufio.Writer, cursor *mongo.Cursor) error {
+	if _, err := w.WriteString("\ufeff"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = e.locale.Comma
+	if err := writer.Write(e.locale.Columns); err != nil {
+		return err
+	}
+
+	for rows := 1; cursor.Next(ctx); rows++ {
+		var t models.Transaction
+		if err := cursor.Decode(&t); err != nil {
+			return err
+		}
+		currency := t.CurrencyOrDefault()
+		amount := signed(t).StringFixed(currency)
+		if e.locale.DecimalComma {
+			amount = strings.Replace(amount, ".", ",", 1)
+		}
+		record := []string{
+			t.Date.Time().In(e.loc).Format(e.locale.DateLayout),
+			e.typeLabel(t),
+			cellText(t.Category),
+			cellText(t.Description),
+			amount,
+			currency,
+			cellText(e.accountName(t)),
+			cellText(strings.Join(t.Tags, ", ")),
+			cellText(t.Notes),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		if rows%exportFlushRows == 0 {
+			writer.Flush()
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return cursor.Err()
+}
+
+// writeJSON выгружает транзакции массивом JSON в формате API.
+func (e exporter) writeJSON(ctx context.Context, w *bufio.Writer, cursor *mongo.Cursor) error {
+	if err := w.WriteByte('['); err != nil {
+		return err
+	}
+	for rows := 0; cursor.Next(ctx); rows++ {
+		var t models.Transaction
+		if err := cursor.Decode(&t); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			if err := w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		if (rows+1)%exportFlushRows == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return w.WriteByte(']')
+}
+
+// writeXLSX выгружает транзакции в книгу Excel: лист операций и лист итогов по категориям
+// (без переводов между счетами). Строки пишутся потоково: excelize держит в памяти
+// только текущую часть листа, остальное — во временном файле.
+func (e exporter) writeXLSX(ctx context.Context, w io.Writer, cursor *mongo.Cursor) error {
+	book := excelize.NewFile()
+	defer book.Close()
+
+	if err := book.SetSheetName("Sheet1", e.locale.Sheet); err != nil {
+		return err
+	}
+	headerStyle, err := book.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	dateStyle, err := book.NewStyle(&excelize.Style{NumFmt: 22}) // m/d/yy h:mm, показывается в локали Excel
+	if err != nil {
+		return err
+	}
+	amountStyle, err := book.NewStyle(&excelize.Style{NumFmt: 4}) // #,##0.00
+	if err != nil {
+		return err
+	}
+
+	sheet, err := book.NewStreamWriter(e.locale.Sheet)
+	if err != nil {
+		return err
+	}
+	if err := sheet.SetRow("A1", headerCells(e.locale.Columns, headerStyle)); err != nil {
+		return err
+	}
+
+	totals := map[summaryKey]*summaryTotal{}
+	row := 2
+	for ; cursor.Next(ctx); row++ {
+		var t models.Transaction
+		if err := cursor.Decode(&t); err != nil {
+			return err
+		}
+		currency := t.CurrencyOrDefault()
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		err := sheet.SetRow(cell, []interface{}{
+			excelize.Cell{StyleID: dateStyle, Value: wallClock(t.Date.Time().In(e.loc))},
+			e.typeLabel(t),
+			t.Category,
+			t.Description,
+			excelize.Cell{StyleID: amountStyle, Value: signed(t).Float64()},
+			currency,
+			e.accountName(t),
+			strings.Join(t.Tags, ", "),
+			t.Notes,
+		})
+		if err != nil {
+			return err
+		}
+
+		if t.Kind != models.KindTransfer {
+			// Части разбивки идут в итоги своих категорий, как в статистике
+			parts := t.Splits
+			if len(parts) == 0 {
+				parts = []models.Split{{Category: t.Category, Amount: t.Amount}}
+			}
+			for _, part := range parts {
+				key := summaryKey{Category: part.Category, Income: t.Type, Currency: currency}
+				if totals[key] == nil {
+					totals[key] = &summaryTotal{}
+				}
+				totals[key].Total = totals[key].Total.Add(part.Amount)
+				totals[key].Count++
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := sheet.Flush(); err != nil {
+		return err
+	}
+
+	if err := e.writeSummary(book, totals, headerStyle, amountStyle); err != nil {
+		return err
+	}
+	return book.Write(w)
+}
+
+// writeSummary добавляет лист итогов: сначала доходы, затем расходы, внутри — по убыванию суммы.
+func (e exporter) writeSummary(book *excelize.File, totals map[summaryKey]*summaryTotal, headerStyle, amountStyle int) error {
+	keys := make([]summaryKey, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Income != b.Income {
+			return a.Income
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		if cmp := totals[a].Total.Cmp(totals[b].Total); cmp != 0 {
+			return cmp > 0
+		}
+		return a.Category < b.Category
+	})
+
+	if _, err := book.NewSheet(e.locale.SummarySheet); err != nil {
+		return err
+	}
+	sheet, err := book.NewStreamWriter(e.locale.SummarySheet)
+	if err != nil {
+		return err
+	}
+	if err := sheet.SetRow("A1", headerCells(e.locale.SummaryColumns, headerStyle)); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		label := e.locale.Expense
+		if key.Income {
+			label = e.locale.Income
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		err := sheet.SetRow(cell, []interface{}{
+			key.Category,
+			label,
+			key.Currency,
+			excelize.Cell{StyleID: amountStyle, Value: totals[key].Total.Float64()},
+			totals[key].Count,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return sheet.Flush()
+}
+
+// headerCells оформляет строку заголовка.
+func headerCells(columns []string, style int) []interface{} {
+	cells := make([]interface{}, len(columns))
+	for i, column := range columns {
+		cells[i] = excelize.Cell{StyleID: style, Value: column}
+	}
+	return cells
+}
+
+// wallClock переносит время на часах часового пояса в UTC: Excel не хранит часовой пояс
+// и показывает дату так, как она записана.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// accountNames загружает названия счетов пользователя для колонки «Счёт».
+func accountNames(ctx context.Context, userID primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cursor, err := database.AccountsCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Account
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	names := make(map[primitive.ObjectID]string, len(list))
+	for _, account := range list {
+		names[account.ID] = account.Name
+	}
+	return names, nil
+}
+
+// ExportTransactions godoc
+// @Summary Выгрузить транзакции в CSV, XLSX или JSON
+// @Description Принимает те же фильтры, что и список транзакций; операции выгружаются по дате от старых к новым. Строки читаются из курсора MongoDB
+// @Description и отдаются потоком. Суммы со знаком: расходы и списания отрицательные. XLSX содержит второй лист с итогами по категориям без переводов.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "Формат: csv, xlsx или json (по умолчанию csv)"
+// @Param lang query string false "Язык заголовков: ru или en (по умолчанию из Accept-Language, иначе ru)"
+// @Param from query string false "Начало периода (YYYY-MM-DD или ISO 8601)"
+// @Param to query string false "Конец периода включительно (YYYY-MM-DD или ISO 8601)"
+// @Param tz query string false "Часовой пояс IANA для фильтра и дат в файле (по умолчанию UTC)"
+// @Param type query string false "Тип: income, expense или transfer"
+// @Param category query string false "Список категорий через запятую (включая подкатегории)"
+// @Param tag query string false "Список тегов через запятую: операции хотя бы с одним из них"
+// @Param account query string false "Список ID счетов через запятую"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/export [get]
+func ExportTransactions(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	format := c.Query("format", "csv")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'format' должен быть csv, xlsx или json"})
+	}
+	lang := c.Query("lang")
+	if lang == "" {
+		lang = c.AcceptsLanguages("ru", "en")
+	}
+	if lang == "" {
+		lang = "ru"
+	}
+	locale, ok := exportLocales[lang]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'lang' должен быть ru или en"})
+	}
+
+	loc, err := ParseLocation(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter, err := ParseFilter(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	accounts, err := accountNames(context.Background(), userID)
+	if err != nil {
+		log.Printf("Ошибка загрузки счетов для выгрузки: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось выгрузить транзакции"})
+	}
+	sortOrder := bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := database.TransactionsCollection.Find(context.Background(), filter, options.Find().SetSort(sortOrder))
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакций для выгрузки: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось выгрузить транзакции"})
+	}
+
+	e := exporter{locale: locale, loc: loc, accounts: accounts}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Attachment(fmt.Sprintf("transactions-%s.%s", time.Now().In(loc).Format("20060102"), format))
+
+	// Тело пишется после выхода из обработчика, поэтому c внутри не используется.
+	// Статус уже отправлен: ошибку посреди выгрузки можно только записать в лог
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx := context.Background()
+		defer cursor.Close(ctx)
+
+		var err error
+		switch format {
+		case "csv":
+			err = e.writeCSV(ctx, w, cursor)
+		case "json":
+			err = e.writeJSON(ctx, w, cursor)
+		case "xlsx":
+			err = e.writeXLSX(ctx, w, cursor)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Printf("Ошибка выгрузки транзакций: %v\n", err)
+		}
+	})
+	return nil
+}
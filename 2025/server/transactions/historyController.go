@@ -0,0 +1,161 @@
+package transactions
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+)
+
+// GetTransactionHistory godoc
+// @Summary Получить историю изменений транзакции
+// @Description Ревизии от новых к старым: действие (create, update, delete, restore, revert), источник (api, import, recurring, rules),
+// @Description автор и время. В before и after — только изменённые поля. История доступна и для транзакции в корзине.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Success 200 {array} history.Entry
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/{id}/history [get]
+func GetTransactionHistory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	revisions, err := history.Revisions(context.Background(), userID, objectID)
+	if err != nil {
+		log.Printf("Ошибка при поиске истории транзакции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить историю транзакции"})
+	}
+
+	// У транзакций, созданных до появления истории, ревизий нет
+	if len(revisions) == 0 {
+		filter := bson.M{"_id": objectID, "user_id": userID}
+		count, err := database.TransactionsCollection.CountDocuments(context.Background(), filter)
+		if err == nil && count == 0 {
+			count, err = database.TrashCollection.CountDocuments(context.Background(), filter)
+		}
+		if err != nil {
+			log.Printf("Ошибка при поиске транзакции: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить историю транзакции"})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена"})
+		}
+	}
+
+	entries, err := history.Entries(revisions)
+	if err != nil {
+		log.Printf("Ошибка декодирования истории транзакции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования истории транзакции"})
+	}
+	return c.JSON(entries)
+}
+
+// RevertTransaction godoc
+// @Summary Вернуть транзакцию к ревизии
+// @Description Восстанавливает поля транзакции такими, какими они были сразу после ревизии, и записывает ревизию revert.
+// @Description Удалённую транзакцию сначала нужно восстановить из корзины. Переводы к ревизии не возвращаются.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Param revision path string true "ID ревизии"
+// @Success 200 {object} models.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Такая транзакция уже создана заново"
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/{id}/history/{revision}/revert [post]
+func RevertTransaction(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+	revisionID, err := primitive.ObjectIDFromHex(c.Params("revision"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID ревизии"})
+	}
+
+	var current, reverted models.Transaction
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		current = models.Transaction{}
+		err := database.TransactionsCollection.FindOne(sessCtx, bson.M{"_id": objectID, "user_id": userID}).Decode(&current)
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Транзакция не найдена. Удалённую транзакцию сначала восстановите из корзины")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if current.Kind == models.KindTransfer {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Перевод нельзя вернуть к ревизии")
+		}
+
+		var target models.Revision
+		err = database.HistoryCollection.FindOne(sessCtx, bson.M{"_id": revisionID, "user_id": userID, "transaction_id": objectID}).Decode(&target)
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Ревизия не найдена")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := history.StateAt(sessCtx, current, target)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "После этой ревизии транзакция была удалена: вернуть к ней нельзя")
+		}
+		if err := Validate(sessCtx, state); err != nil {
+			return nil, err
+		}
+
+		if err := history.Revert(sessCtx, history.By(userID, history.SourceAPI), current, state, target.ID); err != nil {
+			return nil, err
+		}
+		reverted = *state
+		return nil, nil
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Такая транзакция уже создана заново (повтор, операция выписки или чек)"})
+	}
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось вернуть транзакцию к ревизии")
+	}
+
+	// Модель подсказок забывает текущие категорию и описание и учится на восстановленных
+	if current.Category != reverted.Category || current.Description != reverted.Description {
+		if err := suggest.Forget(context.Background(), userID, current); err != nil {
+			log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+		} else if err := suggest.Learn(context.Background(), userID, reverted); err != nil {
+			log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+		}
+	}
+
+	c.Set(fiber.HeaderETag, ETag(reverted))
+	return c.JSON(reverted)
+}
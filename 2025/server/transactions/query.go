@@ -0,0 +1,325 @@
+package transactions
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50  // Размер страницы по умолчанию
+	maxPageLimit     = 500 // Максимальный размер страницы
+)
+
+// sortFields — поля, по которым разрешена сортировка списка транзакций.
+var sortFields = map[string]bool{
+	"date":   true,
+	"amount": true,
+}
+
+// ListQuery — разобранные параметры запроса списка транзакций.
+type ListQuery struct {
+	Filter    bson.M // Фильтр без учёта курсора
+	SortField string // Поле сортировки: date или amount
+	SortDesc  bool   // Направление сортировки
+	Limit     int64  // Размер страницы
+	Cursor    *pageCursor
+}
+
+// pageCursor — содержимое непрозрачного курсора пагинации.
+// Хранит значение поля сортировки и _id последнего документа страницы.
+type pageCursor struct {
+	Sort   string             `json:"s"`
+	Date   int64              `json:"d,omitempty"`
+	Amount string             `json:"a,omitempty"`
+	ID     primitive.ObjectID `json:"id"`
+}
+
+// ParseLocation возвращает часовой пояс из параметра tz (имя IANA, например Europe/Moscow).
+// Без параметра используется UTC.
+func ParseLocation(c *fiber.Ctx) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("Неизвестный часовой пояс в параметре 'tz'")
+	}
+	return loc, nil
+}
+
+// ParseDate принимает дату в формате RFC3339 или YYYY-MM-DD.
+// Дата без времени трактуется как начало дня в часовом поясе loc.
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// splitList разбирает список значений, переданных через запятую.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseCategories возвращает категории из параметра category вместе с их подкатегориями; nil — фильтра нет.
+// Если дерево категорий не загрузилось, фильтр работает без подкатегорий.
+func ParseCategories(c *fiber.Ctx, userID primitive.ObjectID) []string {
+	names := splitList(c.Query("category"))
+	if len(names) == 0 {
+		return nil
+	}
+	// Родительская категория включает все свои подкатегории
+	tree, err := categories.LoadTree(context.Background(), userID)
+	if err != nil {
+		log.Printf("Ошибка загрузки дерева категорий, фильтруем без подкатегорий: %v\n", err)
+		return names
+	}
+	return tree.Descendants(names)
+}
+
+// ParseFilter строит фильтр MongoDB по параметрам запроса поверх bson.M{"user_id": ...}.
+// Поддерживаются: from, to, tz, type, category, tag, account, min_amount, max_amount, q.
+// Фильтр по категории включает её подкатегории и части разбивки, по тегам — операции хотя бы с одним из тегов.
+func ParseFilter(c *fiber.Ctx, userID primitive.ObjectID) (bson.M, error) {
+	filter := bson.M{"user_id": userID}
+
+	loc, err := ParseLocation(c)
+	if err != nil {
+		return nil, err
+	}
+
+	dateRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		t, err := ParseDate(from, loc)
+		if err != nil {
+			return nil, errors.New("Неверный формат параметра 'from'. Используйте YYYY-MM-DD или ISO 8601")
+		}
+		dateRange["$gte"] = primitive.NewDateTimeFromTime(t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := ParseDate(to, loc)
+		if err != nil {
+			return nil, errors.New("Неверный формат параметра 'to'. Используйте YYYY-MM-DD или ISO 8601")
+		}
+		// Дата без времени включает весь день целиком
+		if len(to) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+			dateRange["$lt"] = primitive.NewDateTimeFromTime(t)
+		} else {
+			dateRange["$lte"] = primitive.NewDateTimeFromTime(t)
+		}
+	}
+	if len(dateRange) > 0 {
+		filter["date"] = dateRange
+	}
+
+	switch c.Query("type") {
+	case "":
+	case "income":
+		filter["type"] = true
+		filter["kind"] = bson.M{"$ne": models.KindTransfer}
+	case "expense":
+		// Поле type с omitempty не сохраняется для расходов, поэтому ищем всё, что не доход
+		filter["type"] = bson.M{"$ne": true}
+		filter["kind"] = bson.M{"$ne": models.KindTransfer}
+	case "transfer":
+		filter["kind"] = models.KindTransfer
+	default:
+		return nil, errors.New("Параметр 'type' должен быть 'income', 'expense' или 'transfer'")
+	}
+
+	// Условия через $or складываются в $and, чтобы не затирать друг друга
+	var conditions bson.A
+	if names := ParseCategories(c, userID); len(names) > 0 {
+		// Транзакция с разбивкой подходит, если подходит хотя бы одна её часть
+		in := bson.M{"$in": names}
+		conditions = append(conditions, bson.M{"$or": bson.A{bson.M{"category": in}, bson.M{"splits.category": in}}})
+	}
+
+	if names := splitList(c.Query("tag")); len(names) > 0 {
+		names, err := tags.Normalize(names)
+		if err != nil {
+			return nil, err
+		}
+		filter["tags"] = bson.M{"$in": names}
+	}
+
+	if accountIDs := splitList(c.Query("account")); len(accountIDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(accountIDs))
+		for _, hex := range accountIDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return nil, errors.New("Неверный формат параметра 'account'")
+			}
+			ids = append(ids, id)
+		}
+		filter["account_id"] = bson.M{"$in": ids}
+	}
+
+	amountRange := bson.M{}
+	if minAmount := c.Query("min_amount"); minAmount != "" {
+		v, err := money.Parse(minAmount)
+		if err != nil {
+			return nil, errors.New("Неверный формат параметра 'min_amount'")
+		}
+		amountRange["$gte"] = v
+	}
+	if maxAmount := c.Query("max_amount"); maxAmount != "" {
+		v, err := money.Parse(maxAmount)
+		if err != nil {
+			return nil, errors.New("Неверный формат параметра 'max_amount'")
+		}
+		amountRange["$lte"] = v
+	}
+	if len(amountRange) > 0 {
+		filter["amount"] = amountRange
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		// Экранируем ввод пользователя, чтобы искать подстроку, а не выполнять произвольный regex
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{bson.M{"description": pattern}, bson.M{"notes": pattern}}})
+	}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+
+	return filter, nil
+}
+
+// ParseListQuery разбирает фильтры, сортировку, лимит и курсор списка транзакций.
+func ParseListQuery(c *fiber.Ctx, userID primitive.ObjectID) (*ListQuery, error) {
+	filter, err := ParseFilter(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &ListQuery{Filter: filter, SortField: "date", SortDesc: true, Limit: defaultPageLimit}
+
+	if sortParam := c.Query("sort"); sortParam != "" {
+		query.SortDesc = strings.HasPrefix(sortParam, "-")
+		query.SortField = strings.TrimPrefix(sortParam, "-")
+		if !sortFields[query.SortField] {
+			return nil, errors.New("Параметр 'sort' должен быть одним из: date, -date, amount, -amount")
+		}
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.ParseInt(limitParam, 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("Параметр 'limit' должен быть положительным числом")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		query.Limit = limit
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		cursor, err := decodeCursor(cursorParam)
+		if err != nil || cursor.Sort != query.sortKey() {
+			return nil, errors.New("Неверный курсор пагинации")
+		}
+		query.Cursor = cursor
+	}
+
+	return query, nil
+}
+
+// sortKey возвращает сортировку в виде строки параметра: date, -date и т.д.
+func (q *ListQuery) sortKey() string {
+	if q.SortDesc {
+		return "-" + q.SortField
+	}
+	return q.SortField
+}
+
+// Sort возвращает документ сортировки. _id используется как уникальный тай-брейкер.
+func (q *ListQuery) Sort() bson.D {
+	direction := 1
+	if q.SortDesc {
+		direction = -1
+	}
+	return bson.D{{Key: q.SortField, Value: direction}, {Key: "_id", Value: direction}}
+}
+
+// PageFilter добавляет к фильтру условие «после курсора».
+func (q *ListQuery) PageFilter() bson.M {
+	if q.Cursor == nil {
+		return q.Filter
+	}
+
+	op := "$gt"
+	if q.SortDesc {
+		op = "$lt"
+	}
+
+	var value interface{} = primitive.DateTime(q.Cursor.Date)
+	if q.SortField == "amount" {
+		amount, _ := money.Parse(q.Cursor.Amount) // Формат проверен в decodeCursor
+		value = amount
+	}
+
+	after := bson.M{"$or": bson.A{
+		bson.M{q.SortField: bson.M{op: value}},
+		bson.M{q.SortField: value, "_id": bson.M{op: q.Cursor.ID}},
+	}}
+	return bson.M{"$and": bson.A{q.Filter, after}}
+}
+
+// NextCursor формирует курсор, указывающий на позицию после последнего документа страницы.
+func (q *ListQuery) NextCursor(id primitive.ObjectID, date primitive.DateTime, amount money.Amount) string {
+	cursor := pageCursor{Sort: q.sortKey(), ID: id}
+	if q.SortField == "date" {
+		cursor.Date = int64(date)
+	} else {
+		cursor.Amount = amount.String()
+	}
+	return encodeCursor(cursor)
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID.IsZero() {
+		return nil, errors.New("курсор без идентификатора")
+	}
+	if cursor.Amount != "" {
+		if _, err := money.Parse(cursor.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,108 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+)
+
+// maxSplits — ограничение числа частей в разбивке транзакции.
+const maxSplits = 20
+
+// SplitIndexField — номер части после SplitStages; у транзакции без разбивки поле равно null.
+const SplitIndexField = "split_index"
+
+// TransactionCountExpr считает транзакции после SplitStages: единицу даёт только первая оставшаяся часть разбивки.
+var TransactionCountExpr = bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$" + SplitIndexField, 0}}, 0, 1}}
+
+// SplitStages возвращает стадии агрегации, которые разворачивают транзакцию с разбивкой
+// в документы по частям: category и amount части заменяют поля транзакции.
+// Транзакции без разбивки проходят как есть. Если заданы категории names, от разбивки остаются только части
+// этих категорий, а транзакция без таких частей отбрасывается. Ставятся до rates.ConvertStages.
+func SplitStages(names []string) mongo.Pipeline {
+	var stages mongo.Pipeline
+	if len(names) > 0 {
+		stages = append(stages,
+			bson.D{{Key: "$set", Value: bson.M{"splits": bson.M{"$cond": bson.A{
+				bson.M{"$isArray": "$splits"},
+				bson.M{"$filter": bson.M{"input": "$splits", "cond": bson.M{"$in": bson.A{"$$this.category", names}}}},
+				"$$REMOVE",
+			}}}}},
+			bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+				bson.M{"splits": bson.M{"$exists": false}, "category": bson.M{"$in": names}},
+				bson.M{"splits.0": bson.M{"$exists": true}},
+			}}}},
+		)
+	}
+	return append(stages,
+		bson.D{{Key: "$unwind", Value: bson.M{
+			"path":                       "$splits",
+			"includeArrayIndex":          SplitIndexField,
+			"preserveNullAndEmptyArrays": true,
+		}}},
+		bson.D{{Key: "$set", Value: bson.M{
+			"category": bson.M{"$ifNull": bson.A{"$splits.category", "$category"}},
+			"amount":   bson.M{"$ifNull": bson.A{"$splits.amount", "$amount"}},
+		}}},
+	)
+}
+
+// validateSplits проверяет разбивку транзакции с уже округлённой суммой и известной валютой:
+// от 2 до 20 частей с существующими категориями и положительными суммами, которые в сумме дают amount.
+// Суммы частей округляются до минорных единиц валюты. Без категории транзакция получает категорию самой крупной части.
+func validateSplits(ctx context.Context, t *models.Transaction) error {
+	if len(t.Splits) == 0 {
+		t.Splits = nil
+		return nil
+	}
+	if len(t.Splits) < 2 {
+		return fiber.NewError(fiber.StatusBadRequest, "Разбивка должна состоять хотя бы из двух частей")
+	}
+	if len(t.Splits) > maxSplits {
+		return fiber.NewError(fiber.StatusBadRequest, "Разбивка может состоять не больше чем из 20 частей")
+	}
+
+	total := money.Zero
+	largest := 0
+	for i := range t.Splits {
+		split := &t.Splits[i]
+		position := strconv.Itoa(i + 1)
+		if split.Category == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "У части "+position+" разбивки нет категории")
+		}
+		exists, err := categories.Exists(ctx, t.UserID, split.Category)
+		if err != nil {
+			return fmt.Errorf("проверка категории: %w", err)
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusBadRequest, "Категория '"+split.Category+"' не найдена")
+		}
+		split.Amount = split.Amount.Round(t.CurrencyOrDefault())
+		if !split.Amount.IsPositive() {
+			return fiber.NewError(fiber.StatusBadRequest, "Сумма части "+position+" разбивки должна быть положительной")
+		}
+		if split.Notes, err = validateNotes(split.Notes); err != nil {
+			return err
+		}
+		total = total.Add(split.Amount)
+		if split.Amount.Cmp(t.Splits[largest].Amount) > 0 {
+			largest = i
+		}
+	}
+
+	if total.Cmp(t.Amount) != 0 {
+		currency := t.CurrencyOrDefault()
+		return fiber.NewError(fiber.StatusBadRequest, "Сумма частей разбивки ("+total.StringFixed(currency)+
+			") не совпадает с суммой транзакции ("+t.Amount.StringFixed(currency)+")")
+	}
+	if t.Category == "" {
+		t.Category = t.Splits[largest].Category
+	}
+	return nil
+}
@@ -2,22 +2,48 @@ package transactions
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/categories"
 	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/middleware"
 	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/rules"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"github.com/IIkar/WealFlow/2025/trash"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"strings"
 	"time"
 )
 
 // GetTransactions godoc
 // @Summary Получить список транзакций
+// @Description Поддерживает фильтры, сортировку и курсорную пагинацию. Для следующей страницы передайте next_cursor в параметре cursor.
 // @Tags transactions
 // @Security ApiKeyAuth
 // @Produce json
-// @Success 200 {array} models.Transaction
+// @Param from query string false "Начало периода (YYYY-MM-DD или ISO 8601)"
+// @Param to query string false "Конец периода включительно (YYYY-MM-DD или ISO 8601)"
+// @Param type query string false "Тип: income, expense или transfer"
+// @Param category query string false "Список категорий через запятую"
+// @Param tag query string false "Список тегов через запятую: операции хотя бы с одним из них"
+// @Param account query string false "Список ID счетов через запятую"
+// @Param min_amount query number false "Минимальная сумма"
+// @Param max_amount query number false "Максимальная сумма"
+// @Param q query string false "Поиск по описанию и заметке"
+// @Param sort query string false "Сортировка: date, -date, amount, -amount (по умолчанию -date)"
+// @Param limit query int false "Размер страницы (по умолчанию 50, максимум 500)"
+// @Param cursor query string false "Курсор следующей страницы"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/transactions [get]
@@ -25,15 +51,20 @@ func GetTransactions(c *fiber.Ctx) error {
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if userID == primitive.NilObjectID {
-		log.Printf("Ошибка токена: %v\n")
+		log.Printf("Ошибка токена: %v\n", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
 	}
 
-	var transactions []models.Transaction // Слайс для хранения найденных транзакций
+	query, err := ParseListQuery(c, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	transactions := make([]models.Transaction, 0, query.Limit) // Слайс для хранения найденных транзакций
 
-	// Выполняем поиск всех документов в коллекции
-	filter := bson.M{"user_id": userID}
-	cursor, err := database.TransactionsCollection.Find(context.Background(), filter)
+	// Запрашиваем на один документ больше, чтобы понять, есть ли следующая страница
+	findOptions := options.Find().SetSort(query.Sort()).SetLimit(query.Limit + 1)
+	cursor, err := database.TransactionsCollection.Find(context.Background(), query.PageFilter(), findOptions)
 	if err != nil {
 		log.Printf("Ошибка при поиске транзакций: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить транзакции"})
@@ -61,12 +92,21 @@ func GetTransactions(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка при итерации курсора"})
 	}
 
-	// Возвращаем список транзакций в формате JSON
-	return c.JSON(transactions)
+	// Если получили лишний документ — отбрасываем его и формируем курсор по последнему документу страницы
+	nextCursor := ""
+	if int64(len(transactions)) > query.Limit {
+		transactions = transactions[:query.Limit]
+		last := transactions[len(transactions)-1]
+		nextCursor = query.NextCursor(last.ID, last.Date, last.Amount)
+	}
+
+	// Возвращаем страницу транзакций в формате JSON
+	return c.JSON(fiber.Map{"transactions": transactions, "next_cursor": nextCursor})
 }
 
 // PostTransaction godoc
 // @Summary Создать новую транзакцию
+// @Description Вероятный дубль уже сохранённой транзакции создаётся с пометкой possible_duplicate_of (см. /api/transactions/duplicates).
 // @Tags transactions
 // @Security ApiKeyAuth
 // @Accept json
@@ -81,7 +121,7 @@ func PostTransaction(c *fiber.Ctx) error {
 
 	userID := c.Locals("userID").(string)
 	if userID == "" {
-		log.Printf("Ошибка токена: %v\n")
+		log.Println("Ошибка токена: пустой идентификатор пользователя")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
 	}
 
@@ -93,50 +133,127 @@ func PostTransaction(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
 	}
 
-	// Простая валидация полей
-	if transaction.Description == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'description' обязательно"})
-	}
-	if transaction.Category == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'category' обязательно"})
+	// Переводы создаются только через /api/transfers
+	if transaction.Kind != "" || transaction.TransferID != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Для переводов между счетами используйте /api/transfers"})
 	}
 
 	transaction.UserID, _ = primitive.ObjectIDFromHex(userID)
+	transaction.RecurringID = nil
+	transaction.Occurrence = ""
+	transaction.ImportID = nil
+	transaction.ExternalID = ""
+	transaction.PossibleDuplicateOf = nil
+	transaction.Receipt = nil
+	transaction.Version = 0
+
+	// Правила заполняют категорию и счёт, если их не передали, и добавляют теги
+	if engine, err := rules.Load(context.Background(), transaction.UserID); err != nil {
+		log.Printf("Ошибка загрузки правил: %v\n", err)
+	} else {
+		engine.Fill(transaction)
+	}
+
+	if err := Validate(context.Background(), transaction); err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось проверить транзакцию")
+	}
 
 	// Если дата не передана клиентом, устанавливаем текущую дату и время
 	if transaction.Date == 0 { // primitive.DateTime это int64, 0 - его нулевое значение
 		transaction.Date = primitive.NewDateTimeFromTime(time.Now())
 	}
 
-	insertRes, err := database.TransactionsCollection.InsertOne(context.Background(), transaction)
+	// Вероятный дубль сохраняется с пометкой; сбой поиска не мешает созданию транзакции
+	duplicateOf, err := FindDuplicate(context.Background(), *transaction)
+	if err != nil {
+		log.Printf("Ошибка поиска дублей транзакции: %v\n", err)
+	}
+	transaction.PossibleDuplicateOf = duplicateOf
+
+	// Транзакция и её первая ревизия истории сохраняются вместе
+	transaction.ID = primitive.NewObjectID()
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if _, err := database.TransactionsCollection.InsertOne(sessCtx, transaction); err != nil {
+			return nil, err
+		}
+		return nil, history.Record(sessCtx, history.By(transaction.UserID, history.SourceAPI), history.ActionCreate, history.Change{After: transaction})
+	})
 	if err != nil {
 		log.Printf("Ошибка вставки транзакции: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать транзакцию"})
 	}
 
-	// Присваиваем сгенерированный ID обратно в структуру для ответа клиенту
-	transaction.ID = insertRes.InsertedID.(primitive.ObjectID)
+	// Модель подсказок категорий учится на новой транзакции
+	if err := suggest.Learn(context.Background(), transaction.UserID, *transaction); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
 
 	// Возвращаем созданную транзакцию со статусом 201 Created
+	c.Set(fiber.HeaderETag, ETag(*transaction))
 	return c.Status(fiber.StatusCreated).JSON(transaction)
 }
 
+// GetTransaction godoc
+// @Summary Получить транзакцию
+// @Description Версия транзакции возвращается в заголовке ETag; её нужно передать в If-Match при изменении и удалении.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Success 200 {object} models.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transactions/{id} [get]
+func GetTransaction(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	var transaction models.Transaction
+	err = database.TransactionsCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&transaction)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена"})
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить транзакцию"})
+	}
+
+	c.Set(fiber.HeaderETag, ETag(transaction))
+	return c.JSON(transaction)
+}
+
 // UpdateTransaction godoc
 // @Summary Обновить транзакцию
+// @Description Требует заголовок If-Match с ETag транзакции; новый ETag возвращается в ответе.
+// @Description Если транзакцию успели изменить, ответ 412 содержит её текущее состояние в поле transaction.
 // @Tags transactions
 // @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "ID транзакции"
+// @Param If-Match header string true "ETag транзакции"
 // @Param update body map[string]interface{} true "Обновляемые поля"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Вторая нога перевода не найдена"
+// @Failure 412 {object} map[string]interface{} "Транзакция изменена"
+// @Failure 428 {object} map[string]string "Нет заголовка If-Match"
+// @Failure 500 {object} map[string]string
 // @Router /api/transactions/{id} [patch]
 func UpdateTransaction(c *fiber.Ctx) error {
 	userStr := c.Locals("userID").(string)
 	if userStr == "" {
-		log.Printf("Ошибка токена: %v\n")
+		log.Println("Ошибка токена: пустой идентификатор пользователя")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
 	}
 	userID, _ := primitive.ObjectIDFromHex(userStr)
@@ -157,6 +274,32 @@ func UpdateTransaction(c *fiber.Ctx) error {
 	delete(updates, "id")
 	delete(updates, "_id")
 	delete(updates, "user_id")
+	delete(updates, "kind")
+	delete(updates, "transfer_id")
+	delete(updates, "recurring_id")
+	delete(updates, "occurrence")
+	delete(updates, "import_id")
+	delete(updates, "external_id")
+	delete(updates, "possible_duplicate_of")
+	delete(updates, "receipt")
+	delete(updates, "version")
+
+	// Фильтр для поиска документа по ID
+	filter := bson.M{"_id": objectID, "user_id": userID}
+
+	// Текущее состояние нужно для проверки валюты и счёта
+	var existing models.Transaction
+	err = database.TransactionsCollection.FindOne(context.Background(), filter).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена"})
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить транзакцию"})
+	}
+	if err := checkIfMatch(c, existing); err != nil {
+		return ifMatchError(c, err, existing)
+	}
 
 	// Специальная обработка для поля "date", если оно передано как строка
 	if dateStr, ok := updates["date"].(string); ok {
@@ -170,52 +313,262 @@ func UpdateTransaction(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'date', если передано, должно быть строкой в формате ISO 8601"})
 	}
 
+	// Новая категория, если передана, должна существовать у пользователя
+	if _, ok := updates["category"]; ok {
+		category, isString := updates["category"].(string)
+		if !isString || category == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'category' должно быть непустой строкой"})
+		}
+		exists, err := categories.Exists(context.Background(), userID, category)
+		if err != nil {
+			log.Printf("Ошибка проверки категории: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить категорию"})
+		}
+		if !exists {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Категория '" + category + "' не найдена"})
+		}
+	}
+
+	// Поля, которые удаляются из документа
+	unsets := bson.M{}
+
+	// Теги заменяются целиком; пустой список удаляет теги
+	if value, ok := updates["tags"]; ok {
+		list, valid := value.([]interface{})
+		if !valid && value != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'tags' должно быть массивом строк"})
+		}
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			name, isString := item.(string)
+			if !isString {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'tags' должно быть массивом строк"})
+			}
+			names = append(names, name)
+		}
+		normalized, err := tags.Normalize(names)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if len(normalized) == 0 {
+			delete(updates, "tags")
+			unsets["tags"] = ""
+		} else {
+			updates["tags"] = normalized
+		}
+	}
+
+	// Заметка заменяется целиком; пустая строка удаляет заметку
+	if value, ok := updates["notes"]; ok {
+		notes, isString := value.(string)
+		if !isString && value != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'notes' должно быть строкой"})
+		}
+		notes, err := validateNotes(notes)
+		if err != nil {
+			return middleware.ErrorResponse(c, err, "Не удалось проверить заметку")
+		}
+		if notes == "" {
+			delete(updates, "notes")
+			unsets["notes"] = ""
+		} else {
+			updates["notes"] = notes
+		}
+	}
+
+	// Валюта, если передана, должна быть кодом ISO 4217
+	currency := existing.CurrencyOrDefault()
+	_, currencyGiven := updates["currency"]
+	if currencyGiven {
+		code, _ := updates["currency"].(string)
+		currency = strings.ToUpper(code)
+		if !money.ValidCurrency(currency) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'currency' должно быть кодом валюты ISO 4217, например RUB"})
+		}
+	}
+
+	// Счёт: пустое значение отвязывает транзакцию от счёта, иначе счёт должен принадлежать пользователю
+	var account *models.Account
+	if value, ok := updates["account_id"]; ok {
+		accountStr, _ := value.(string)
+		if accountStr == "" {
+			delete(updates, "account_id")
+			unsets["account_id"] = ""
+		} else {
+			accountID, err := primitive.ObjectIDFromHex(accountStr)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат 'account_id'"})
+			}
+			account, err = accounts.Find(context.Background(), userID, accountID)
+			if err != nil {
+				log.Printf("Ошибка проверки счёта: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить счёт"})
+			}
+			if account == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Счёт не найден"})
+			}
+			updates["account_id"] = accountID
+		}
+	} else if currencyGiven && existing.AccountID != nil {
+		var err error
+		account, err = accounts.Find(context.Background(), userID, *existing.AccountID)
+		if err != nil {
+			log.Printf("Ошибка проверки счёта: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить счёт"})
+		}
+	}
+
+	// Валюта операции со счётом совпадает с валютой счёта; при смене счёта валюта следует за ним
+	if account != nil {
+		if !currencyGiven {
+			currency = account.Currency
+		}
+		if currency != account.Currency {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Валюта транзакции должна совпадать с валютой счёта (" + account.Currency + ")"})
+		}
+	}
+	delete(updates, "currency")
+	if currency != existing.CurrencyOrDefault() {
+		if existing.Kind == models.KindTransfer {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нога перевода может перейти только на счёт в той же валюте"})
+		}
+		updates["currency"] = currency
+	}
+
+	// Сумма приводится к точному десятичному значению в минорных единицах валюты
+	if value, ok := updates["amount"]; ok {
+		amount, err := money.FromValue(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'amount' должно быть числом"})
+		}
+		updates["amount"] = amount.Round(currency)
+	} else if _, ok := updates["currency"]; ok {
+		updates["amount"] = existing.Amount.Round(currency)
+	}
+
+	// Разбивка заменяется целиком, пустой список удаляет её. Части должны сходиться с суммой транзакции,
+	// поэтому разбивка проверяется заново и при смене одной только суммы или валюты
+	splits := existing.Splits
+	_, splitsGiven := updates["splits"]
+	if splitsGiven {
+		splits = nil
+		if value := updates["splits"]; value != nil {
+			raw, err := json.Marshal(value)
+			if err == nil {
+				err = json.Unmarshal(raw, &splits)
+			}
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поле 'splits' должно быть массивом частей с полями category, amount и notes"})
+			}
+		}
+	}
+	_, amountChanged := updates["amount"]
+	if len(splits) > 0 && (splitsGiven || amountChanged) {
+		if existing.Kind == models.KindTransfer {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Перевод нельзя разбить по категориям"})
+		}
+		probe := existing
+		probe.Currency = currency
+		probe.Splits = splits
+		if amount, ok := updates["amount"].(money.Amount); ok {
+			probe.Amount = amount
+		}
+		if err := validateSplits(context.Background(), &probe); err != nil {
+			return middleware.ErrorResponse(c, err, "Не удалось проверить разбивку")
+		}
+		updates["splits"] = probe.Splits
+	} else if splitsGiven {
+		delete(updates, "splits")
+		unsets["splits"] = ""
+	}
+
 	// Проверяем, есть ли вообще что обновлять
-	if len(updates) == 0 {
+	if len(updates) == 0 && len(unsets) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нет полей для обновления"})
 	}
 
-	// Фильтр для поиска документа по ID
-	filter := bson.M{"_id": objectID, "user_id": userID}
-	// Документ для обновления с оператором $set
-	updateDoc := bson.M{"$set": updates}
+	// Нога перевода обновляется вместе со второй ногой
+	if existing.Kind == models.KindTransfer {
+		updated, err := updateTransferLeg(context.Background(), existing, updates, unsets)
+		if err == mongo.ErrNoDocuments {
+			return staleOrMissing(c, filter)
+		}
+		if err != nil {
+			return middleware.ErrorResponse(c, err, "Не удалось обновить перевод")
+		}
+		c.Set(fiber.HeaderETag, ETag(updated))
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Перевод успешно обновлён"})
+	}
 
-	// Выполняем операцию обновления одного документа
-	result, err := database.TransactionsCollection.UpdateOne(context.Background(), filter, updateDoc)
+	// Документ для обновления с операторами $set и $unset
+	updateDoc := bson.M{}
+	if len(updates) > 0 {
+		updateDoc["$set"] = updates
+	}
+	if len(unsets) > 0 {
+		updateDoc["$unset"] = unsets
+	}
+
+	// Обновление и ревизия истории с прежними значениями полей записываются вместе.
+	// Условие на версию не даёт затереть изменение, сделанное после проверки If-Match
+	versioned := database.VersionFilter(bson.M{"_id": objectID, "user_id": userID}, existing.Version)
+	var change history.Change
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var err error
+		change, err = history.Update(sessCtx, history.By(userID, history.SourceAPI), versioned, updateDoc)
+		return nil, err
+	})
+	if err == mongo.ErrNoDocuments {
+		return staleOrMissing(c, filter)
+	}
 	if err != nil {
 		log.Printf("Ошибка обновления транзакции: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось обновить транзакцию"})
 	}
 
-	// Проверяем, был ли найден документ для обновления
-	if result.MatchedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена"})
-	}
-	// Проверяем, были ли применены изменения (может быть 0, если данные идентичны)
-	if result.ModifiedCount == 0 && result.MatchedCount == 1 {
+	c.Set(fiber.HeaderETag, ETag(*change.After))
+
+	// Данные могли совпасть с текущими: тогда ревизия не записывается
+	if change.Empty() {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Транзакция найдена, но изменения не применены (данные могут быть идентичны)"})
 	}
 
+	// Модель подсказок забывает прежние категорию и описание и учится на новых
+	before, after := change.Before, change.After
+	if before.Category != after.Category || before.Description != after.Description {
+		if err := suggest.Forget(context.Background(), userID, *before); err != nil {
+			log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+		} else if err := suggest.Learn(context.Background(), userID, *after); err != nil {
+			log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+		}
+	}
+
 	// Возвращаем сообщение об успехе
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Транзакция успешно обновлена"})
 }
 
 // DeleteTransaction godoc
 // @Summary Удалить транзакцию
+// @Description Транзакция переносится в корзину (см. /api/trash) и пропадает из списков, статистики и бюджетов.
+// @Description Удаление ноги перевода переносит в корзину обе ноги.
+// @Description Требует заголовок If-Match с ETag транзакции; если её успели изменить — 412 с текущим состоянием.
 // @Tags transactions
 // @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "ID транзакции"
+// @Param If-Match header string true "ETag транзакции"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]interface{} "Транзакция изменена"
+// @Failure 428 {object} map[string]string "Нет заголовка If-Match"
 // @Failure 500 {object} map[string]string
 // @Router /api/transactions/{id} [delete]
 func DeleteTransaction(c *fiber.Ctx) error {
 	userStr := c.Locals("userID").(string)
 	if userStr == "" {
-		log.Printf("Ошибка токена: %v\n")
+		log.Println("Ошибка токена: пустой идентификатор пользователя")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
 	}
 	userID, _ := primitive.ObjectIDFromHex(userStr)
@@ -226,21 +579,58 @@ func DeleteTransaction(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
 	}
 
-	// Фильтр для поиска документа по ID
-	filter := bson.M{"_id": objectID, "user_id": userID} // <--- ВАЖНО: проверяем и ID транзакции, и UserID
-
-	// Выполняем операцию удаления одного документа
-	result, err := database.TransactionsCollection.DeleteOne(context.Background(), filter)
+	var existing models.Transaction
+	err = database.TransactionsCollection.FindOne(context.Background(), bson.M{"_id": objectID, "user_id": userID}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена для удаления"})
+	}
 	if err != nil {
-		log.Printf("Ошибка удаления транзакции: %v\n", err)
+		log.Printf("Ошибка при поиске транзакции: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить транзакцию"})
 	}
+	if err := checkIfMatch(c, existing); err != nil {
+		return ifMatchError(c, err, existing)
+	}
 
-	// Проверяем, был ли удален какой-либо документ
-	if result.DeletedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена для удаления"})
+	// Удаление ноги перевода удаляет обе ноги. Версия проверяется в той же транзакции MongoDB, что и перенос:
+	// транзакция, изменённая после проверки If-Match, не удаляется
+	filter := bson.M{"_id": objectID}
+	if existing.Kind == models.KindTransfer {
+		filter = bson.M{"transfer_id": existing.TransferID}
 	}
+	var moved []models.Transaction
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		moved = nil
+		count, err := database.TransactionsCollection.CountDocuments(sessCtx,
+			database.VersionFilter(bson.M{"_id": objectID, "user_id": userID}, existing.Version))
+		if err != nil || count == 0 {
+			return nil, err
+		}
+		moved, err = trash.Move(sessCtx, userID, filter)
+		if err != nil {
+			return nil, err
+		}
 
-	// Возвращаем сообщение об успехе
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Транзакция успешно удалена"})
+		// Дубли удалённой транзакции перестают быть дублями
+		ids := make([]primitive.ObjectID, len(moved))
+		for i, t := range moved {
+			ids[i] = t.ID
+		}
+		return nil, ClearDuplicateRefs(sessCtx, history.By(userID, history.SourceAPI), userID, ids)
+	})
+	if err != nil {
+		log.Printf("Ошибка переноса транзакции в корзину: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось удалить транзакцию"})
+	}
+	if len(moved) == 0 {
+		return staleOrMissing(c, bson.M{"_id": objectID, "user_id": userID})
+	}
+	if err := suggest.Forget(context.Background(), userID, moved...); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
+
+	if existing.Kind == models.KindTransfer {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Перевод перенесён в корзину"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"success": true, "message": "Транзакция перенесена в корзину"})
 }
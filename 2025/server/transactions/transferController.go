@@ -0,0 +1,220 @@
+package transactions
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// transferEditable — поля ноги перевода, которые можно менять через PATCH.
+// description, date и amount синхронизируются со второй ногой, account_id, tags и notes меняются только у своей.
+// amount синхронизируется, только если ноги в одной валюте.
+var transferEditable = map[string]bool{
+	"description": true,
+	"date":        true,
+	"amount":      true,
+	"account_id":  true,
+	"tags":        true,
+	"notes":       true,
+}
+
+// TransferRequest — тело запроса на создание перевода.
+type TransferRequest struct {
+	FromAccountID primitive.ObjectID `json:"from_account_id"`
+	ToAccountID   primitive.ObjectID `json:"to_account_id"`
+	Amount        money.Amount       `json:"amount"`    // Сумма списания в валюте счёта-источника
+	ToAmount      money.Amount       `json:"to_amount"` // Сумма зачисления; обязательна, если валюты счетов различаются
+	Description   string             `json:"description"`
+	Date          primitive.DateTime `json:"date"`
+}
+
+// PostTransfer godoc
+// @Summary Создать перевод между счетами
+// @Description Создаёт две связанные транзакции (списание и зачисление) в одной транзакции MongoDB. Переводы не учитываются в доходах и расходах статистики.
+// @Description Каждая нога хранится в валюте своего счёта; для счетов в разных валютах обязательна сумма зачисления to_amount.
+// @Tags transactions
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param transfer body TransferRequest true "Данные перевода"
+// @Success 201 {array} models.Transaction
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transfers [post]
+func PostTransfer(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	request := new(TransferRequest)
+	if err := c.BodyParser(request); err != nil {
+		log.Printf("Ошибка парсинга тела запроса: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Некорректный формат JSON"})
+	}
+
+	if request.FromAccountID.IsZero() || request.ToAccountID.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Поля 'from_account_id' и 'to_account_id' обязательны"})
+	}
+	if request.FromAccountID == request.ToAccountID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Счета списания и зачисления должны различаться"})
+	}
+	var legAccounts [2]*models.Account
+	for i, accountID := range []primitive.ObjectID{request.FromAccountID, request.ToAccountID} {
+		account, err := accounts.Find(context.Background(), userID, accountID)
+		if err != nil {
+			log.Printf("Ошибка проверки счёта: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось проверить счёт"})
+		}
+		if account == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Счёт не найден"})
+		}
+		legAccounts[i] = account
+	}
+	fromCurrency, toCurrency := legAccounts[0].Currency, legAccounts[1].Currency
+
+	// Каждая нога хранится в валюте своего счёта. Между валютами сумму зачисления
+	// задаёт пользователь: это фактический курс обмена, а не курс из справочника
+	request.Amount = request.Amount.Round(fromCurrency)
+	if fromCurrency == toCurrency {
+		if !request.ToAmount.IsZero() && !request.ToAmount.Round(toCurrency).Equal(request.Amount) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Для счетов в одной валюте 'to_amount' должна совпадать с 'amount'"})
+		}
+		request.ToAmount = request.Amount
+	} else if request.ToAmount.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Счета в разных валютах: укажите сумму зачисления 'to_amount'"})
+	}
+	request.ToAmount = request.ToAmount.Round(toCurrency)
+	if !request.Amount.IsPositive() || !request.ToAmount.IsPositive() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Сумма перевода должна быть положительной"})
+	}
+	if request.Date == 0 {
+		request.Date = primitive.NewDateTimeFromTime(time.Now())
+	}
+	if request.Description == "" {
+		request.Description = "Перевод между счетами"
+	}
+
+	transferID := primitive.NewObjectID()
+	from, to := request.FromAccountID, request.ToAccountID
+	legs := []models.Transaction{
+		{
+			ID:          primitive.NewObjectID(),
+			UserID:      userID,
+			Date:        request.Date,
+			Description: request.Description,
+			Amount:      request.Amount,
+			Currency:    fromCurrency,
+			Type:        false, // Списание
+			AccountID:   &from,
+			Kind:        models.KindTransfer,
+			TransferID:  &transferID,
+		},
+		{
+			ID:          primitive.NewObjectID(),
+			UserID:      userID,
+			Date:        request.Date,
+			Description: request.Description,
+			Amount:      request.ToAmount,
+			Currency:    toCurrency,
+			Type:        true, // Зачисление
+			AccountID:   &to,
+			Kind:        models.KindTransfer,
+			TransferID:  &transferID,
+		},
+	}
+
+	_, err = database.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if _, err := database.TransactionsCollection.InsertMany(sessCtx, []interface{}{legs[0], legs[1]}); err != nil {
+			return nil, err
+		}
+		return nil, history.Record(sessCtx, history.By(userID, history.SourceAPI), history.ActionCreate,
+			history.Change{After: &legs[0]}, history.Change{After: &legs[1]})
+	})
+	if err != nil {
+		log.Printf("Ошибка создания перевода: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось создать перевод"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(legs)
+}
+
+// updateTransferLeg применяет изменения к ноге перевода и синхронизирует вторую ногу.
+// updates уже провалидированы UpdateTransaction (дата, сумма и счёт приведены к нужным типам).
+// Нога обновляется, только если её версия не изменилась, иначе — mongo.ErrNoDocuments; без второй ноги — *fiber.Error 409.
+// Возвращает обновлённую ногу.
+func updateTransferLeg(ctx context.Context, leg models.Transaction, updates bson.M, unsets bson.M) (models.Transaction, error) {
+	for field := range updates {
+		if !transferEditable[field] {
+			return models.Transaction{}, fiber.NewError(fiber.StatusBadRequest, "У перевода можно менять только description, date, amount, account_id, tags и notes")
+		}
+	}
+	if _, ok := unsets["account_id"]; ok {
+		return models.Transaction{}, fiber.NewError(fiber.StatusBadRequest, "Нога перевода должна быть привязана к счёту")
+	}
+	if amount, ok := updates["amount"].(money.Amount); ok && !amount.IsPositive() {
+		return models.Transaction{}, fiber.NewError(fiber.StatusBadRequest, "Сумма перевода должна быть положительной")
+	}
+
+	// Поля, общие для обеих ног
+	shared := bson.M{}
+	for _, field := range []string{"description", "date", "amount"} {
+		if value, ok := updates[field]; ok {
+			shared[field] = value
+		}
+	}
+
+	var updated models.Transaction
+	_, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var other models.Transaction
+		otherFilter := bson.M{"user_id": leg.UserID, "transfer_id": leg.TransferID, "_id": bson.M{"$ne": leg.ID}}
+		err := database.TransactionsCollection.FindOne(sessCtx, otherFilter).Decode(&other)
+		if err == mongo.ErrNoDocuments {
+			// Не путаем с устаревшей версией ноги, которую прислал клиент: её проверяет условие ниже
+			return nil, fiber.NewError(fiber.StatusConflict, "Вторая нога перевода не найдена")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if accountID, ok := updates["account_id"].(primitive.ObjectID); ok && other.AccountID != nil && accountID == *other.AccountID {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Счета списания и зачисления должны различаться")
+		}
+		// Суммы ног в разных валютах независимы
+		if other.CurrencyOrDefault() != leg.CurrencyOrDefault() {
+			delete(shared, "amount")
+		}
+
+		updateDoc := bson.M{}
+		if len(updates) > 0 {
+			updateDoc["$set"] = updates
+		}
+		if len(unsets) > 0 {
+			updateDoc["$unset"] = unsets
+		}
+		origin := history.By(leg.UserID, history.SourceAPI)
+		change, err := history.Update(sessCtx, origin, database.VersionFilter(bson.M{"_id": leg.ID}, leg.Version), updateDoc)
+		if err != nil {
+			return nil, err
+		}
+		updated = *change.After
+		if len(shared) > 0 {
+			if _, err := history.Update(sessCtx, origin, bson.M{"_id": other.ID}, bson.M{"$set": shared}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return updated, err
+}
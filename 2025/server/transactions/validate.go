@@ -0,0 +1,95 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/auth"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/money"
+	"github.com/IIkar/WealFlow/2025/tags"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNotesLength — ограничение длины заметки транзакции в символах.
+const maxNotesLength = 2000
+
+// validateNotes убирает пробелы по краям заметки и проверяет её длину.
+func validateNotes(notes string) (string, error) {
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Поле 'notes' длиннее 2000 символов")
+	}
+	return notes, nil
+}
+
+// Validate проверяет новую обычную транзакцию пользователя t.UserID и приводит её поля к виду для сохранения:
+// категория и счёт должны существовать, валюта по умолчанию берётся из счёта или базовой валюты
+// пользователя, сумма округляется до минорных единиц валюты, разбивка сходится с суммой,
+// теги нормализуются, длина заметки ограничена.
+// Ошибки данных возвращаются как *fiber.Error со статусом 400, остальные — ошибки базы.
+func Validate(ctx context.Context, t *models.Transaction) error {
+	if t.Description == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'description' обязательно")
+	}
+	if t.Category == "" && len(t.Splits) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'category' обязательно")
+	}
+
+	// Счёт, если указан, должен принадлежать пользователю; валюта операции совпадает с валютой счёта.
+	// Без счёта валюта по умолчанию — базовая валюта пользователя
+	t.Currency = strings.ToUpper(t.Currency)
+	if t.AccountID != nil {
+		account, err := accounts.Find(ctx, t.UserID, *t.AccountID)
+		if err != nil {
+			return fmt.Errorf("проверка счёта: %w", err)
+		}
+		if account == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Счёт не найден")
+		}
+		if t.Currency == "" {
+			t.Currency = account.Currency
+		}
+		if t.Currency != account.Currency {
+			return fiber.NewError(fiber.StatusBadRequest, "Валюта транзакции должна совпадать с валютой счёта ("+account.Currency+")")
+		}
+	}
+	if t.Currency == "" {
+		baseCurrency, err := auth.BaseCurrency(ctx, t.UserID)
+		if err != nil {
+			return fmt.Errorf("получение базовой валюты: %w", err)
+		}
+		t.Currency = baseCurrency
+	}
+	if !money.ValidCurrency(t.Currency) {
+		return fiber.NewError(fiber.StatusBadRequest, "Поле 'currency' должно быть кодом валюты ISO 4217, например RUB")
+	}
+
+	// Сумма хранится с точностью до минорных единиц валюты
+	t.Amount = t.Amount.Round(t.Currency)
+
+	// Части разбивки в сумме дают сумму транзакции; без категории берётся категория самой крупной части
+	if err := validateSplits(ctx, t); err != nil {
+		return err
+	}
+
+	// Категория должна существовать у пользователя
+	exists, err := categories.Exists(ctx, t.UserID, t.Category)
+	if err != nil {
+		return fmt.Errorf("проверка категории: %w", err)
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusBadRequest, "Категория '"+t.Category+"' не найдена")
+	}
+
+	if t.Tags, err = tags.Normalize(t.Tags); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if t.Notes, err = validateNotes(t.Notes); err != nil {
+		return err
+	}
+	return nil
+}
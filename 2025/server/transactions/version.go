@@ -0,0 +1,74 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// errStale — ETag из If-Match не совпадает с текущей версией транзакции.
+var errStale = errors.New("версия транзакции устарела")
+
+// ETag возвращает ETag транзакции: её версию в кавычках, например "3".
+func ETag(t models.Transaction) string {
+	return `"` + strconv.FormatInt(t.Version, 10) + `"`
+}
+
+// checkIfMatch сверяет заголовок If-Match с версией транзакции t. Заголовок обязателен: без него — *fiber.Error 428.
+// Подходит любой из перечисленных через запятую ETag или "*"; несовпадение — errStale.
+func checkIfMatch(c *fiber.Ctx, t models.Transaction) error {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return fiber.NewError(fiber.StatusPreconditionRequired, "Передайте заголовок If-Match с ETag транзакции")
+	}
+	if header == "*" {
+		return nil
+	}
+	etag := ETag(t)
+	for _, value := range strings.Split(header, ",") {
+		if strings.TrimSpace(value) == etag {
+			return nil
+		}
+	}
+	return errStale
+}
+
+// preconditionFailed отвечает 412 с текущим состоянием транзакции и её ETag.
+func preconditionFailed(c *fiber.Ctx, current models.Transaction) error {
+	c.Set(fiber.HeaderETag, ETag(current))
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":       "Транзакция изменена с момента получения ETag. Повторите изменение для текущей версии",
+		"transaction": current,
+	})
+}
+
+// ifMatchError переводит ошибку checkIfMatch в HTTP-ответ.
+func ifMatchError(c *fiber.Ctx, err error, current models.Transaction) error {
+	if err == errStale {
+		return preconditionFailed(c, current)
+	}
+	return middleware.ErrorResponse(c, err, "Не удалось проверить If-Match")
+}
+
+// staleOrMissing отвечает на условную запись, которая не нашла транзакцию по filter с версией:
+// транзакцию успели изменить (412 с текущим состоянием) или удалить (404).
+func staleOrMissing(c *fiber.Ctx, filter bson.M) error {
+	var current models.Transaction
+	err := database.TransactionsCollection.FindOne(context.Background(), filter).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Транзакция не найдена"})
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакции: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить транзакцию"})
+	}
+	return preconditionFailed(c, current)
+}
@@ -0,0 +1,287 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"github.com/IIkar/WealFlow/2025/accounts"
+	"github.com/IIkar/WealFlow/2025/attachments"
+	"github.com/IIkar/WealFlow/2025/categories"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/history"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/IIkar/WealFlow/2025/suggest"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// Move переносит транзакции пользователя, подходящие под filter, в корзину и возвращает их.
+// Вложения остаются на месте до очистки корзины, удаление записывается в историю транзакций.
+// Вызывается внутри транзакции MongoDB, с её контекстом.
+func Move(ctx context.Context, userID primitive.ObjectID, filter bson.M) ([]models.Transaction, error) {
+	filter["user_id"] = userID
+	cursor, err := database.TransactionsCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var moved []models.Transaction
+	if err := cursor.All(ctx, &moved); err != nil {
+		return nil, err
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	documents := make([]interface{}, len(moved))
+	ids := make([]primitive.ObjectID, len(moved))
+	changes := make([]history.Change, len(moved))
+	for i := range moved {
+		documents[i] = models.TrashedTransaction{Transaction: moved[i], DeletedAt: now}
+		ids[i] = moved[i].ID
+		changes[i] = history.Change{Before: &moved[i]}
+	}
+	if _, err := database.TrashCollection.InsertMany(ctx, documents); err != nil {
+		return nil, err
+	}
+	if _, err := database.TransactionsCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	if err := history.Record(ctx, history.By(userID, history.SourceAPI), history.ActionDelete, changes...); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// group возвращает транзакцию корзины вместе со второй ногой, если это перевод.
+func group(ctx context.Context, userID primitive.ObjectID, id primitive.ObjectID) ([]models.TrashedTransaction, error) {
+	var item models.TrashedTransaction
+	err := database.TrashCollection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Транзакция в корзине не найдена")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item.TransferID == nil {
+		return []models.TrashedTransaction{item}, nil
+	}
+
+	cursor, err := database.TrashCollection.Find(ctx, bson.M{"user_id": userID, "transfer_id": item.TransferID})
+	if err != nil {
+		return nil, err
+	}
+	var legs []models.TrashedTransaction
+	if err := cursor.All(ctx, &legs); err != nil {
+		return nil, err
+	}
+	return legs, nil
+}
+
+// checkReferences проверяет, что категории и счёт восстанавливаемой транзакции ещё существуют
+// и валюта счёта не сменилась: суммы транзакций хранятся в валюте счёта.
+func checkReferences(ctx context.Context, t models.Transaction) error {
+	names := make([]string, 0, len(t.Splits)+1)
+	if t.Category != "" {
+		names = append(names, t.Category)
+	}
+	for _, split := range t.Splits {
+		names = append(names, split.Category)
+	}
+	for _, name := range names {
+		exists, err := categories.Exists(ctx, t.UserID, name)
+		if err != nil {
+			return fmt.Errorf("проверка категории: %w", err)
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusConflict, "Категория '"+name+"' удалена. Создайте её заново, чтобы восстановить транзакцию")
+		}
+	}
+	if t.AccountID != nil {
+		account, err := accounts.Find(ctx, t.UserID, *t.AccountID)
+		if err != nil {
+			return fmt.Errorf("проверка счёта: %w", err)
+		}
+		if account == nil {
+			return fiber.NewError(fiber.StatusConflict, "Счёт транзакции удалён")
+		}
+		if account.Currency != t.CurrencyOrDefault() {
+			return fiber.NewError(fiber.StatusConflict, "Валюта счёта сменилась на "+account.Currency+": транзакцию в "+t.CurrencyOrDefault()+" восстановить нельзя")
+		}
+	}
+	return nil
+}
+
+// Restore возвращает транзакцию из корзины; перевод восстанавливается обеими ногами.
+// Возвращает восстановленные транзакции.
+func Restore(ctx context.Context, userID primitive.ObjectID, id primitive.ObjectID) ([]models.Transaction, error) {
+	// Категории по умолчанию заводятся до транзакции MongoDB: их вставка пропускает дубликаты, а в транзакции дубликат её прерывает
+	if err := categories.EnsureDefaults(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var restored []models.Transaction
+	_, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Корзина, категории и счета проверяются в той же транзакции, что и восстановление
+		items, err := group(sessCtx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		restored = make([]models.Transaction, len(items))
+		documents := make([]interface{}, len(items))
+		ids := make([]primitive.ObjectID, len(items))
+		for i, item := range items {
+			if err := checkReferences(sessCtx, item.Transaction); err != nil {
+				return nil, err
+			}
+			restored[i] = item.Transaction
+			ids[i] = item.ID
+		}
+
+		changes := make([]history.Change, len(restored))
+		for i, t := range restored {
+			// Пометка дубля имеет смысл, только пока исходная транзакция на месте
+			if t.PossibleDuplicateOf != nil {
+				count, err := database.TransactionsCollection.CountDocuments(sessCtx, bson.M{"_id": t.PossibleDuplicateOf, "user_id": userID})
+				if err != nil {
+					return nil, err
+				}
+				if count == 0 {
+					restored[i].PossibleDuplicateOf = nil
+				}
+			}
+			// Транзакция могла измениться в корзине (переименование категорий): прежний ETag устаревает
+			restored[i].Version++
+			documents[i] = restored[i]
+			changes[i] = history.Change{After: &restored[i]}
+		}
+		if _, err := database.TransactionsCollection.InsertMany(sessCtx, documents); err != nil {
+			return nil, err
+		}
+		if _, err := database.TrashCollection.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID}); err != nil {
+			return nil, err
+		}
+		return nil, history.Record(sessCtx, history.By(userID, history.SourceAPI), history.ActionRestore, changes...)
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fiber.NewError(fiber.StatusConflict, "Такая транзакция уже создана заново (повтор, операция выписки или чек)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := suggest.Learn(ctx, userID, restored...); err != nil {
+		log.Printf("Ошибка обучения подсказок категорий: %v\n", err)
+	}
+	return restored, nil
+}
+
+// purgeChunk — сколько транзакций корзины удаляется в одной транзакции MongoDB: у транзакций есть ограничения
+// по времени и размеру, а очистка за долгий срок может затронуть много записей.
+const purgeChunk = 500
+
+// purge безвозвратно удаляет транзакции корзины, подходящие под filter, вместе с их вложениями.
+// Возвращает число удалённых транзакций.
+func purge(ctx context.Context, filter bson.M) (int64, error) {
+	var total int64
+	for {
+		deleted, byUser, err := purgeNext(ctx, filter)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+
+		// Вложения удаляются после фиксации части: транзакцию, которую успели восстановить, часть не затронула
+		for userID, transactionIDs := range byUser {
+			if err := attachments.Remove(ctx, userID, transactionIDs); err != nil {
+				log.Printf("Ошибка удаления вложений транзакций из корзины: %v\n", err)
+			}
+		}
+		if len(byUser) == 0 || deleted < purgeChunk {
+			return total, nil
+		}
+	}
+}
+
+// purgeNext удаляет из корзины очередные purgeChunk транзакций по filter. Поиск и удаление — в одной транзакции MongoDB.
+// Возвращает число удалённых транзакций и их идентификаторы по владельцам.
+func purgeNext(ctx context.Context, filter bson.M) (int64, map[primitive.ObjectID][]primitive.ObjectID, error) {
+	var byUser map[primitive.ObjectID][]primitive.ObjectID
+	deleted, err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		byUser = map[primitive.ObjectID][]primitive.ObjectID{}
+		cursor, err := database.TrashCollection.Find(sessCtx, filter, options.Find().
+			SetProjection(bson.M{"_id": 1, "user_id": 1}).
+			SetSort(bson.M{"_id": 1}).
+			SetLimit(purgeChunk))
+		if err != nil {
+			return nil, err
+		}
+		var items []models.TrashedTransaction
+		if err := cursor.All(sessCtx, &items); err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return int64(0), nil
+		}
+
+		ids := make([]primitive.ObjectID, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+			byUser[item.UserID] = append(byUser[item.UserID], item.ID)
+		}
+		result, err := database.TrashCollection.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, err
+		}
+		return result.DeletedCount, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return deleted.(int64), byUser, nil
+}
+
+// Purge безвозвратно удаляет транзакцию из корзины; перевод удаляется обеими ногами.
+func Purge(ctx context.Context, userID primitive.ObjectID, id primitive.ObjectID) (int64, error) {
+	items, err := group(ctx, userID, id)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]primitive.ObjectID, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return purge(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+}
+
+// Empty очищает корзину пользователя.
+func Empty(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return purge(ctx, bson.M{"user_id": userID})
+}
+
+// RunPurger раз в interval удаляет из корзин всех пользователей транзакции, удалённые раньше чем retention назад.
+// Запускается в отдельной горутине и работает до отмены ctx.
+func RunPurger(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := primitive.NewDateTimeFromTime(time.Now().Add(-retention))
+		purged, err := purge(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+		if err != nil {
+			log.Printf("Ошибка очистки корзины: %v\n", err)
+		} else if purged > 0 {
+			log.Printf("Из корзины удалено транзакций: %d\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package trash
+
+import (
+	"context"
+	"github.com/IIkar/WealFlow/2025/database"
+	"github.com/IIkar/WealFlow/2025/middleware"
+	"github.com/IIkar/WealFlow/2025/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+)
+
+// Ограничения размера страницы корзины.
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// GetTrash godoc
+// @Summary Получить корзину
+// @Description Удалённые транзакции от недавно удалённых к давним. Перевод лежит в корзине обеими ногами.
+// @Description Транзакции хранятся в корзине ограниченный срок (TRASH_RETENTION_DAYS), затем удаляются безвозвратно.
+// @Tags trash
+// @Security ApiKeyAuth
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 100, максимум 500)"
+// @Param offset query int false "Сколько транзакций пропустить"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/trash [get]
+func GetTrash(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	limit := c.QueryInt("limit", defaultLimit)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > maxLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'limit' должен быть от 1 до 500"})
+	}
+	if offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Параметр 'offset' не может быть отрицательным"})
+	}
+
+	filter := bson.M{"user_id": userID}
+	total, err := database.TrashCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Printf("Ошибка подсчёта транзакций в корзине: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить корзину"})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "deleted_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := database.TrashCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакций в корзине: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Не удалось получить корзину"})
+	}
+
+	items := []models.TrashedTransaction{}
+	if err := cursor.All(context.Background(), &items); err != nil {
+		log.Printf("Ошибка декодирования транзакций в корзине: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка декодирования корзины"})
+	}
+
+	return c.JSON(fiber.Map{"transactions": items, "total": total})
+}
+
+// RestoreTransaction godoc
+// @Summary Восстановить транзакцию из корзины
+// @Description Перевод восстанавливается обеими ногами. Категория и счёт транзакции должны существовать.
+// @Tags trash
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Категория или счёт удалены либо транзакция уже создана заново"
+// @Failure 500 {object} map[string]string
+// @Router /api/trash/{id}/restore [post]
+func RestoreTransaction(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	restored, err := Restore(context.Background(), userID, objectID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось восстановить транзакцию")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Транзакция восстановлена", "transactions": restored})
+}
+
+// PurgeTransaction godoc
+// @Summary Удалить транзакцию из корзины безвозвратно
+// @Description Вместе с транзакцией удаляются её вложения; перевод удаляется обеими ногами.
+// @Tags trash
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "ID транзакции"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/trash/{id} [delete]
+func PurgeTransaction(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID"})
+	}
+
+	purged, err := Purge(context.Background(), userID, objectID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось удалить транзакцию из корзины")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Транзакция удалена безвозвратно", "purged": purged})
+}
+
+// EmptyTrash godoc
+// @Summary Очистить корзину
+// @Description Безвозвратно удаляет все транзакции из корзины вместе с их вложениями.
+// @Tags trash
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/trash [delete]
+func EmptyTrash(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if userID == primitive.NilObjectID {
+		log.Printf("Ошибка токена: %v\n", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "message": "Действующий токен не найден"})
+	}
+
+	purged, err := Empty(context.Background(), userID)
+	if err != nil {
+		return middleware.ErrorResponse(c, err, "Не удалось очистить корзину")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Корзина очищена", "purged": purged})
+}